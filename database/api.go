@@ -3,9 +3,9 @@ package database
 import (
 	"log"
 	"net/http"
-	"os"
 	"radio/utils"
 	"strconv"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 )
@@ -33,12 +33,19 @@ func HTTPGetPlaylist(w http.ResponseWriter, r *http.Request, params httprouter.P
 	index, _ := strconv.ParseInt(r.URL.Query().Get("index"), 10, 64)
 	index = index*10 - 10
 
+	filter, err := ParseSongFilter(r.URL.Query())
+	if err != nil {
+		utils.SendErrorJSON(w, r, err.Error())
+		return
+	}
+
 	playlistEntries, err := GetPlaylistEntries(playlistid)
 	if err != nil {
 		utils.SendErrorJSON(w, r, "Unknown error")
 		log.Printf("DB error: %v\n", err)
 		return
 	}
+	playlistEntries = filter.FilterEntries(playlistEntries)
 	var toReturn []PlaylistEntry
 	// only list 10 entries per request
 	currentIndex := int64(-1)
@@ -81,6 +88,164 @@ func HTTPGetSong(w http.ResponseWriter, r *http.Request, params httprouter.Param
 	}
 }
 
+// lists 10 songs per page, optionally filtered by metadata
+func HTTPGetSongs(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	filter, err := ParseSongFilter(r.URL.Query())
+	if err != nil {
+		utils.SendErrorJSON(w, r, err.Error())
+		return
+	}
+
+	index, _ := strconv.Atoi(r.URL.Query().Get("index"))
+	index = index*10 - 10
+	if index < 0 {
+		index = 0
+	}
+
+	songs := filter.FilterSongs(GetSongArray())
+	if index >= len(songs) {
+		utils.SendErrorJSON(w, r, "No songs found")
+		return
+	}
+	end := index + 10
+	if end > len(songs) {
+		end = len(songs)
+	}
+
+	j, _ := utils.JSONMarshal(songs[index:end])
+
+	utils.SendJSON(w, r, j)
+}
+
+// changes the metadata of a song; only the given parameters are touched
+func HTTPUpdateSong(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	query := r.URL.Query()
+	songid := query.Get("id")
+	song := GetSongData(songid)
+	if song == nil {
+		utils.SendErrorJSON(w, r, "No song with id "+songid+" found")
+		return
+	}
+
+	if _, ok := query["title"]; ok {
+		song.Title = query.Get("title")
+	}
+	if _, ok := query["authors"]; ok {
+		song.Authors = query.Get("authors")
+	}
+	if _, ok := query["youtube_id"]; ok {
+		song.YTId = query.Get("youtube_id")
+	}
+	if _, ok := query["release_date"]; ok {
+		date, err := time.Parse("2006-01-02", query.Get("release_date"))
+		if err != nil {
+			utils.SendErrorJSON(w, r, "release_date must be YYYY-MM-dd")
+			return
+		}
+		song.ReleaseDate = date
+	}
+	if _, ok := query["bpm"]; ok {
+		bpm, err := strconv.Atoi(query.Get("bpm"))
+		if err != nil {
+			utils.SendErrorJSON(w, r, "bpm must be a number")
+			return
+		}
+		song.BPM = bpm
+	}
+	if _, ok := query["language"]; ok {
+		song.Language = query.Get("language")
+	}
+	if _, ok := query["explicit"]; ok {
+		explicit, err := strconv.ParseBool(query.Get("explicit"))
+		if err != nil {
+			utils.SendErrorJSON(w, r, "explicit must be true or false")
+			return
+		}
+		song.Explicit = explicit
+	}
+	if _, ok := query["isrc"]; ok {
+		song.ISRC = query.Get("isrc")
+	}
+	if _, ok := query["genres"]; ok {
+		song.Genres = SplitTags(query.Get("genres"))
+	}
+	if _, ok := query["tags"]; ok {
+		song.Tags = SplitTags(query.Get("tags"))
+	}
+
+	if err := song.Validate(); err != nil {
+		utils.SendErrorJSON(w, r, err.Error())
+		return
+	}
+	if err := UpdateSong(*song); err != nil {
+		utils.SendErrorJSON(w, r, "Unknown error")
+		log.Printf("DB error (song update): %v\n", err)
+		return
+	}
+
+	j, _ := utils.JSONMarshal(song)
+
+	utils.SendJSON(w, r, j)
+}
+
+// changes the running order or the playback mode of a playlist:
+// ?id=3&action=move&from=5&to=1, action=insert&song=12&position=2,
+// action=reorder&order=3,1,2 or action=mode&mode=shuffle|ordered
+func HTTPUpdatePlaylist(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	query := r.URL.Query()
+	playlistid := query.Get("id")
+	if GetPlaylistData(playlistid) == nil {
+		utils.SendErrorJSON(w, r, "No playlist with id "+playlistid+" found")
+		return
+	}
+
+	var err error
+	switch query.Get("action") {
+	case "move":
+		from, fromErr := strconv.Atoi(query.Get("from"))
+		to, toErr := strconv.Atoi(query.Get("to"))
+		if fromErr != nil || toErr != nil {
+			utils.SendErrorJSON(w, r, "from and to must be positions")
+			return
+		}
+		err = MovePlaylistEntry(playlistid, from, to)
+	case "insert":
+		songid := query.Get("song")
+		if GetSongData(songid) == nil {
+			utils.SendErrorJSON(w, r, "No song with id "+songid+" found")
+			return
+		}
+		position, convErr := strconv.Atoi(query.Get("position"))
+		if convErr != nil {
+			utils.SendErrorJSON(w, r, "position must be a number")
+			return
+		}
+		err = InsertSongIntoPlaylist(playlistid, songid, position)
+	case "reorder":
+		order, parseErr := ParsePositions(query.Get("order"))
+		if parseErr != nil {
+			utils.SendErrorJSON(w, r, parseErr.Error())
+			return
+		}
+		err = ReorderPlaylist(playlistid, order)
+	case "mode":
+		err = SetPlaylistMode(playlistid, query.Get("mode"))
+	default:
+		utils.SendErrorJSON(w, r, "Action must be move, insert, reorder or mode")
+		return
+	}
+
+	if err == ErrNotFound {
+		utils.SendErrorJSON(w, r, "No such position in playlist "+playlistid)
+		return
+	}
+	if err != nil {
+		utils.SendErrorJSON(w, r, err.Error())
+		return
+	}
+	utils.SendResponseJSON(w, r, "Operation successful")
+}
+
 func HTTPUpdateVote(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 	// TODO: verification of group + accesstoken
 	userId := r.URL.Query().Get("userId")
@@ -93,52 +258,275 @@ func HTTPUpdateVote(w http.ResponseWriter, r *http.Request, params httprouter.Pa
 		return
 	}
 
-	respond, err := db.Query(VoteQuery, userId, songId)
-	if err != nil {
+	vote, err := strconv.Atoi(voteType)
+	if err != nil || (vote != 0 && vote != 1) {
+		utils.SendErrorJSON(w, r, "Invalid vote type")
+		return
+	}
+
+	if err := UpdateVote(userId, songId, vote); err != nil {
 		utils.SendErrorJSON(w, r, "Unknown error")
 		log.Printf("DB error (vote update): %v\n", err)
 		return
 	}
+	utils.SendResponseJSON(w, r, "Operation successful")
+}
+
+func HTTPGetSchedule(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	date := r.URL.Query().Get("date")
+
+	sched := GetScheduleFor(date)
+
+	j, _ := utils.JSONMarshal(sched)
+
+	utils.SendJSON(w, r, j)
+}
+
+// accepts YYYY-MM-dd (start of that day) or RFC3339
+func parseScheduleTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// lists plan blocks across dates, e.g. ?from=2021-09-06&to=2021-09-13&playlist=3
+func HTTPGetScheduleBlocks(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	from, err := parseScheduleTime(r.URL.Query().Get("from"))
+	if err != nil {
+		utils.SendErrorJSON(w, r, "Invalid 'from' time")
+		return
+	}
+	to, err := parseScheduleTime(r.URL.Query().Get("to"))
+	if err != nil {
+		utils.SendErrorJSON(w, r, "Invalid 'to' time")
+		return
+	}
+
+	blocks, err := ScheduleBlocks(ScheduleQuery{
+		From:       from,
+		To:         to,
+		PlaylistId: r.URL.Query().Get("playlist"),
+	})
+	if err != nil {
+		utils.SendErrorJSON(w, r, "Unknown error")
+		log.Printf("DB error (schedule blocks): %v\n", err)
+		return
+	}
+
+	j, _ := utils.JSONMarshal(blocks)
+
+	utils.SendJSON(w, r, j)
+}
+
+func HTTPGetTrash(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	trash, err := GetTrash()
+	if err != nil {
+		utils.SendErrorJSON(w, r, "Unknown error")
+		log.Printf("DB error (trash): %v\n", err)
+		return
+	}
+
+	j, _ := utils.JSONMarshal(trash)
+
+	utils.SendJSON(w, r, j)
+}
+
+// takes a song or playlist out of the trash, e.g. ?type=playlist&id=3
+func HTTPRestore(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	id := r.URL.Query().Get("id")
+
+	var err error
+	switch r.URL.Query().Get("type") {
+	case "song":
+		err = RestoreSong(id)
+	case "playlist":
+		err = RestorePlaylist(id)
+	default:
+		utils.SendErrorJSON(w, r, "Type must be song or playlist")
+		return
+	}
+
+	if err == ErrNotFound {
+		utils.SendErrorJSON(w, r, "Nothing with id "+id+" is in the trash")
+		return
+	}
+	if err != nil {
+		utils.SendErrorJSON(w, r, "Unknown error")
+		log.Printf("DB error (restore): %v\n", err)
+		return
+	}
+	utils.SendResponseJSON(w, r, "Operation successful")
+}
 
-	if respond.Next() {
-		_, err2 := db.Exec(UpdateVoteCmd, voteType, userId, songId)
-		if err2 != nil {
-			utils.SendErrorJSON(w, r, "Unknown error")
-			log.Printf("DB error (vote update): %v\n", err2)
+// ?q=<query>&type=song|playlist&index=<page>, see search.go for the query syntax
+func HTTPSearch(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	query := r.URL.Query().Get("q")
+	index, _ := strconv.Atoi(r.URL.Query().Get("index"))
+	index = index*10 - 10
+	if index < 0 {
+		index = 0
+	}
+
+	var results []interface{}
+	switch r.URL.Query().Get("type") {
+	case "", "song":
+		songs, err := SearchSongs(query)
+		if err != nil {
+			utils.SendErrorJSON(w, r, err.Error())
 			return
 		}
-	} else {
-		_, err2 := db.Exec(AddVoteCmd, userId, voteType, songId)
-		if err2 != nil {
-			utils.SendErrorJSON(w, r, "Unknown error")
-			log.Printf("DB error (vote add): %v\n", err2)
+		for _, song := range songs {
+			results = append(results, song)
+		}
+	case "playlist":
+		playlists, err := SearchPlaylists(query)
+		if err != nil {
+			utils.SendErrorJSON(w, r, err.Error())
 			return
 		}
+		for _, playlist := range playlists {
+			results = append(results, playlist)
+		}
+	default:
+		utils.SendErrorJSON(w, r, "Type must be song or playlist")
+		return
 	}
-	utils.SendResponseJSON(w, r, "Operation successful")
+
+	if index >= len(results) {
+		utils.SendErrorJSON(w, r, "No results")
+		return
+	}
+	end := index + 10
+	if end > len(results) {
+		end = len(results)
+	}
+
+	j, _ := utils.JSONMarshal(results[index:end])
+
+	utils.SendJSON(w, r, j)
 }
 
-func HTTPGetCover(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
-	songId := r.URL.Query().Get("id")
+// ?kind=weekly|semester|custom, every period if empty
+func HTTPGetPeriods(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	kind := r.URL.Query().Get("kind")
+
+	periods, err := GetVotingPeriods()
+	if err != nil {
+		utils.SendErrorJSON(w, r, "Unknown error")
+		log.Printf("DB error (voting periods): %v\n", err)
+		return
+	}
 
-	coverfile, err := os.Open("music/" + songId + "/cover.jpg")
-	if err == nil {
-		stat, _ := coverfile.Stat()
-		buffer := make([]byte, stat.Size())
-		coverfile.Read(buffer)
-		w.Header().Set("Content-Type", "image/jpeg")
-		w.Write(buffer)
+	var toReturn []VotingPeriod
+	for _, period := range periods {
+		if kind == "" || period.Kind == kind {
+			toReturn = append(toReturn, period)
+		}
+	}
+
+	if len(toReturn) == 0 {
+		utils.SendErrorJSON(w, r, "No voting periods found")
+		return
+	}
+	j, _ := utils.JSONMarshal(toReturn)
+
+	utils.SendJSON(w, r, j)
+}
+
+type leaderboard struct {
+	Period VotingPeriod    `json:"period"`
+	Chart  []ChartPosition `json:"chart"`
+}
+
+// ?period=<id>; the current week if empty or "current"
+func HTTPLeaderboard(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	periodParam := r.URL.Query().Get("period")
+
+	var period *VotingPeriod
+	var err error
+	if periodParam == "" || periodParam == "current" {
+		period, err = CurrentWeeklyPeriod()
 	} else {
-		w.WriteHeader(http.StatusNotFound)
+		periodid, convErr := strconv.Atoi(periodParam)
+		if convErr != nil {
+			utils.SendErrorJSON(w, r, "Period must be a number or current")
+			return
+		}
+		period, err = GetVotingPeriod(periodid)
+	}
+	if err == ErrNotFound {
+		utils.SendErrorJSON(w, r, "No voting period with id "+periodParam+" found")
+		return
+	}
+	if err != nil {
+		utils.SendErrorJSON(w, r, "Unknown error")
+		log.Printf("DB error (leaderboard): %v\n", err)
+		return
+	}
+
+	chart, err := Leaderboard(*period)
+	if err != nil {
+		utils.SendErrorJSON(w, r, "Unknown error")
+		log.Printf("DB error (leaderboard): %v\n", err)
+		return
 	}
+
+	j, _ := utils.JSONMarshal(leaderboard{Period: *period, Chart: chart})
+
+	utils.SendJSON(w, r, j)
 }
 
-func HTTPGetSchedule(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	date := r.URL.Query().Get("date")
+// placements of a song in every archived chart, ?id=<song id>
+func HTTPSongChart(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	songid := r.URL.Query().Get("id")
 
-	sched := GetScheduleFor(date)
+	entries, err := SongChart(songid)
+	if err != nil {
+		utils.SendErrorJSON(w, r, "Unknown error")
+		log.Printf("DB error (song chart): %v\n", err)
+		return
+	}
 
-	j, _ := utils.JSONMarshal(sched)
+	if len(entries) == 0 {
+		utils.SendErrorJSON(w, r, "Song with id "+songid+" has never charted")
+		return
+	}
+	j, _ := utils.JSONMarshal(entries)
 
 	utils.SendJSON(w, r, j)
 }
+
+// ?keep=<song id>&duplicate=<song id>, moves the playlist entries and votes
+// of duplicate onto keep and trashes duplicate
+func HTTPMergeSongs(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	keep, err := strconv.Atoi(r.URL.Query().Get("keep"))
+	if err != nil {
+		utils.SendErrorJSON(w, r, "keep must be a song id")
+		return
+	}
+	duplicate, err := strconv.Atoi(r.URL.Query().Get("duplicate"))
+	if err != nil {
+		utils.SendErrorJSON(w, r, "duplicate must be a song id")
+		return
+	}
+
+	err = MergeSongs(keep, duplicate)
+	if err == ErrSelfMerge {
+		utils.SendErrorJSON(w, r, err.Error())
+		return
+	}
+	if err == ErrNotFound {
+		utils.SendErrorJSON(w, r, "Both songs must exist and not be in the trash")
+		return
+	}
+	if err != nil {
+		utils.SendErrorJSON(w, r, "Unknown error")
+		log.Printf("DB error (merge songs): %v\n", err)
+		return
+	}
+	utils.SendResponseJSON(w, r, "Operation successful")
+}
@@ -0,0 +1,376 @@
+package database
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"radio/utils"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// a memory store with songs 1-12 and playlist 1 holding songs 1-3 in order,
+// in use along with fresh search and vote caches
+func apiStore(t *testing.T) *memoryStore {
+	t.Helper()
+	var titles []string
+	for i := 1; i <= 12; i++ {
+		titles = append(titles, "song "+strconv.Itoa(i))
+	}
+	s := storeWithSongs(t, titles...)
+	if _, err := s.AddPlaylist(Playlist{Name: "Morning", Mode: PlaybackOrdered}); err != nil {
+		t.Fatal(err)
+	}
+	for _, songid := range []string{"1", "2", "3"} {
+		if err := s.AddSongToPlaylist("1", songid, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	SetStore(s)
+	invalidateSearch()
+	tallies.invalidate()
+	return s
+}
+
+func serveAPI(t *testing.T, handle httprouter.Handle, target string) []byte {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handle(w, httptest.NewRequest(http.MethodGet, target, nil), nil)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Content-Type = %q, want application/json", ct)
+	}
+	return w.Body.Bytes()
+}
+
+// checks that the body is a JsonResponse with the given error flag and message
+func checkResponse(t *testing.T, body []byte, wantErr bool, wantMsg string) {
+	t.Helper()
+	var res utils.JsonResponse
+	if err := json.Unmarshal(body, &res); err != nil {
+		t.Fatalf("body %s: %v", body, err)
+	}
+	if res.Err != wantErr || res.Message != wantMsg {
+		t.Errorf("response = %+v, want error %v with %q", res, wantErr, wantMsg)
+	}
+}
+
+func decodeBody(t *testing.T, body []byte, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(body, v); err != nil {
+		t.Fatalf("body %s: %v", body, err)
+	}
+}
+
+func TestHTTPErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		handle  httprouter.Handle
+		target  string
+		wantMsg string
+	}{
+		{"playlist with bad filter", HTTPGetPlaylist, "/getplaylist?id=1&explicit=maybe", "explicit must be true or false"},
+		{"unknown playlist", HTTPGetPlaylist, "/getplaylist?id=7", "No playlist with id 7 found"},
+		{"playlist page past the end", HTTPGetPlaylist, "/getplaylist?id=1&index=2", "No playlist with id 1 found"},
+		{"unknown song", HTTPGetSong, "/getsong?id=99", "No song with id 99 found"},
+		{"songs with bad filter", HTTPGetSongs, "/getsongs?minbpm=fast", "minbpm must be a number"},
+		{"songs page past the end", HTTPGetSongs, "/getsongs?index=3", "No songs found"},
+		{"update unknown song", HTTPUpdateSong, "/updatesong?id=99&title=x", "No song with id 99 found"},
+		{"update with bad date", HTTPUpdateSong, "/updatesong?id=1&release_date=yesterday", "release_date must be YYYY-MM-dd"},
+		{"update with bad bpm", HTTPUpdateSong, "/updatesong?id=1&bpm=fast", "bpm must be a number"},
+		{"update with bad explicit", HTTPUpdateSong, "/updatesong?id=1&explicit=maybe", "explicit must be true or false"},
+		{"update unknown playlist", HTTPUpdatePlaylist, "/updateplaylist?id=7&action=mode&mode=shuffle", "No playlist with id 7 found"},
+		{"unknown playlist action", HTTPUpdatePlaylist, "/updateplaylist?id=1&action=sort", "Action must be move, insert, reorder or mode"},
+		{"move without positions", HTTPUpdatePlaylist, "/updateplaylist?id=1&action=move&from=1", "from and to must be positions"},
+		{"move past the end", HTTPUpdatePlaylist, "/updateplaylist?id=1&action=move&from=1&to=9", "No such position in playlist 1"},
+		{"insert unknown song", HTTPUpdatePlaylist, "/updateplaylist?id=1&action=insert&song=99&position=1", "No song with id 99 found"},
+		{"insert without position", HTTPUpdatePlaylist, "/updateplaylist?id=1&action=insert&song=4", "position must be a number"},
+		{"reorder with bad list", HTTPUpdatePlaylist, "/updateplaylist?id=1&action=reorder&order=1,x", "positions must be numbers separated by commas"},
+		{"unknown mode", HTTPUpdatePlaylist, "/updateplaylist?id=1&action=mode&mode=random", "playback mode must be shuffle or ordered"},
+		{"vote for unknown song", HTTPUpdateVote, "/updatevote?userId=s1&songId=99&voteType=1", "Song with given id doesn't exist"},
+		{"bad vote type", HTTPUpdateVote, "/updatevote?userId=s1&songId=1&voteType=2", "Invalid vote type"},
+		{"blocks with bad from", HTTPGetScheduleBlocks, "/getscheduleblocks?from=monday", "Invalid 'from' time"},
+		{"blocks with bad to", HTTPGetScheduleBlocks, "/getscheduleblocks?to=friday", "Invalid 'to' time"},
+		{"restore unknown type", HTTPRestore, "/restore?type=vote&id=1", "Type must be song or playlist"},
+		{"restore song not in the trash", HTTPRestore, "/restore?type=song&id=1", "Nothing with id 1 is in the trash"},
+		{"search unknown type", HTTPSearch, "/search?q=song&type=author", "Type must be song or playlist"},
+		{"search without results", HTTPSearch, "/search?q=nothing", "No results"},
+		{"no periods", HTTPGetPeriods, "/getperiods", "No voting periods found"},
+		{"leaderboard with bad period", HTTPLeaderboard, "/leaderboard?period=last", "Period must be a number or current"},
+		{"leaderboard of unknown period", HTTPLeaderboard, "/leaderboard?period=7", "No voting period with id 7 found"},
+		{"song never charted", HTTPSongChart, "/songchart?id=1", "Song with id 1 has never charted"},
+		{"merge without keep", HTTPMergeSongs, "/mergesongs?duplicate=2", "keep must be a song id"},
+		{"merge without duplicate", HTTPMergeSongs, "/mergesongs?keep=1", "duplicate must be a song id"},
+		{"merge into itself", HTTPMergeSongs, "/mergesongs?keep=1&duplicate=1", ErrSelfMerge.Error()},
+		{"merge unknown song", HTTPMergeSongs, "/mergesongs?keep=1&duplicate=99", "Both songs must exist and not be in the trash"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiStore(t)
+			checkResponse(t, serveAPI(t, tt.handle, tt.target), true, tt.wantMsg)
+		})
+	}
+}
+
+func TestHTTPGetPlaylistIndex(t *testing.T) {
+	SetStore(NewMemoryStore())
+	checkResponse(t, serveAPI(t, HTTPGetPlaylistIndex, "/getplaylists"), true, "No playlists found")
+
+	apiStore(t)
+	var playlists []Playlist
+	decodeBody(t, serveAPI(t, HTTPGetPlaylistIndex, "/getplaylists"), &playlists)
+	if len(playlists) != 1 || playlists[0].Name != "Morning" {
+		t.Errorf("playlists = %+v, want Morning", playlists)
+	}
+}
+
+func TestHTTPGetPlaylist(t *testing.T) {
+	apiStore(t)
+	var entries []PlaylistEntry
+	decodeBody(t, serveAPI(t, HTTPGetPlaylist, "/getplaylist?id=1"), &entries)
+
+	var got []int
+	for _, entry := range entries {
+		got = append(got, entry.SongId)
+		if entry.Song.SongId != entry.SongId {
+			t.Errorf("entry %d carries song %d", entry.SongId, entry.Song.SongId)
+		}
+	}
+	if want := []int{1, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("songs = %v, want %v", got, want)
+	}
+}
+
+func TestHTTPGetSongs(t *testing.T) {
+	tests := []struct {
+		target string
+		want   []int
+	}{
+		{"/getsongs", []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}},
+		{"/getsongs?index=1", []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}},
+		{"/getsongs?index=2", []int{11, 12}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			apiStore(t)
+			var songs []SongData
+			decodeBody(t, serveAPI(t, HTTPGetSongs, tt.target), &songs)
+			if got := songIds(songs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("songs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPGetSong(t *testing.T) {
+	apiStore(t)
+	var song SongData
+	decodeBody(t, serveAPI(t, HTTPGetSong, "/getsong?id=4"), &song)
+	if song.SongId != 4 || song.Title != "song 4" {
+		t.Errorf("song = %+v, want song 4", song)
+	}
+}
+
+func TestHTTPUpdateSong(t *testing.T) {
+	apiStore(t)
+	var song SongData
+	decodeBody(t, serveAPI(t, HTTPUpdateSong, "/updatesong?id=2&title=Renamed&bpm=120&explicit=true&genres=rock,pop"), &song)
+	if song.Title != "Renamed" || song.BPM != 120 || !song.Explicit {
+		t.Errorf("response = %+v, want the new metadata", song)
+	}
+
+	stored := GetSongData("2")
+	if stored == nil || stored.Title != "Renamed" || stored.BPM != 120 || !reflect.DeepEqual(stored.Genres, []string{"rock", "pop"}) {
+		t.Errorf("stored song = %+v, want the new metadata", stored)
+	}
+	if stored != nil && stored.Authors != "" {
+		t.Errorf("authors = %q, want them untouched", stored.Authors)
+	}
+}
+
+func TestHTTPUpdatePlaylist(t *testing.T) {
+	tests := []struct {
+		target string
+		want   []int
+	}{
+		{"/updateplaylist?id=1&action=move&from=3&to=1", []int{3, 1, 2}},
+		{"/updateplaylist?id=1&action=insert&song=5&position=2", []int{1, 5, 2, 3}},
+		{"/updateplaylist?id=1&action=reorder&order=2,3,1", []int{2, 3, 1}},
+		{"/updateplaylist?id=1&action=mode&mode=shuffle", []int{1, 2, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			apiStore(t)
+			checkResponse(t, serveAPI(t, HTTPUpdatePlaylist, tt.target), false, "Operation successful")
+
+			entries, err := GetPlaylistEntries("1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []int
+			for _, entry := range entries {
+				got = append(got, entry.SongId)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("songs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPVotes(t *testing.T) {
+	apiStore(t)
+	for _, target := range []string{
+		"/updatevote?userId=s1&songId=2&voteType=1",
+		"/updatevote?userId=s2&songId=2&voteType=1",
+		"/updatevote?userId=s1&songId=3&voteType=0",
+		// changes the vote of s1 rather than adding one
+		"/updatevote?userId=s1&songId=3&voteType=1",
+	} {
+		checkResponse(t, serveAPI(t, HTTPUpdateVote, target), false, "Operation successful")
+	}
+
+	var board leaderboard
+	decodeBody(t, serveAPI(t, HTTPLeaderboard, "/leaderboard"), &board)
+	if board.Period.Kind != PeriodWeekly {
+		t.Errorf("period = %+v, want the current week", board.Period)
+	}
+	want := []ChartPosition{
+		{Position: 1, SongId: 2, Title: "song 2", Up: 2, Score: 2},
+		{Position: 2, SongId: 3, Title: "song 3", Up: 1, Score: 1},
+	}
+	if !reflect.DeepEqual(board.Chart, want) {
+		t.Errorf("chart = %+v, want %+v", board.Chart, want)
+	}
+
+	var periods []VotingPeriod
+	decodeBody(t, serveAPI(t, HTTPGetPeriods, "/getperiods?kind=weekly"), &periods)
+	if len(periods) != 1 || periods[0].Id != board.Period.Id {
+		t.Errorf("periods = %+v, want the current week", periods)
+	}
+	checkResponse(t, serveAPI(t, HTTPGetPeriods, "/getperiods?kind=semester"), true, "No voting periods found")
+
+	if err := ClosePeriod(board.Period.Id); err != nil {
+		t.Fatal(err)
+	}
+	var entries []SongChartEntry
+	decodeBody(t, serveAPI(t, HTTPSongChart, "/songchart?id=2"), &entries)
+	if len(entries) != 1 || entries[0].PeriodId != board.Period.Id || entries[0].Position != 1 {
+		t.Errorf("song chart = %+v, want first place in period %d", entries, board.Period.Id)
+	}
+}
+
+func TestHTTPTrash(t *testing.T) {
+	s := apiStore(t)
+	if err := s.DelSong("4"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DelPlaylist("1"); err != nil {
+		t.Fatal(err)
+	}
+
+	var trash Trash
+	decodeBody(t, serveAPI(t, HTTPGetTrash, "/gettrash"), &trash)
+	if got := songIds(trash.Songs); !reflect.DeepEqual(got, []int{4}) {
+		t.Errorf("trashed songs = %v, want [4]", got)
+	}
+	if len(trash.Playlists) != 1 || trash.Playlists[0].Id != 1 {
+		t.Errorf("trashed playlists = %+v, want playlist 1", trash.Playlists)
+	}
+
+	checkResponse(t, serveAPI(t, HTTPRestore, "/restore?type=song&id=4"), false, "Operation successful")
+	checkResponse(t, serveAPI(t, HTTPRestore, "/restore?type=playlist&id=1"), false, "Operation successful")
+	if GetSongData("4") == nil || GetPlaylistData("1") == nil {
+		t.Error("restored song or playlist still missing")
+	}
+	checkResponse(t, serveAPI(t, HTTPRestore, "/restore?type=playlist&id=1"), true, "Nothing with id 1 is in the trash")
+}
+
+func TestHTTPSearch(t *testing.T) {
+	apiStore(t)
+	var songs []SongResult
+	decodeBody(t, serveAPI(t, HTTPSearch, "/search?q=song"), &songs)
+	if len(songs) != 10 {
+		t.Errorf("found %d songs on the first page, want 10", len(songs))
+	}
+	decodeBody(t, serveAPI(t, HTTPSearch, "/search?q=song&index=2"), &songs)
+	if len(songs) != 2 {
+		t.Errorf("found %d songs on the second page, want 2", len(songs))
+	}
+
+	var playlists []PlaylistResult
+	decodeBody(t, serveAPI(t, HTTPSearch, "/search?q=morning&type=playlist"), &playlists)
+	if len(playlists) != 1 || playlists[0].Id != 1 {
+		t.Errorf("playlists = %+v, want playlist 1", playlists)
+	}
+}
+
+func TestHTTPMergeSongs(t *testing.T) {
+	apiStore(t)
+	checkResponse(t, serveAPI(t, HTTPMergeSongs, "/mergesongs?keep=5&duplicate=2"), false, "Operation successful")
+
+	if GetSongData("2") != nil {
+		t.Error("duplicate still live after the merge")
+	}
+	entries, err := GetPlaylistEntries("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	for _, entry := range entries {
+		got = append(got, entry.SongId)
+	}
+	if want := []int{1, 5, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("playlist songs = %v, want %v", got, want)
+	}
+}
+
+func TestHTTPSchedule(t *testing.T) {
+	s := apiStore(t)
+	day := time.Date(2021, 9, 7, 0, 0, 0, 0, time.UTC)
+	planned := Schedule{
+		NewPlanBlock(BlockPlaylist, day.Add(8*time.Hour), day.Add(9*time.Hour), "1", nil),
+		NewPlanBlock(BlockSilence, day.Add(12*time.Hour), day.Add(13*time.Hour), "", nil),
+	}
+	if err := s.SetSchedule("2021-09-07", planned); err != nil {
+		t.Fatal(err)
+	}
+
+	var schedule Schedule
+	decodeBody(t, serveAPI(t, HTTPGetSchedule, "/getschedule?date=2021-09-07"), &schedule)
+	if len(schedule) != 2 {
+		t.Errorf("schedule = %+v, want both blocks", schedule)
+	}
+
+	tests := []struct {
+		target string
+		want   int
+	}{
+		{"/getscheduleblocks", 2},
+		{"/getscheduleblocks?from=2021-09-06&to=2021-09-13", 2},
+		{"/getscheduleblocks?from=2021-09-07T10:00:00Z", 1},
+		{"/getscheduleblocks?playlist=1", 1},
+		{"/getscheduleblocks?from=2021-09-08", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			var blocks []ScheduledBlock
+			decodeBody(t, serveAPI(t, HTTPGetScheduleBlocks, tt.target), &blocks)
+			if len(blocks) != tt.want {
+				t.Errorf("blocks = %+v, want %d of them", blocks, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,588 @@
+package database
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// an archive is a gzipped tar with the library as JSON in archiveManifest,
+// followed by the files of every song under music/<song id>/
+const (
+	archiveVersion  = 1
+	archiveManifest = "library.json"
+)
+
+// where songs keep their audio and cover files, one directory per song id
+const MusicDir = "music"
+
+// files in a song's directory which are made again from its audio on demand,
+// like the waveforms of library/waveform.go, and so aren't archived
+var derivedFile = regexp.MustCompile(`^waveform-\d+\.json$`)
+
+type ArchivedPlaylist struct {
+	Playlist
+	// song ids in running order
+	Entries []int `json:"entries"`
+}
+
+// the library as written to library.json
+type Archive struct {
+	Version    int                 `json:"version"`
+	ExportedAt time.Time           `json:"exported_at"`
+	Songs      []SongData          `json:"songs"`
+	Playlists  []ArchivedPlaylist  `json:"playlists"`
+	Schedules  map[string]Schedule `json:"schedules"`
+	Votes      []Vote              `json:"votes"`
+}
+
+// what an import changed, or would change on a dry run
+type ImportReport struct {
+	DryRun    bool
+	Songs     int
+	Playlists int
+	Entries   int
+	Schedules int
+	Votes     int
+	Files     int
+	// old id -> new id of the ones which collided with ids in use;
+	// new ids are 0 on a dry run, since they're only known once inserted
+	RemappedSongs     map[int]int
+	RemappedPlaylists map[int]int
+	// dates which already had a schedule here and were left alone
+	SkippedSchedules []string
+}
+
+// collects the library; trashed songs and playlists are left out
+func buildArchive() (*Archive, error) {
+	archive := &Archive{
+		Version:    archiveVersion,
+		ExportedAt: time.Now(),
+		Schedules:  map[string]Schedule{},
+	}
+
+	songs, err := store.Songs()
+	if err != nil {
+		return nil, err
+	}
+	archive.Songs = songs
+
+	// votes of every period, oldest and newest alike
+	from, to := time.Time{}, time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, song := range songs {
+		for _, votetype := range []int{0, 1} {
+			votes, err := store.Votes(strconv.Itoa(song.SongId), votetype, from, to)
+			if err != nil {
+				return nil, err
+			}
+			archive.Votes = append(archive.Votes, votes...)
+		}
+	}
+
+	playlists, err := store.Playlists()
+	if err != nil {
+		return nil, err
+	}
+	for _, playlist := range playlists {
+		entries, err := store.PlaylistEntries(strconv.Itoa(playlist.Id))
+		if err != nil {
+			return nil, err
+		}
+		archived := ArchivedPlaylist{Playlist: playlist}
+		for _, entry := range entries {
+			archived.Entries = append(archived.Entries, entry.SongId)
+		}
+		archive.Playlists = append(archive.Playlists, archived)
+	}
+
+	blocks, err := store.ScheduleBlocks(ScheduleQuery{})
+	if err != nil {
+		return nil, err
+	}
+	for _, block := range blocks {
+		if _, ok := archive.Schedules[block.Date]; ok {
+			continue
+		}
+		schedule, err := store.Schedule(block.Date)
+		if err != nil {
+			return nil, err
+		}
+		archive.Schedules[block.Date] = schedule
+	}
+	return archive, nil
+}
+
+func writeArchiveFile(tw *tar.Writer, name, source string) error {
+	f, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	header := &tar.Header{Name: name, Mode: 0644, Size: stat.Size(), ModTime: stat.ModTime()}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// writes the library and the song files to an archive at target,
+// returns the number of files packed
+func ExportArchive(target string) (int, error) {
+	archive, err := buildArchive()
+	if err != nil {
+		return 0, fmt.Errorf("couldn't read the library: %v", err)
+	}
+	manifest, err := json.MarshalIndent(archive, "", "\t")
+	if err != nil {
+		return 0, err
+	}
+
+	out, err := os.Create(target)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+
+	// the manifest goes first, so an import knows the ids before reading files
+	header := &tar.Header{Name: archiveManifest, Mode: 0644, Size: int64(len(manifest)), ModTime: archive.ExportedAt}
+	if err := tw.WriteHeader(header); err != nil {
+		return 0, err
+	}
+	if _, err := tw.Write(manifest); err != nil {
+		return 0, err
+	}
+
+	files := 0
+	for _, song := range archive.Songs {
+		dir := filepath.Join(MusicDir, strconv.Itoa(song.SongId))
+		infos, err := ioutil.ReadDir(dir)
+		if os.IsNotExist(err) {
+			log.Printf("Song %d has no files in %s\n", song.SongId, dir)
+			continue
+		}
+		if err != nil {
+			return files, err
+		}
+		for _, info := range infos {
+			if !info.Mode().IsRegular() || derivedFile.MatchString(info.Name()) {
+				continue
+			}
+			name := path.Join(MusicDir, strconv.Itoa(song.SongId), info.Name())
+			if err := writeArchiveFile(tw, name, filepath.Join(dir, info.Name())); err != nil {
+				return files, fmt.Errorf("couldn't pack %s: %v", name, err)
+			}
+			files++
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return files, err
+	}
+	if err := gz.Close(); err != nil {
+		return files, err
+	}
+	return files, out.Close()
+}
+
+// ids taken by live and trashed rows
+func usedIds() (songs map[int]bool, playlists map[int]bool, err error) {
+	songs = map[int]bool{}
+	playlists = map[int]bool{}
+
+	live, err := store.Songs()
+	if err != nil {
+		return nil, nil, err
+	}
+	trashed, err := store.TrashedSongs()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, song := range append(live, trashed...) {
+		songs[song.SongId] = true
+	}
+
+	livePlaylists, err := store.Playlists()
+	if err != nil {
+		return nil, nil, err
+	}
+	trashedPlaylists, err := store.TrashedPlaylists()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, playlist := range append(livePlaylists, trashedPlaylists...) {
+		playlists[playlist.Id] = true
+	}
+	return songs, playlists, nil
+}
+
+// checks the archive and works out which ids stay and which need a new one
+func planImport(archive *Archive, report *ImportReport) error {
+	if archive.Version != archiveVersion {
+		return fmt.Errorf("archive version %d isn't supported", archive.Version)
+	}
+
+	usedSongs, usedPlaylists, err := usedIds()
+	if err != nil {
+		return err
+	}
+
+	archivedSongs := map[int]bool{}
+	for i := range archive.Songs {
+		song := &archive.Songs[i]
+		if archivedSongs[song.SongId] {
+			return fmt.Errorf("song %d is in the archive twice", song.SongId)
+		}
+		archivedSongs[song.SongId] = true
+		if err := song.Validate(); err != nil {
+			return fmt.Errorf("song %d: %v", song.SongId, err)
+		}
+		if usedSongs[song.SongId] {
+			report.RemappedSongs[song.SongId] = 0
+		}
+	}
+
+	archivedPlaylists := map[int]bool{}
+	for _, playlist := range archive.Playlists {
+		if archivedPlaylists[playlist.Id] {
+			return fmt.Errorf("playlist %d is in the archive twice", playlist.Id)
+		}
+		archivedPlaylists[playlist.Id] = true
+		if playlist.Mode != PlaybackShuffle && playlist.Mode != PlaybackOrdered {
+			return fmt.Errorf("playlist %d has an unknown playback mode %q", playlist.Id, playlist.Mode)
+		}
+		if usedPlaylists[playlist.Id] {
+			report.RemappedPlaylists[playlist.Id] = 0
+		}
+		for _, songid := range playlist.Entries {
+			if !archivedSongs[songid] {
+				return fmt.Errorf("playlist %d lists song %d, which isn't in the archive", playlist.Id, songid)
+			}
+		}
+	}
+
+	for date, schedule := range archive.Schedules {
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			return fmt.Errorf("schedule date %q isn't YYYY-MM-dd", date)
+		}
+		for _, plan := range schedule {
+			if plan.Type.Playlist.Active {
+				id, _ := strconv.Atoi(plan.Type.Playlist.PlaylistId)
+				if !archivedPlaylists[id] {
+					return fmt.Errorf("schedule for %s plays playlist %s, which isn't in the archive", date, plan.Type.Playlist.PlaylistId)
+				}
+			}
+		}
+	}
+
+	for _, vote := range archive.Votes {
+		if !archivedSongs[vote.Song] {
+			return fmt.Errorf("a vote of %s is for song %d, which isn't in the archive", vote.Student, vote.Song)
+		}
+	}
+	return nil
+}
+
+// inserts songs and playlists, the ones keeping their ids first, so that
+// auto-assigned ids don't land on ids which are still to be imported
+func importRows(tx ImportTx, archive *Archive, report *ImportReport, songids, playlistids map[int]int) error {
+	for _, keep := range []bool{true, false} {
+		for _, song := range archive.Songs {
+			if _, remapped := report.RemappedSongs[song.SongId]; remapped == keep {
+				continue
+			}
+			oldid := song.SongId
+			if !keep {
+				song.SongId = 0
+			}
+			newid, err := tx.AddSong(song)
+			if err != nil {
+				return fmt.Errorf("couldn't import song %d: %v", oldid, err)
+			}
+			songids[oldid] = newid
+			if !keep {
+				report.RemappedSongs[oldid] = newid
+			}
+			report.Songs++
+		}
+
+		for _, archived := range archive.Playlists {
+			if _, remapped := report.RemappedPlaylists[archived.Id]; remapped == keep {
+				continue
+			}
+			playlist := archived.Playlist
+			if !keep {
+				playlist.Id = 0
+			}
+			newid, err := tx.AddPlaylist(playlist)
+			if err != nil {
+				return fmt.Errorf("couldn't import playlist %d: %v", archived.Id, err)
+			}
+			playlistids[archived.Id] = newid
+			if !keep {
+				report.RemappedPlaylists[archived.Id] = newid
+			}
+			report.Playlists++
+		}
+	}
+
+	for _, archived := range archive.Playlists {
+		playlistid := strconv.Itoa(playlistids[archived.Id])
+		for _, songid := range archived.Entries {
+			if err := tx.AddSongToPlaylist(playlistid, strconv.Itoa(songids[songid]), 0); err != nil {
+				return fmt.Errorf("couldn't add song %d to playlist %d: %v", songid, archived.Id, err)
+			}
+			report.Entries++
+		}
+	}
+	return nil
+}
+
+// returns the plan blocks with playlist references pointing at the imported playlists
+func remapSchedule(schedule Schedule, playlistids map[int]int) Schedule {
+	remapped := make(Schedule, len(schedule))
+	for i, plan := range schedule {
+		if plan.Type.Playlist.Active {
+			id, _ := strconv.Atoi(plan.Type.Playlist.PlaylistId)
+			plan.Type.Playlist.PlaylistId = strconv.Itoa(playlistids[id])
+		}
+		remapped[i] = plan
+	}
+	return remapped
+}
+
+// tx is nil on a dry run
+func importSchedules(tx ImportTx, archive *Archive, report *ImportReport, playlistids map[int]int) error {
+	var dates []string
+	for date := range archive.Schedules {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+
+	for _, date := range dates {
+		existing, err := store.Schedule(date)
+		if err != nil {
+			return err
+		}
+		if len(existing) > 0 {
+			report.SkippedSchedules = append(report.SkippedSchedules, date)
+			continue
+		}
+		report.Schedules++
+		if report.DryRun {
+			continue
+		}
+		if err := tx.SetSchedule(date, remapSchedule(archive.Schedules[date], playlistids)); err != nil {
+			return fmt.Errorf("couldn't import schedule for %s: %v", date, err)
+		}
+	}
+	return nil
+}
+
+// reads music/<song id>/<file> entries into staging/<song id>/, or only counts them
+// on a dry run, when staging is empty
+func importFiles(tr *tar.Reader, report *ImportReport, archived map[int]bool, staging string) error {
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		parts := strings.Split(path.Clean(header.Name), "/")
+		if len(parts) != 3 || parts[0] != MusicDir {
+			log.Printf("Skipping unexpected archive entry %s\n", header.Name)
+			continue
+		}
+		oldid, err := strconv.Atoi(parts[1])
+		if err != nil {
+			log.Printf("Skipping unexpected archive entry %s\n", header.Name)
+			continue
+		}
+		if !archived[oldid] {
+			log.Printf("Skipping %s, song %d isn't in the archive\n", header.Name, oldid)
+			continue
+		}
+
+		report.Files++
+		if staging == "" {
+			continue
+		}
+
+		dir := filepath.Join(staging, parts[1])
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		out, err := os.Create(filepath.Join(dir, parts[2]))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, tr)
+		out.Close()
+		if err != nil {
+			return fmt.Errorf("couldn't unpack %s: %v", header.Name, err)
+		}
+	}
+}
+
+// moves the unpacked files to music/<new song id>/; the files moved are added
+// to placed, so a failed import can remove them again
+func placeFiles(staging string, songids map[int]int, placed *[]string) error {
+	dirs, err := ioutil.ReadDir(staging)
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		oldid, _ := strconv.Atoi(dir.Name())
+		target := filepath.Join(MusicDir, strconv.Itoa(songids[oldid]))
+		if err := os.MkdirAll(target, 0755); err != nil {
+			return err
+		}
+		files, err := ioutil.ReadDir(filepath.Join(staging, dir.Name()))
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			to := filepath.Join(target, file.Name())
+			if err := os.Rename(filepath.Join(staging, dir.Name(), file.Name()), to); err != nil {
+				return err
+			}
+			*placed = append(*placed, to)
+		}
+	}
+	return nil
+}
+
+// adds the contents of an archive to the library; songs and playlists whose ids
+// are taken here get new ones, and everything pointing at them follows.
+// The import is one transaction, which is rolled back on any error along with the
+// files moved into place so far. On a dry run nothing is written and the report tells what would happen.
+func ImportArchive(source string, dryRun bool) (*ImportReport, error) {
+	in, err := os.Open(source)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	gz, err := gzip.NewReader(in)
+	if err != nil {
+		return nil, fmt.Errorf("%s isn't an archive: %v", source, err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	header, err := tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("%s isn't an archive: %v", source, err)
+	}
+	if header.Name != archiveManifest {
+		return nil, errors.New("archive doesn't start with " + archiveManifest)
+	}
+	var archive Archive
+	if err := json.NewDecoder(tr).Decode(&archive); err != nil {
+		return nil, fmt.Errorf("couldn't read %s: %v", archiveManifest, err)
+	}
+
+	report := &ImportReport{
+		DryRun:            dryRun,
+		RemappedSongs:     map[int]int{},
+		RemappedPlaylists: map[int]int{},
+	}
+	if err := planImport(&archive, report); err != nil {
+		return nil, err
+	}
+
+	archived := map[int]bool{}
+	for _, song := range archive.Songs {
+		archived[song.SongId] = true
+	}
+	if dryRun {
+		report.Songs = len(archive.Songs)
+		report.Playlists = len(archive.Playlists)
+		for _, playlist := range archive.Playlists {
+			report.Entries += len(playlist.Entries)
+		}
+		report.Votes = len(archive.Votes)
+		if err := importSchedules(nil, &archive, report, nil); err != nil {
+			return report, err
+		}
+		if err := importFiles(tr, report, archived, ""); err != nil {
+			return report, err
+		}
+		return report, nil
+	}
+
+	// the files are unpacked first, in a folder the scanner skips, so the
+	// transaction below only has to move them
+	if err := os.MkdirAll(MusicDir, 0755); err != nil {
+		return nil, err
+	}
+	staging, err := ioutil.TempDir(MusicDir, ".import-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+	if err := importFiles(tr, report, archived, staging); err != nil {
+		return nil, fmt.Errorf("nothing was imported: %v", err)
+	}
+
+	// old id -> id in this library
+	songids := map[int]int{}
+	playlistids := map[int]int{}
+	var placed []string
+	err = store.Import(func(tx ImportTx) error {
+		if err := importRows(tx, &archive, report, songids, playlistids); err != nil {
+			return err
+		}
+		for _, vote := range archive.Votes {
+			vote.Song = songids[vote.Song]
+			if err := tx.ImportVote(vote); err != nil {
+				return fmt.Errorf("couldn't import a vote of %s: %v", vote.Student, err)
+			}
+			report.Votes++
+		}
+		if err := importSchedules(tx, &archive, report, playlistids); err != nil {
+			return err
+		}
+		return placeFiles(staging, songids, &placed)
+	})
+	if err != nil {
+		for _, file := range placed {
+			if rmErr := os.Remove(file); rmErr != nil {
+				log.Printf("Couldn't remove %s: %v\n", file, rmErr)
+			}
+		}
+		return nil, fmt.Errorf("nothing was imported: %v", err)
+	}
+	invalidateSearch()
+	tallies.invalidate()
+
+	for _, playlistid := range playlistids {
+		OnPlaylistChange(strconv.Itoa(playlistid))
+	}
+	return report, nil
+}
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"radio/utils"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// a bearer token which unlocks the admin endpoints
+type APIToken struct {
+	Id        int        `json:"id"`
+	Name      string     `json:"name"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+type tokenContextKey struct{}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func GetAPITokens() ([]APIToken, error) {
+	return store.APITokens()
+}
+
+// creates a token for name and returns it; it can't be looked up later
+func AddAPIToken(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errors.New("token needs a name, e.g. the DJ it's for")
+	}
+	token := utils.GenerateToken()
+	if _, err := store.AddAPIToken(name, hashToken(token)); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func RevokeAPIToken(tokenid int) error {
+	return store.RevokeAPIToken(tokenid)
+}
+
+// returns the token a request was let in with, or nil outside RequireToken
+func RequestToken(r *http.Request) *APIToken {
+	token, _ := r.Context().Value(tokenContextKey{}).(*APIToken)
+	return token
+}
+
+// lets a request through only with a valid "Authorization: Bearer <token>" header
+func RequireToken(handle httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		header := r.Header.Get("Authorization")
+		if !strings.HasPrefix(header, "Bearer ") {
+			utils.SendErrorJSON(w, r, "This endpoint needs an API token")
+			return
+		}
+
+		token, err := store.APITokenByHash(hashToken(strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))))
+		if err == ErrNotFound {
+			utils.SendErrorJSON(w, r, "Invalid or revoked API token")
+			return
+		}
+		if err != nil {
+			utils.SendErrorJSON(w, r, "Unknown error")
+			log.Printf("DB error (api token): %v\n", err)
+			return
+		}
+
+		handle(w, r.WithContext(context.WithValue(r.Context(), tokenContextKey{}, token)), params)
+	}
+}
@@ -0,0 +1,119 @@
+package database
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"radio/utils"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestRequireToken(t *testing.T) {
+	SetStore(NewMemoryStore())
+	token, err := AddAPIToken("dj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, err := AddAPIToken("former dj")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := RevokeAPIToken(2); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		// the name of the token the handler sees, empty if it mustn't run
+		want    string
+		wantMsg string
+	}{
+		{"no header", "", "", "This endpoint needs an API token"},
+		{"not a bearer token", "Basic " + token, "", "This endpoint needs an API token"},
+		{"unknown token", "Bearer nope", "", "Invalid or revoked API token"},
+		{"revoked token", "Bearer " + revoked, "", "Invalid or revoked API token"},
+		{"valid token", "Bearer " + token, "dj", ""},
+		{"surrounding spaces", "Bearer  " + token + " ", "dj", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handle := RequireToken(func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+				got = RequestToken(r).Name
+			})
+
+			r := httptest.NewRequest(http.MethodGet, "/gettrash", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			handle(w, r, nil)
+
+			if got != tt.want {
+				t.Errorf("handler saw token %q, want %q", got, tt.want)
+			}
+			if tt.wantMsg == "" {
+				return
+			}
+			var response utils.JsonResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("response %q isn't JSON: %v", w.Body.String(), err)
+			}
+			if !response.Err || response.Message != tt.wantMsg {
+				t.Errorf("response = %+v, want error %q", response, tt.wantMsg)
+			}
+		})
+	}
+}
+
+// the steps run in order against one store
+func TestMemoryAPITokens(t *testing.T) {
+	s := NewMemoryStore()
+	for _, name := range []string{"a", "b"} {
+		if _, err := s.AddAPIToken(name, hashToken(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		// token to revoke first, 0 for none
+		revoke        int
+		wantRevokeErr error
+		hash          string
+		// id of the token found by hash, 0 for none
+		want int
+	}{
+		{"found", 0, nil, hashToken("b"), 2},
+		{"unknown", 0, nil, hashToken("c"), 0},
+		{"revoked", 1, nil, hashToken("a"), 0},
+		{"revoked twice", 1, ErrNotFound, hashToken("a"), 0},
+		{"unknown id", 3, ErrNotFound, hashToken("b"), 2},
+	}
+
+	for _, tt := range tests {
+		if tt.revoke != 0 {
+			if err := s.RevokeAPIToken(tt.revoke); err != tt.wantRevokeErr {
+				t.Errorf("%s: RevokeAPIToken error = %v, want %v", tt.name, err, tt.wantRevokeErr)
+			}
+		}
+		token, err := s.APITokenByHash(tt.hash)
+		if tt.want == 0 {
+			if err != ErrNotFound {
+				t.Errorf("%s: APITokenByHash error = %v, want %v", tt.name, err, ErrNotFound)
+			}
+		} else if err != nil || token.Id != tt.want {
+			t.Errorf("%s: APITokenByHash = %+v, %v, want token %d", tt.name, token, err, tt.want)
+		}
+	}
+
+	// revoked tokens stay listed
+	if tokens, _ := s.APITokens(); len(tokens) != 2 || tokens[0].RevokedAt == nil {
+		t.Errorf("APITokens = %+v, want both tokens, the first revoked", tokens)
+	}
+}
@@ -2,74 +2,38 @@
 package database
 
 import (
-	"database/sql"
-	"encoding/base64"
-	"encoding/json"
+	"errors"
 	"log"
 
 	"math/rand"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
-
-	_ "embed"
-
-	_ "github.com/go-sql-driver/mysql"
 )
 
-// db connection
-var db *sql.DB
-
-func Init() {
-	log.Println("Initializing MySQL")
-
-	var err error
-	db, err = sql.Open("mysql", "root:kopytko@/radio?parseTime=true")
-	if err != nil {
-		log.Fatalf("Couldn't open database connection: %v\n", err)
-	}
-
-	err = db.Ping()
-	if err != nil {
-		log.Fatalf("Couldn't ping database connection: %v\n", err)
-	}
-
-	db.SetConnMaxLifetime(0)
-	db.SetMaxOpenConns(50)
-	db.SetMaxIdleConns(50)
-
-	// populate defaults if they don't exist already
-	if _, err := db.Exec(SchemaPlaylists); err != nil {
-		log.Fatalf("Couldn't prepare playlist table: %v\n", err)
-	}
-
-	if _, err := db.Exec(SchemaPlaylistEntries); err != nil {
-		log.Fatalf("Couldn't prepare playlist entries table: %v\n", err)
-	}
-
-	if _, err := db.Exec(SchemaSongs); err != nil {
-		log.Fatalf("Couldn't prepare songs table: %v\n", err)
-	}
-
-	if _, err := db.Exec(SchemaVotes); err != nil {
-		log.Fatalf("Couldn't prepare votes table: %v\n", err)
-	}
-
-	if _, err := db.Exec(SchemaSchedule); err != nil {
-		log.Fatalf("Couldn't prepare schedule table: %v\n", err)
-	}
-}
-
 // playlist object data
 type Playlist struct {
 	Id   int    `json:"id"`
 	Name string `json:"title"`
 	Desc string `json:"description"`
 	// the higher the rank, the earlier the playlist will show on playlist index
-	Rank      int       `json:"rank"`
+	Rank int `json:"rank"`
+	// PlaybackShuffle or PlaybackOrdered
+	Mode      string    `json:"mode"`
 	DebutDate time.Time `json:"debut_date"`
+	// set while the playlist is in the trash
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
 
+// how the queue of a playlist is put together
+const (
+	// vote-weighted random picks
+	PlaybackShuffle = "shuffle"
+	// the running order of the entries
+	PlaybackOrdered = "ordered"
+)
+
 // PlaylistArray to sort by rank
 type PlaylistArray []Playlist
 
@@ -94,23 +58,61 @@ type SongData struct {
 	Length      int       `json:"length"`
 	ReleaseDate time.Time `json:"release_date"`
 	DebutedAt   time.Time `json:"debuted_at"`
+	// set while the song is in the trash
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+
+	// 0 if unknown
+	BPM int `json:"bpm"`
+	// ISO 639 code, empty if unknown
+	Language string   `json:"language"`
+	Explicit bool     `json:"explicit"`
+	ISRC     string   `json:"isrc"`
+	Genres   []string `json:"genres"`
+	Tags     []string `json:"tags"`
+
+	// nil until the song has been analysed
+	Loudness *Loudness `json:"loudness,omitempty"`
+	// nil until the song has been analysed or cued by hand
+	Cues *Cues `json:"cues,omitempty"`
+}
+
+// measured from the decoded audio as in EBU R128
+type Loudness struct {
+	// integrated loudness in LUFS
+	Integrated float64 `json:"integrated_lufs"`
+	// in dBTP
+	TruePeak float64 `json:"true_peak_dbtp"`
+}
+
+// positions in the audio in milliseconds
+type Cues struct {
+	// where playback starts, past any leading silence
+	CueIn int `json:"cue_in"`
+	// where the intro ends, 0 if there's none
+	IntroEnd int `json:"intro_end"`
+	// where the transition to the next song begins, 0 to leave it to the crossfader
+	OutroStart int `json:"outro_start"`
+	// where playback ends, before any trailing silence
+	CueOut int `json:"cue_out"`
 }
 
 // delegated to a method, because vote count is dynamic
 func (song *SongData) VoteCount() int {
-	// substract negative votes from positive ones to get the total value
-	// 1 - positive; 0 - negative
-	return len(GetValidVotesForSong(strconv.Itoa(song.SongId), 1)) - len(GetValidVotesForSong(strconv.Itoa(song.SongId), 0))
+	// positive votes minus negative ones, served from the tally cache
+	return VoteScores()[song.SongId]
 }
 
 // playlist entry from db
 type PlaylistEntry struct {
-	playlistId int       `json:"playlist_id"`
-	songId     int       `json:"song_id"`
-	DebutDate  time.Time `json:"debut_date"`
+	PlaylistId int `json:"playlist_id"`
+	SongId     int `json:"song_id"`
+	// 1-based place in the running order
+	Position  int       `json:"position"`
+	DebutDate time.Time `json:"debut_date"`
 
-	// this isn't stored in db; it's for easy access
-	Song SongData `json:"song_data"`
+	// these aren't stored in db; they're for easy access
+	Song  SongData `json:"song_data"`
+	Votes int      `json:"votes"`
 }
 
 type PlaylistEntryArray []PlaylistEntry
@@ -120,7 +122,7 @@ func (e PlaylistEntryArray) Len() int {
 }
 
 func (e PlaylistEntryArray) Less(i, j int) bool {
-	return e[i].Song.VoteCount() > e[j].Song.VoteCount()
+	return e[i].Votes > e[j].Votes
 }
 
 func (e PlaylistEntryArray) Swap(i, j int) {
@@ -137,20 +139,9 @@ type Vote struct {
 }
 
 func GetPlaylistsArray() ([]Playlist, error) {
-	results, err := db.Query(GetPlaylistListQuery)
+	playlists, err := store.Playlists()
 	if err != nil {
-		return nil, err
-	}
-
-	var playlists []Playlist
-	for results.Next() {
-		var playlist Playlist
-
-		err = results.Scan(&playlist.Id, &playlist.Name, &playlist.Desc, &playlist.Rank, &playlist.DebutDate)
-		if err != nil {
-			return playlists, err
-		}
-		playlists = append(playlists, playlist)
+		return playlists, err
 	}
 
 	sort.Sort(PlaylistArray(playlists))
@@ -169,86 +160,202 @@ func GetPlaylistData(playlistid string) *Playlist {
 	return nil
 }
 
+// returns the entries with their current vote scores filled in
 func GetPlaylistEntries(playlistid string) ([]PlaylistEntry, error) {
-
-	results, err := db.Query(GetPlaylistSongsQuery, playlistid)
+	entries, err := store.PlaylistEntries(playlistid)
 	if err != nil {
-		return nil, err
+		return entries, err
 	}
 
-	var playlistEntries []PlaylistEntry
-	for results.Next() {
-		var playlistEntry PlaylistEntry
+	scores := VoteScores()
+	for i := range entries {
+		entries[i].Votes = scores[entries[i].SongId]
+	}
+	return entries, nil
+}
 
-		err = results.Scan(&playlistEntry.playlistId, &playlistEntry.songId, &playlistEntry.DebutDate)
+func AddPlaylist(title, desc string, rank int) error {
+	defer invalidateSearch()
+	_, err := store.AddPlaylist(Playlist{Name: title, Desc: desc, Rank: rank, Mode: PlaybackShuffle})
+	return err
+}
+
+func DelPlaylist(id string) error {
+	defer invalidateSearch()
+	if err := store.DelPlaylist(id); err != nil {
+		return err
+	}
+	OnPlaylistChange(id)
+	return nil
+}
+
+// called after the entries or the playback mode of a playlist have changed;
+// set by the playback package to keep its queues in step
+var OnPlaylistChange = func(playlistid string) {}
+
+func SetPlaylistMode(playlistid, mode string) error {
+	if mode != PlaybackShuffle && mode != PlaybackOrdered {
+		return errors.New("playback mode must be shuffle or ordered")
+	}
+	if GetPlaylistData(playlistid) == nil {
+		return ErrNotFound
+	}
+	if err := store.SetPlaylistMode(playlistid, mode); err != nil {
+		return err
+	}
+	OnPlaylistChange(playlistid)
+	return nil
+}
+
+// appends the song to the end of the playlist
+func AddSongToPlaylist(playlistid, songid string) error {
+	if err := store.AddSongToPlaylist(playlistid, songid, 0); err != nil {
+		return err
+	}
+	OnPlaylistChange(playlistid)
+	return nil
+}
+
+// puts the song at a 1-based position, moving the entries from there on down
+func InsertSongIntoPlaylist(playlistid, songid string, position int) error {
+	if position < 1 {
+		return errors.New("position must be 1 or more")
+	}
+	if err := store.AddSongToPlaylist(playlistid, songid, position); err != nil {
+		return err
+	}
+	OnPlaylistChange(playlistid)
+	return nil
+}
+
+// reads a comma separated list of positions, e.g. 3,1,2
+func ParsePositions(list string) ([]int, error) {
+	var positions []int
+	for _, field := range strings.Split(list, ",") {
+		position, err := strconv.Atoi(strings.TrimSpace(field))
 		if err != nil {
-			return playlistEntries, err
+			return nil, errors.New("positions must be numbers separated by commas")
 		}
-		err2 := db.QueryRow(GetSongQuery, playlistEntry.songId).Scan(&playlistEntry.Song.SongId, &playlistEntry.Song.Authors, &playlistEntry.Song.Title, &playlistEntry.Song.YTId, &playlistEntry.Song.Length, &playlistEntry.Song.ReleaseDate, &playlistEntry.Song.DebutedAt)
-		if err2 != nil {
-			return playlistEntries, err2
+		positions = append(positions, position)
+	}
+	return positions, nil
+}
+
+// sets a new running order; order must list every position of the playlist once
+func ReorderPlaylist(playlistid string, order []int) error {
+	entries, err := store.PlaylistEntries(playlistid)
+	if err != nil {
+		return err
+	}
+	if len(order) != len(entries) {
+		return errors.New("the new order must list all " + strconv.Itoa(len(entries)) + " positions of the playlist")
+	}
+
+	listed := map[int]bool{}
+	for _, entry := range entries {
+		listed[entry.Position] = true
+	}
+	for _, position := range order {
+		if !listed[position] {
+			return errors.New("position " + strconv.Itoa(position) + " isn't in the playlist or is listed twice")
 		}
+		delete(listed, position)
+	}
+	if err := store.ReorderPlaylist(playlistid, order); err != nil {
+		return err
+	}
+	OnPlaylistChange(playlistid)
+	return nil
+}
+
+// moves the entry at position from to the place of the one at position to
+func MovePlaylistEntry(playlistid string, from, to int) error {
+	entries, err := store.PlaylistEntries(playlistid)
+	if err != nil {
+		return err
+	}
 
-		playlistEntries = append(playlistEntries, playlistEntry)
+	fromIndex, toIndex := -1, -1
+	var order []int
+	for i, entry := range entries {
+		if entry.Position == from {
+			fromIndex = i
+		}
+		if entry.Position == to {
+			toIndex = i
+		}
+		order = append(order, entry.Position)
+	}
+	if fromIndex < 0 || toIndex < 0 {
+		return ErrNotFound
 	}
 
-	return playlistEntries, nil
+	order = append(order[:fromIndex], order[fromIndex+1:]...)
+	order = append(order[:toIndex], append([]int{from}, order[toIndex:]...)...)
+	if err := store.ReorderPlaylist(playlistid, order); err != nil {
+		return err
+	}
+	OnPlaylistChange(playlistid)
+	return nil
 }
 
-func AddPlaylist(title, desc string, rank int) error {
-	_, err := db.Exec(AddPlaylistCmd, title, desc, rank)
-	return err
+func DelSongFromPlaylist(playlistid, songid string) error {
+	if err := store.DelSongFromPlaylist(playlistid, songid); err != nil {
+		return err
+	}
+	OnPlaylistChange(playlistid)
+	return nil
 }
 
-func DelPlaylist(id string) error {
-	_, err := db.Exec(DelPlaylistCmd, id)
-	return err
+// returns the id of the new song
+func AddSong(song SongData) (int, error) {
+	if err := song.Validate(); err != nil {
+		return 0, err
+	}
+	defer invalidateSearch()
+	return store.AddSong(song)
 }
 
-func AddSongToPlaylist(playlistid, songid string) error {
-	_, err := db.Exec(AddSongToPlaylistCmd, playlistid, songid)
-	return err
+// overwrites the stored data of song.SongId
+func UpdateSong(song SongData) error {
+	if err := song.Validate(); err != nil {
+		return err
+	}
+	defer invalidateSearch()
+	return store.UpdateSong(song)
 }
 
-func DelSongFromPlaylist(playlistid, songid string) error {
-	_, err := db.Exec(DelSongFromPlaylistCmd, playlistid, songid)
-	return err
+func SetSongLoudness(songid int, loudness Loudness) error {
+	defer invalidateSearch()
+	return store.SetSongLoudness(songid, loudness)
 }
 
-func AddSong(song SongData) error {
-	_, err := db.Exec(AddSongCmd, song.Authors, song.Title, song.YTId, song.Length, song.ReleaseDate)
-	return err
+func SetSongCues(songid int, cues Cues) error {
+	if err := cues.Validate(); err != nil {
+		return err
+	}
+	defer invalidateSearch()
+	return store.SetSongCues(songid, cues)
 }
 
 func DelSong(songid string) error {
-	_, err := db.Exec(DelSongCmd, songid)
+	err := store.DelSong(songid)
+	// trashed songs take their votes with them
+	tallies.invalidate()
+	invalidateSearch()
 	return err
 }
 
 func GetSongArray() []SongData {
-	rows, err := db.Query(GetSongsQuery)
+	songs, err := store.Songs()
 	if err != nil {
 		return []SongData{}
 	}
-
-	var songs []SongData
-	for rows.Next() {
-		var song SongData
-
-		err := rows.Scan(&song.SongId, &song.Authors, &song.Title, &song.YTId, &song.Length, &song.ReleaseDate, &song.DebutedAt)
-		if err != nil {
-			return []SongData{}
-		}
-
-		songs = append(songs, song)
-	}
 	return songs
 }
 
 func GetSongData(songid string) *SongData {
-	song := &SongData{}
-	err := db.QueryRow(GetSongQuery, songid).
-		Scan(&song.SongId, &song.Authors, &song.Title, &song.YTId, &song.Length, &song.ReleaseDate, &song.DebutedAt)
+	song, err := store.Song(songid)
 	if err != nil {
 		log.Printf("DB error (song data): %v\n", err)
 		return nil
@@ -258,22 +365,11 @@ func GetSongData(songid string) *SongData {
 }
 
 func GetValidVotesForSong(songid string, votetype int) []Vote {
-	results, err := db.Query(GetVotesQuery, songid, votetype)
+	start, end := CurrentWeek()
+	votes, err := store.Votes(songid, votetype, start, end)
 	if err != nil {
 		return []Vote{}
 	}
-
-	var votes []Vote
-	for results.Next() {
-		var vote Vote
-
-		err = results.Scan(&vote.Student, &vote.VoteType, &vote.Song, &vote.SubmitDate)
-		if err != nil {
-			return []Vote{}
-		}
-		votes = append(votes, vote)
-	}
-
 	return votes
 }
 
@@ -318,31 +414,93 @@ type PlanBlock struct {
 // a schedule consists of planblocks
 type Schedule []PlanBlock
 
-func GetScheduleFor(date_at string) Schedule {
-	var raw string
-	var schedule Schedule
+// names under which the broadcast types are stored
+const (
+	BlockPlaylist = "playlist"
+	BlockSilence  = "silence"
+	BlockFile     = "file"
+)
 
-	//log.Println(date_at)
-	err := db.QueryRow(GetScheduleQuery, date_at).Scan(&raw)
-	if err == sql.ErrNoRows {
-		return nil
+// returns the name of the active broadcast type
+func (plan PlanBlock) TypeName() string {
+	if plan.Type.Playlist.Active {
+		return BlockPlaylist
+	} else if plan.Type.File.Active {
+		return BlockFile
 	}
-	if err != nil {
-		log.Println(err)
-		return nil
+	return BlockSilence
+}
+
+// builds a planblock with only the named broadcast type active
+func NewPlanBlock(typename string, start, end time.Time, playlistid string, locations []string) PlanBlock {
+	plan := PlanBlock{Range: Range{Start: start, End: end}}
+	switch typename {
+	case BlockPlaylist:
+		plan.Type.Playlist = PlaylistBroadcastType{BroadcastType: BroadcastType{Active: true}, PlaylistId: playlistid}
+	case BlockFile:
+		plan.Type.File = FileBroadcastType{BroadcastType: BroadcastType{Active: true}, Location: locations}
+	default:
+		plan.Type.Silence = SilenceBroadcastType{BroadcastType: BroadcastType{Active: true}}
 	}
-	rawdecode, _ := base64.StdEncoding.DecodeString(raw)
-	//log.Println(string(rawdecode))
+	return plan
+}
+
+// planblock together with the day it was planned for
+type ScheduledBlock struct {
+	Date string `json:"date"`
+	PlanBlock
+}
 
-	err2 := json.Unmarshal(rawdecode, &schedule)
-	if err2 != nil {
-		log.Println(err2)
+// filter for ScheduleBlocks; zero values match everything
+type ScheduleQuery struct {
+	// blocks which end before From or start after To are left out
+	From time.Time
+	To   time.Time
+	// only playlist blocks playing this playlist
+	PlaylistId string
+}
+
+// returns the blocks matching the query, ordered by start
+func ScheduleBlocks(q ScheduleQuery) ([]ScheduledBlock, error) {
+	return store.ScheduleBlocks(q)
+}
+
+// returns the block on air at the given moment, or nil if nothing is planned
+func ScheduleBlockAt(t time.Time) (*ScheduledBlock, error) {
+	blocks, err := store.ScheduleBlocks(ScheduleQuery{From: t, To: t})
+	if err != nil || len(blocks) == 0 {
+		return nil, err
+	}
+	return &blocks[0], nil
+}
+
+func GetScheduleFor(date_at string) Schedule {
+	schedule, err := store.Schedule(date_at)
+	if err != nil {
+		log.Println(err)
 		return nil
 	}
 	return schedule
 }
 
+// plans two blocks of the first playlists for the coming minutes on a fresh install;
+// once anything has been scheduled, the schedule is left alone
 func CreateSampleSchedule() {
+	blocks, err := store.ScheduleBlocks(ScheduleQuery{})
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	playlists, err := store.Playlists()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if len(blocks) > 0 || len(playlists) == 0 {
+		return
+	}
+	first := strconv.Itoa(playlists[0].Id)
+	second := strconv.Itoa(playlists[len(playlists)-1].Id)
 
 	start := time.Now()
 	end := start.Add(time.Minute * 3)
@@ -359,9 +517,9 @@ func CreateSampleSchedule() {
 	plan2.Range.Start = start
 	plan2.Range.End = end
 
-	pbti := PlaylistBroadcastType{BroadcastType: BroadcastType{Active: true}, PlaylistId: "3"}
+	pbti := PlaylistBroadcastType{BroadcastType: BroadcastType{Active: true}, PlaylistId: first}
 	plan1.Type.Playlist = pbti
-	pbti1 := PlaylistBroadcastType{BroadcastType: BroadcastType{Active: true}, PlaylistId: "2"}
+	pbti1 := PlaylistBroadcastType{BroadcastType: BroadcastType{Active: true}, PlaylistId: second}
 	plan2.Type.Playlist = pbti1
 
 	schedule = append(schedule, plan1)
@@ -372,29 +530,31 @@ func CreateSampleSchedule() {
 }
 
 func UpdateSchedule(date string, schedule Schedule) {
-	jnoindent, _ := json.Marshal(schedule)
-
-	dbschedule := GetScheduleFor(date)
-
-	if dbschedule == nil {
-		_, err := db.Exec(AddScheduleCmd, date, base64.StdEncoding.EncodeToString(jnoindent))
-		if err != nil {
-			log.Println(err)
-		}
-	} else {
-		_, err := db.Exec(SetScheduleCmd, base64.StdEncoding.EncodeToString(jnoindent), date)
-		if err != nil {
-			log.Println(err)
-		}
+	if err := store.SetSchedule(date, schedule); err != nil {
+		log.Println(err)
 	}
 }
 
 // returns an array of songids
 func CreateQueue(playlistid string) []int {
+	// missing and trashed playlists have nothing to play
+	playlist := GetPlaylistData(playlistid)
+	if playlist == nil {
+		return nil
+	}
 	entries, err := GetPlaylistEntries(playlistid)
 	if err != nil {
 		return nil
 	}
+
+	if playlist.Mode == PlaybackOrdered {
+		var queue []int
+		for _, entry := range entries {
+			queue = append(queue, entry.SongId)
+		}
+		return queue
+	}
+
 	sort.Sort(PlaylistEntryArray(entries))
 
 	pos := 0
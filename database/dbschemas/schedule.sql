@@ -1,6 +0,0 @@
-CREATE TABLE IF NOT EXISTS schedule (
-	date_at DATE NOT NULL PRIMARY KEY,
-	content TEXT NOT NULL,
-
-	submitted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
-);
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"errors"
+	"strconv"
+)
+
+var ErrSelfMerge = errors.New("a song can't be merged into itself")
+
+// what duplicate detection keeps about the audio file of a song
+type Fingerprint struct {
+	SongId int
+	// sha256 of the file, hex encoded
+	ContentHash string
+	// acoustic fingerprint of the decoded audio, see library/fingerprint.go
+	Data []byte
+}
+
+func GetFingerprints() ([]Fingerprint, error) {
+	return store.Fingerprints()
+}
+
+func SetFingerprint(fingerprint Fingerprint) error {
+	return store.SetFingerprint(fingerprint)
+}
+
+// merges duplicate into keep: its playlist entries and votes move over
+// and it goes to the trash, from where it can still be restored
+func MergeSongs(keep, duplicate int) error {
+	if keep == duplicate {
+		return ErrSelfMerge
+	}
+	playlists, err := store.MergeSongs(keep, duplicate)
+	if err != nil {
+		return err
+	}
+	tallies.invalidate()
+	invalidateSearch()
+	for _, playlistid := range playlists {
+		OnPlaylistChange(strconv.Itoa(playlistid))
+	}
+	return nil
+}
+
+type studentWeek struct {
+	student string
+	week    int64
+}
+
+// returns the votes for the duplicate by students who voted for the kept song
+// in the same week; a merge drops them, so nobody votes twice for one song in a week
+func clashingVotes(kept, duplicate []Vote) []Vote {
+	voted := map[studentWeek]bool{}
+	for _, vote := range kept {
+		start, _ := WeekBounds(vote.SubmitDate)
+		voted[studentWeek{vote.Student, start.Unix()}] = true
+	}
+
+	var clashing []Vote
+	for _, vote := range duplicate {
+		start, _ := WeekBounds(vote.SubmitDate)
+		if voted[studentWeek{vote.Student, start.Unix()}] {
+			clashing = append(clashing, vote)
+		}
+	}
+	return clashing
+}
@@ -0,0 +1,60 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestClashingVotes(t *testing.T) {
+	monday := time.Date(2026, 10, 12, 10, 0, 0, 0, time.UTC)
+	vote := func(student string, song int, at time.Time) Vote {
+		return Vote{Student: student, Song: song, VoteType: 1, SubmitDate: at}
+	}
+
+	tests := []struct {
+		name      string
+		kept      []Vote
+		duplicate []Vote
+		want      []Vote
+	}{
+		{
+			name:      "no votes for the kept song",
+			duplicate: []Vote{vote("a", 2, monday)},
+		},
+		{
+			name:      "same student, same week",
+			kept:      []Vote{vote("a", 1, monday)},
+			duplicate: []Vote{vote("a", 2, monday.AddDate(0, 0, 6))},
+			want:      []Vote{vote("a", 2, monday.AddDate(0, 0, 6))},
+		},
+		{
+			name:      "same student, next week",
+			kept:      []Vote{vote("a", 1, monday)},
+			duplicate: []Vote{vote("a", 2, monday.AddDate(0, 0, 7))},
+		},
+		{
+			name:      "other student",
+			kept:      []Vote{vote("a", 1, monday)},
+			duplicate: []Vote{vote("b", 2, monday)},
+		},
+		{
+			name: "only the clashing ones",
+			kept: []Vote{vote("a", 1, monday), vote("b", 1, monday.AddDate(0, 0, -7))},
+			duplicate: []Vote{
+				vote("a", 2, monday.Add(time.Hour)),
+				vote("b", 2, monday),
+				vote("b", 2, monday.AddDate(0, 0, -5)),
+			},
+			want: []Vote{vote("a", 2, monday.Add(time.Hour)), vote("b", 2, monday.AddDate(0, 0, -5))},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := clashingVotes(tt.kept, tt.duplicate); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("clashingVotes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
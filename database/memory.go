@@ -0,0 +1,991 @@
+package database
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// memoryStore keeps everything in process memory. Nothing survives a restart,
+// which makes it suitable for running the station without a MySQL server.
+type memoryStore struct {
+	mutex sync.RWMutex
+
+	nextSongId     int
+	nextPlaylistId int
+
+	songs     map[int]SongData
+	playlists map[int]Playlist
+	entries   []PlaylistEntry
+	votes     []Vote
+	schedules map[string]Schedule
+	periods   []VotingPeriod
+	// archived charts by period id
+	results map[int][]ChartPosition
+	tokens  []APIToken
+	// token hash by token id
+	tokenHashes map[int]string
+	// by song id
+	fingerprints map[int]Fingerprint
+}
+
+func NewMemoryStore() Store {
+	return &memoryStore{
+		nextSongId:     1,
+		nextPlaylistId: 1,
+		songs:          make(map[int]SongData),
+		playlists:      make(map[int]Playlist),
+		schedules:      make(map[string]Schedule),
+		results:        make(map[int][]ChartPosition),
+		tokenHashes:    make(map[int]string),
+		fingerprints:   make(map[int]Fingerprint),
+	}
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
+
+func (s *memoryStore) Playlists() ([]Playlist, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var playlists []Playlist
+	for _, playlist := range s.playlists {
+		if playlist.DeletedAt == nil {
+			playlists = append(playlists, playlist)
+		}
+	}
+	sort.Slice(playlists, func(i, j int) bool {
+		return playlists[i].Id < playlists[j].Id
+	})
+	return playlists, nil
+}
+
+func (s *memoryStore) AddPlaylist(playlist Playlist) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.addPlaylist(playlist)
+}
+
+func (s *memoryStore) addPlaylist(playlist Playlist) (int, error) {
+	if playlist.Id == 0 {
+		playlist.Id = s.nextPlaylistId
+	} else if _, ok := s.playlists[playlist.Id]; ok {
+		return 0, errors.New("playlist id " + strconv.Itoa(playlist.Id) + " is taken")
+	}
+	if playlist.Mode == "" {
+		playlist.Mode = PlaybackShuffle
+	}
+	playlist.DebutDate = time.Now()
+	playlist.DeletedAt = nil
+	s.playlists[playlist.Id] = playlist
+	if playlist.Id >= s.nextPlaylistId {
+		s.nextPlaylistId = playlist.Id + 1
+	}
+	return playlist.Id, nil
+}
+
+func (s *memoryStore) DelPlaylist(playlistid string) error {
+	id, err := strconv.Atoi(playlistid)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	playlist, ok := s.playlists[id]
+	if !ok || playlist.DeletedAt != nil {
+		return ErrNotFound
+	}
+	now := time.Now()
+	playlist.DeletedAt = &now
+	s.playlists[id] = playlist
+	return nil
+}
+
+func (s *memoryStore) PlaylistEntries(playlistid string) ([]PlaylistEntry, error) {
+	id, err := strconv.Atoi(playlistid)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var playlistEntries []PlaylistEntry
+	for _, entry := range s.entries {
+		if entry.PlaylistId != id {
+			continue
+		}
+		song, ok := s.songs[entry.SongId]
+		if !ok || song.DeletedAt != nil {
+			continue
+		}
+		entry.Song = song
+		playlistEntries = append(playlistEntries, entry)
+	}
+	sort.SliceStable(playlistEntries, func(i, j int) bool {
+		return playlistEntries[i].Position < playlistEntries[j].Position
+	})
+	return playlistEntries, nil
+}
+
+func (s *memoryStore) SetPlaylistMode(playlistid, mode string) error {
+	id, err := strconv.Atoi(playlistid)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	playlist, ok := s.playlists[id]
+	if !ok || playlist.DeletedAt != nil {
+		return ErrNotFound
+	}
+	playlist.Mode = mode
+	s.playlists[id] = playlist
+	return nil
+}
+
+func (s *memoryStore) AddSongToPlaylist(playlistid, songid string, position int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.addSongToPlaylist(playlistid, songid, position)
+}
+
+func (s *memoryStore) addSongToPlaylist(playlistid, songid string, position int) error {
+	plid, err := strconv.Atoi(playlistid)
+	if err != nil {
+		return err
+	}
+	sid, err := strconv.Atoi(songid)
+	if err != nil {
+		return err
+	}
+
+	if playlist, ok := s.playlists[plid]; !ok || playlist.DeletedAt != nil {
+		return ErrNotFound
+	}
+	if song, ok := s.songs[sid]; !ok || song.DeletedAt != nil {
+		return ErrNotFound
+	}
+
+	last := 0
+	for _, entry := range s.entries {
+		if entry.PlaylistId == plid && entry.Position > last {
+			last = entry.Position
+		}
+	}
+	if position <= 0 || position > last {
+		position = last + 1
+	} else {
+		for i := range s.entries {
+			if s.entries[i].PlaylistId == plid && s.entries[i].Position >= position {
+				s.entries[i].Position++
+			}
+		}
+	}
+
+	s.entries = append(s.entries, PlaylistEntry{
+		PlaylistId: plid,
+		SongId:     sid,
+		Position:   position,
+		DebutDate:  time.Now(),
+	})
+	return nil
+}
+
+func (s *memoryStore) DelSongFromPlaylist(playlistid, songid string) error {
+	plid, err := strconv.Atoi(playlistid)
+	if err != nil {
+		return err
+	}
+	sid, err := strconv.Atoi(songid)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.entries = filterEntries(s.entries, func(entry PlaylistEntry) bool {
+		return entry.PlaylistId != plid || entry.SongId != sid
+	})
+	return s.reorderEntries(plid, nil)
+}
+
+func (s *memoryStore) ReorderPlaylist(playlistid string, order []int) error {
+	id, err := strconv.Atoi(playlistid)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.reorderEntries(id, order)
+}
+
+// numbers the entries of a playlist from 1, putting the listed positions first;
+// the caller holds the write lock
+func (s *memoryStore) reorderEntries(playlistid int, order []int) error {
+	// indexes into s.entries, in the current running order
+	var indexes []int
+	byPosition := map[int]int{}
+	for i, entry := range s.entries {
+		if entry.PlaylistId == playlistid {
+			indexes = append(indexes, i)
+			byPosition[entry.Position] = i
+		}
+	}
+	sort.SliceStable(indexes, func(i, j int) bool {
+		return s.entries[indexes[i]].Position < s.entries[indexes[j]].Position
+	})
+
+	placed := map[int]bool{}
+	var ordered []int
+	for _, position := range order {
+		i, ok := byPosition[position]
+		if !ok || placed[i] {
+			return ErrNotFound
+		}
+		placed[i] = true
+		ordered = append(ordered, i)
+	}
+	for _, i := range indexes {
+		if !placed[i] {
+			ordered = append(ordered, i)
+		}
+	}
+
+	for position, i := range ordered {
+		s.entries[i].Position = position + 1
+	}
+	return nil
+}
+
+func (s *memoryStore) Songs() ([]SongData, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var songs []SongData
+	for _, song := range s.songs {
+		if song.DeletedAt == nil {
+			songs = append(songs, song)
+		}
+	}
+	sort.Slice(songs, func(i, j int) bool {
+		return songs[i].SongId < songs[j].SongId
+	})
+	return songs, nil
+}
+
+func (s *memoryStore) Song(songid string) (*SongData, error) {
+	id, err := strconv.Atoi(songid)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	song, ok := s.songs[id]
+	if !ok || song.DeletedAt != nil {
+		return nil, ErrNotFound
+	}
+	return &song, nil
+}
+
+func (s *memoryStore) AddSong(song SongData) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.addSong(song)
+}
+
+func (s *memoryStore) addSong(song SongData) (int, error) {
+	if song.SongId == 0 {
+		song.SongId = s.nextSongId
+	} else if _, ok := s.songs[song.SongId]; ok {
+		return 0, errors.New("song id " + strconv.Itoa(song.SongId) + " is taken")
+	}
+	song.DebutedAt = time.Now()
+	song.DeletedAt = nil
+	s.songs[song.SongId] = song
+	if song.SongId >= s.nextSongId {
+		s.nextSongId = song.SongId + 1
+	}
+	return song.SongId, nil
+}
+
+func (s *memoryStore) UpdateSong(song SongData) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	stored, ok := s.songs[song.SongId]
+	if !ok || stored.DeletedAt != nil {
+		return ErrNotFound
+	}
+	song.DebutedAt = stored.DebutedAt
+	song.DeletedAt = nil
+	song.Loudness = stored.Loudness
+	song.Cues = stored.Cues
+	s.songs[song.SongId] = song
+	return nil
+}
+
+func (s *memoryStore) SetSongLoudness(songid int, loudness Loudness) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	song, ok := s.songs[songid]
+	if !ok || song.DeletedAt != nil {
+		return ErrNotFound
+	}
+	song.Loudness = &loudness
+	s.songs[songid] = song
+	return nil
+}
+
+func (s *memoryStore) SetSongCues(songid int, cues Cues) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	song, ok := s.songs[songid]
+	if !ok || song.DeletedAt != nil {
+		return ErrNotFound
+	}
+	song.Cues = &cues
+	s.songs[songid] = song
+	return nil
+}
+
+func (s *memoryStore) DelSong(songid string) error {
+	id, err := strconv.Atoi(songid)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	song, ok := s.songs[id]
+	if !ok || song.DeletedAt != nil {
+		return ErrNotFound
+	}
+	now := time.Now()
+	song.DeletedAt = &now
+	s.songs[id] = song
+	return nil
+}
+
+func (s *memoryStore) MergeSongs(keep, duplicate int) ([]int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, id := range []int{keep, duplicate} {
+		if song, ok := s.songs[id]; !ok || song.DeletedAt != nil {
+			return nil, ErrNotFound
+		}
+	}
+
+	holdsKept := map[int]bool{}
+	holdsDuplicate := map[int]bool{}
+	for _, entry := range s.entries {
+		if entry.SongId == keep {
+			holdsKept[entry.PlaylistId] = true
+		} else if entry.SongId == duplicate {
+			holdsDuplicate[entry.PlaylistId] = true
+		}
+	}
+	// playlists which hold both songs keep only the entries of the kept one
+	s.entries = filterEntries(s.entries, func(entry PlaylistEntry) bool {
+		return entry.SongId != duplicate || !holdsKept[entry.PlaylistId]
+	})
+	for i := range s.entries {
+		if s.entries[i].SongId == duplicate {
+			s.entries[i].SongId = keep
+		}
+	}
+	var playlists []int
+	for playlistid := range holdsDuplicate {
+		if err := s.reorderEntries(playlistid, nil); err != nil {
+			return nil, err
+		}
+		playlists = append(playlists, playlistid)
+	}
+	sort.Ints(playlists)
+
+	var kept, duplicates []Vote
+	for _, vote := range s.votes {
+		if vote.Song == keep {
+			kept = append(kept, vote)
+		} else if vote.Song == duplicate {
+			duplicates = append(duplicates, vote)
+		}
+	}
+	clashing := clashingVotes(kept, duplicates)
+	var votes []Vote
+	for _, vote := range s.votes {
+		if vote.Song == duplicate {
+			if containsVote(clashing, vote) {
+				continue
+			}
+			vote.Song = keep
+		}
+		votes = append(votes, vote)
+	}
+	s.votes = votes
+
+	song := s.songs[duplicate]
+	now := time.Now()
+	song.DeletedAt = &now
+	s.songs[duplicate] = song
+	return playlists, nil
+}
+
+func (s *memoryStore) TrashedSongs() ([]SongData, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var songs []SongData
+	for _, song := range s.songs {
+		if song.DeletedAt != nil {
+			songs = append(songs, song)
+		}
+	}
+	sort.Slice(songs, func(i, j int) bool {
+		return songs[i].SongId < songs[j].SongId
+	})
+	return songs, nil
+}
+
+func (s *memoryStore) TrashedPlaylists() ([]Playlist, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var playlists []Playlist
+	for _, playlist := range s.playlists {
+		if playlist.DeletedAt != nil {
+			playlists = append(playlists, playlist)
+		}
+	}
+	sort.Slice(playlists, func(i, j int) bool {
+		return playlists[i].Id < playlists[j].Id
+	})
+	return playlists, nil
+}
+
+func (s *memoryStore) RestoreSong(songid string) error {
+	id, err := strconv.Atoi(songid)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	song, ok := s.songs[id]
+	if !ok || song.DeletedAt == nil {
+		return ErrNotFound
+	}
+	song.DeletedAt = nil
+	s.songs[id] = song
+	return nil
+}
+
+func (s *memoryStore) RestorePlaylist(playlistid string) error {
+	id, err := strconv.Atoi(playlistid)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	playlist, ok := s.playlists[id]
+	if !ok || playlist.DeletedAt == nil {
+		return ErrNotFound
+	}
+	playlist.DeletedAt = nil
+	s.playlists[id] = playlist
+	return nil
+}
+
+func (s *memoryStore) PurgeTrash(before time.Time) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	purged := 0
+	for id, song := range s.songs {
+		if song.DeletedAt != nil && song.DeletedAt.Before(before) {
+			delete(s.songs, id)
+			purged++
+		}
+	}
+	for id, playlist := range s.playlists {
+		if playlist.DeletedAt != nil && playlist.DeletedAt.Before(before) {
+			delete(s.playlists, id)
+			purged++
+		}
+	}
+
+	// what the foreign keys cascade in mysql
+	s.entries = filterEntries(s.entries, func(entry PlaylistEntry) bool {
+		_, songok := s.songs[entry.SongId]
+		_, playlistok := s.playlists[entry.PlaylistId]
+		return songok && playlistok
+	})
+	var votes []Vote
+	for _, vote := range s.votes {
+		if _, ok := s.songs[vote.Song]; ok {
+			votes = append(votes, vote)
+		}
+	}
+	s.votes = votes
+	for id := range s.fingerprints {
+		if _, ok := s.songs[id]; !ok {
+			delete(s.fingerprints, id)
+		}
+	}
+	for date, schedule := range s.schedules {
+		var kept Schedule
+		for _, plan := range schedule {
+			if plan.Type.Playlist.Active {
+				id, err := strconv.Atoi(plan.Type.Playlist.PlaylistId)
+				if _, ok := s.playlists[id]; err != nil || !ok {
+					continue
+				}
+			}
+			kept = append(kept, plan)
+		}
+		if len(kept) == 0 {
+			delete(s.schedules, date)
+		} else {
+			s.schedules[date] = kept
+		}
+	}
+	return purged, nil
+}
+
+func inRange(t, from, to time.Time) bool {
+	return !t.Before(from) && t.Before(to)
+}
+
+func (s *memoryStore) Votes(songid string, votetype int, from, to time.Time) ([]Vote, error) {
+	id, err := strconv.Atoi(songid)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var votes []Vote
+	for _, vote := range s.votes {
+		if vote.Song == id && vote.VoteType == votetype && inRange(vote.SubmitDate, from, to) {
+			votes = append(votes, vote)
+		}
+	}
+	return votes, nil
+}
+
+func (s *memoryStore) UpdateVote(student, songid string, votetype int, from, to time.Time) error {
+	id, err := strconv.Atoi(songid)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, vote := range s.votes {
+		if vote.Student == student && vote.Song == id && inRange(vote.SubmitDate, from, to) {
+			s.votes[i].VoteType = votetype
+			return nil
+		}
+	}
+	s.votes = append(s.votes, Vote{
+		Student:    student,
+		VoteType:   votetype,
+		Song:       id,
+		SubmitDate: time.Now(),
+	})
+	return nil
+}
+
+func (s *memoryStore) ImportVote(vote Vote) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.importVote(vote)
+}
+
+func (s *memoryStore) importVote(vote Vote) error {
+	if _, ok := s.songs[vote.Song]; !ok {
+		return ErrNotFound
+	}
+	// like votes_student_week, a later vote in the same week replaces the earlier one
+	start, end := WeekBounds(vote.SubmitDate)
+	for i, other := range s.votes {
+		if other.Student == vote.Student && other.Song == vote.Song && inRange(other.SubmitDate, start, end) {
+			s.votes[i] = vote
+			return nil
+		}
+	}
+	s.votes = append(s.votes, vote)
+	return nil
+}
+
+func (s *memoryStore) VoteTallies(from, to time.Time) ([]Tally, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	bySong := map[int]*Tally{}
+	var tallies []*Tally
+	for _, vote := range s.votes {
+		if !inRange(vote.SubmitDate, from, to) {
+			continue
+		}
+		if song, ok := s.songs[vote.Song]; !ok || song.DeletedAt != nil {
+			continue
+		}
+		tally, ok := bySong[vote.Song]
+		if !ok {
+			tally = &Tally{SongId: vote.Song}
+			bySong[vote.Song] = tally
+			tallies = append(tallies, tally)
+		}
+		if vote.VoteType == 1 {
+			tally.Up++
+		} else {
+			tally.Down++
+		}
+	}
+
+	var result []Tally
+	for _, tally := range tallies {
+		result = append(result, *tally)
+	}
+	return result, nil
+}
+
+func (s *memoryStore) VotingPeriods() ([]VotingPeriod, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	periods := append([]VotingPeriod{}, s.periods...)
+	sort.SliceStable(periods, func(i, j int) bool {
+		return periods[i].Start.Before(periods[j].Start)
+	})
+	return periods, nil
+}
+
+func (s *memoryStore) AddVotingPeriod(period VotingPeriod) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.periodStarting(period.Kind, period.Start) != nil {
+		return 0, errors.New("a " + period.Kind + " period already starts at " + period.Start.Format("2006-01-02 15:04"))
+	}
+	return s.addPeriod(period), nil
+}
+
+func (s *memoryStore) EnsureVotingPeriod(period VotingPeriod) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if existing := s.periodStarting(period.Kind, period.Start); existing != nil {
+		return existing.Id, nil
+	}
+	return s.addPeriod(period), nil
+}
+
+// kind and start are unique, as in MySQL
+func (s *memoryStore) periodStarting(kind string, start time.Time) *VotingPeriod {
+	for i := range s.periods {
+		if s.periods[i].Kind == kind && s.periods[i].Start.Equal(start) {
+			return &s.periods[i]
+		}
+	}
+	return nil
+}
+
+func (s *memoryStore) addPeriod(period VotingPeriod) int {
+	period.Id = len(s.periods) + 1
+	period.ClosedAt = nil
+	s.periods = append(s.periods, period)
+	return period.Id
+}
+
+func (s *memoryStore) ClosePeriod(periodid int, chart []ChartPosition) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i := range s.periods {
+		if s.periods[i].Id != periodid {
+			continue
+		}
+		if s.periods[i].ClosedAt != nil {
+			return ErrNotFound
+		}
+		now := time.Now()
+		s.periods[i].ClosedAt = &now
+		s.results[periodid] = append([]ChartPosition{}, chart...)
+		return nil
+	}
+	return ErrNotFound
+}
+
+func (s *memoryStore) PeriodResults(periodid int) ([]ChartPosition, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return append([]ChartPosition{}, s.results[periodid]...), nil
+}
+
+func (s *memoryStore) SongChart(songid string) ([]SongChartEntry, error) {
+	id, err := strconv.Atoi(songid)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	// periods are kept in creation order, charts are listed chronologically
+	periods := append([]VotingPeriod{}, s.periods...)
+	sort.SliceStable(periods, func(i, j int) bool {
+		return periods[i].Start.Before(periods[j].Start)
+	})
+
+	var entries []SongChartEntry
+	for _, period := range periods {
+		for _, pos := range s.results[period.Id] {
+			if pos.SongId == id {
+				entries = append(entries, SongChartEntry{PeriodId: period.Id, ChartPosition: pos})
+			}
+		}
+	}
+	return entries, nil
+}
+
+func (s *memoryStore) Schedule(date string) (Schedule, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	schedule, ok := s.schedules[date]
+	if !ok {
+		return nil, nil
+	}
+	return append(Schedule{}, schedule...), nil
+}
+
+func (s *memoryStore) SetSchedule(date string, schedule Schedule) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.setSchedule(date, schedule)
+}
+
+func (s *memoryStore) setSchedule(date string, schedule Schedule) error {
+	s.schedules[date] = append(Schedule{}, schedule...)
+	return nil
+}
+
+func (s *memoryStore) ScheduleBlocks(q ScheduleQuery) ([]ScheduledBlock, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var blocks []ScheduledBlock
+	for date, schedule := range s.schedules {
+		for _, plan := range schedule {
+			if !q.From.IsZero() && plan.Range.End.Before(q.From) {
+				continue
+			}
+			if !q.To.IsZero() && plan.Range.Start.After(q.To) {
+				continue
+			}
+			if q.PlaylistId != "" && (!plan.Type.Playlist.Active || plan.Type.Playlist.PlaylistId != q.PlaylistId) {
+				continue
+			}
+			blocks = append(blocks, ScheduledBlock{Date: date, PlanBlock: plan})
+		}
+	}
+	sort.SliceStable(blocks, func(i, j int) bool {
+		if blocks[i].Range.Start.Equal(blocks[j].Range.Start) {
+			return blocks[i].Date < blocks[j].Date
+		}
+		return blocks[i].Range.Start.Before(blocks[j].Range.Start)
+	})
+	return blocks, nil
+}
+
+func filterEntries(entries []PlaylistEntry, keep func(PlaylistEntry) bool) []PlaylistEntry {
+	kept := entries[:0]
+	for _, entry := range entries {
+		if keep(entry) {
+			kept = append(kept, entry)
+		}
+	}
+	return kept
+}
+
+func containsVote(votes []Vote, vote Vote) bool {
+	for _, other := range votes {
+		if other.Student == vote.Student && other.Song == vote.Song && other.SubmitDate.Equal(vote.SubmitDate) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *memoryStore) Fingerprints() ([]Fingerprint, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	var fingerprints []Fingerprint
+	for id, fingerprint := range s.fingerprints {
+		if song, ok := s.songs[id]; ok && song.DeletedAt == nil {
+			fingerprints = append(fingerprints, fingerprint)
+		}
+	}
+	sort.Slice(fingerprints, func(i, j int) bool {
+		return fingerprints[i].SongId < fingerprints[j].SongId
+	})
+	return fingerprints, nil
+}
+
+func (s *memoryStore) SetFingerprint(fingerprint Fingerprint) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if song, ok := s.songs[fingerprint.SongId]; !ok || song.DeletedAt != nil {
+		return ErrNotFound
+	}
+	fingerprint.Data = append([]byte{}, fingerprint.Data...)
+	s.fingerprints[fingerprint.SongId] = fingerprint
+	return nil
+}
+
+func (s *memoryStore) APITokens() ([]APIToken, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return append([]APIToken{}, s.tokens...), nil
+}
+
+func (s *memoryStore) APITokenByHash(hash string) (*APIToken, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, token := range s.tokens {
+		if token.RevokedAt == nil && s.tokenHashes[token.Id] == hash {
+			return &token, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *memoryStore) AddAPIToken(name, hash string) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	token := APIToken{Id: len(s.tokens) + 1, Name: name, CreatedAt: time.Now()}
+	s.tokens = append(s.tokens, token)
+	s.tokenHashes[token.Id] = hash
+	return token.Id, nil
+}
+
+func (s *memoryStore) RevokeAPIToken(tokenid int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i := range s.tokens {
+		if s.tokens[i].Id == tokenid && s.tokens[i].RevokedAt == nil {
+			now := time.Now()
+			s.tokens[i].RevokedAt = &now
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// the writes of Import, made while Import holds the lock
+type memoryImportTx struct {
+	s *memoryStore
+}
+
+// what an import can change, to be put back if it fails
+type memorySnapshot struct {
+	nextSongId     int
+	nextPlaylistId int
+	songs          map[int]SongData
+	playlists      map[int]Playlist
+	entries        []PlaylistEntry
+	votes          []Vote
+	schedules      map[string]Schedule
+}
+
+func (s *memoryStore) Import(fn func(tx ImportTx) error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	snapshot := memorySnapshot{
+		nextSongId:     s.nextSongId,
+		nextPlaylistId: s.nextPlaylistId,
+		songs:          make(map[int]SongData, len(s.songs)),
+		playlists:      make(map[int]Playlist, len(s.playlists)),
+		entries:        append([]PlaylistEntry{}, s.entries...),
+		votes:          append([]Vote{}, s.votes...),
+		schedules:      make(map[string]Schedule, len(s.schedules)),
+	}
+	for id, song := range s.songs {
+		snapshot.songs[id] = song
+	}
+	for id, playlist := range s.playlists {
+		snapshot.playlists[id] = playlist
+	}
+	for date, schedule := range s.schedules {
+		snapshot.schedules[date] = schedule
+	}
+
+	if err := fn(&memoryImportTx{s}); err != nil {
+		s.nextSongId = snapshot.nextSongId
+		s.nextPlaylistId = snapshot.nextPlaylistId
+		s.songs = snapshot.songs
+		s.playlists = snapshot.playlists
+		s.entries = snapshot.entries
+		s.votes = snapshot.votes
+		s.schedules = snapshot.schedules
+		return err
+	}
+	return nil
+}
+
+func (t *memoryImportTx) AddSong(song SongData) (int, error) {
+	return t.s.addSong(song)
+}
+
+func (t *memoryImportTx) AddPlaylist(playlist Playlist) (int, error) {
+	return t.s.addPlaylist(playlist)
+}
+
+func (t *memoryImportTx) AddSongToPlaylist(playlistid, songid string, position int) error {
+	return t.s.addSongToPlaylist(playlistid, songid, position)
+}
+
+func (t *memoryImportTx) ImportVote(vote Vote) error {
+	return t.s.importVote(vote)
+}
+
+func (t *memoryImportTx) SetSchedule(date string, schedule Schedule) error {
+	return t.s.setSchedule(date, schedule)
+}
@@ -0,0 +1,1110 @@
+package database
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// a memory store holding the given songs, numbered from 1
+func storeWithSongs(t *testing.T, titles ...string) *memoryStore {
+	t.Helper()
+	s := NewMemoryStore().(*memoryStore)
+	for _, title := range titles {
+		if _, err := s.AddSong(SongData{Title: title}); err != nil {
+			t.Fatalf("AddSong(%s): %v", title, err)
+		}
+	}
+	return s
+}
+
+func songIds(songs []SongData) []int {
+	var ids []int
+	for _, song := range songs {
+		ids = append(ids, song.SongId)
+	}
+	return ids
+}
+
+func TestMemorySong(t *testing.T) {
+	tests := []struct {
+		songid    string
+		wantTitle string
+		wantErr   error
+	}{
+		{"1", "a", nil},
+		{"3", "c", nil},
+		{"4", "", ErrNotFound},
+		{"0", "", ErrNotFound},
+		{"abc", "", ErrNotFound},
+	}
+
+	s := storeWithSongs(t, "a", "b", "c")
+	for _, tt := range tests {
+		song, err := s.Song(tt.songid)
+		if err != tt.wantErr {
+			t.Errorf("Song(%s) error = %v, want %v", tt.songid, err, tt.wantErr)
+			continue
+		}
+		if err == nil && song.Title != tt.wantTitle {
+			t.Errorf("Song(%s) = %s, want %s", tt.songid, song.Title, tt.wantTitle)
+		}
+	}
+}
+
+func TestMemorySongs(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(s Store) error
+		want []int
+	}{
+		{
+			name: "numbered from 1",
+			run:  func(s Store) error { return nil },
+			want: []int{1, 2, 3},
+		},
+		{
+			name: "deleted",
+			run:  func(s Store) error { return s.DelSong("2") },
+			want: []int{1, 3},
+		},
+		{
+			name: "ids not reused",
+			run: func(s Store) error {
+				s.DelSong("3")
+				_, err := s.AddSong(SongData{Title: "d"})
+				return err
+			},
+			want: []int{1, 2, 4},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := storeWithSongs(t, "a", "b", "c")
+			if err := tt.run(s); err != nil {
+				t.Fatal(err)
+			}
+			songs, err := s.Songs()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := songIds(songs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("songs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryAddSong(t *testing.T) {
+	tests := []struct {
+		name    string
+		ids     []int
+		want    []int
+		wantErr bool
+	}{
+		{"numbered from 1", []int{0, 0, 0}, []int{1, 2, 3}, false},
+		{"kept ids", []int{5, 2}, []int{5, 2}, false},
+		{"numbered after the highest kept id", []int{5, 0}, []int{5, 6}, false},
+		{"taken id", []int{1, 1}, []int{1}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewMemoryStore()
+			var got []int
+			var err error
+			for _, id := range tt.ids {
+				var songid int
+				if songid, err = s.AddSong(SongData{SongId: id}); err != nil {
+					break
+				}
+				got = append(got, songid)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ids = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryPlaylistEntries(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(s Store) error
+		want []int
+	}{
+		{
+			name: "added",
+			run:  func(s Store) error { return nil },
+			want: []int{1, 2},
+		},
+		{
+			name: "removed",
+			run:  func(s Store) error { return s.DelSongFromPlaylist("1", "1") },
+			want: []int{2},
+		},
+		{
+			name: "trashed song hidden",
+			run:  func(s Store) error { return s.DelSong("1") },
+			want: []int{2},
+		},
+		{
+			name: "restored song back",
+			run:  func(s Store) error { s.DelSong("1"); return s.RestoreSong("1") },
+			want: []int{1, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := storeWithSongs(t, "a", "b")
+			if _, err := s.AddPlaylist(Playlist{Name: "list"}); err != nil {
+				t.Fatal(err)
+			}
+			for _, songid := range []string{"1", "2"} {
+				if err := s.AddSongToPlaylist("1", songid, 0); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := tt.run(s); err != nil {
+				t.Fatal(err)
+			}
+
+			entries, err := s.PlaylistEntries("1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []int
+			for _, entry := range entries {
+				got = append(got, entry.Song.SongId)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("entries = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryPlaylistOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		run     func(s Store) error
+		wantErr error
+		// song ids in running order
+		want []int
+		// positions of those songs, 1 to n when nil
+		wantPositions []int
+	}{
+		{
+			name: "appended",
+			run:  func(s Store) error { return nil },
+			want: []int{1, 2, 3},
+		},
+		{
+			name: "inserted at a position",
+			run:  func(s Store) error { return s.AddSongToPlaylist("1", "4", 2) },
+			want: []int{1, 4, 2, 3},
+		},
+		{
+			name: "past the end",
+			run:  func(s Store) error { return s.AddSongToPlaylist("1", "4", 10) },
+			want: []int{1, 2, 3, 4},
+		},
+		{
+			name: "reordered",
+			run:  func(s Store) error { return s.ReorderPlaylist("1", []int{3, 1}) },
+			want: []int{3, 1, 2},
+		},
+		{
+			name:    "reordered with an unknown position",
+			run:     func(s Store) error { return s.ReorderPlaylist("1", []int{3, 7}) },
+			wantErr: ErrNotFound,
+			want:    []int{1, 2, 3},
+		},
+		{
+			name: "removed and renumbered",
+			run:  func(s Store) error { return s.DelSongFromPlaylist("1", "2") },
+			want: []int{1, 3},
+		},
+		{
+			name:    "unknown song",
+			run:     func(s Store) error { return s.AddSongToPlaylist("1", "9", 0) },
+			wantErr: ErrNotFound,
+			want:    []int{1, 2, 3},
+		},
+		{
+			name: "trashed song",
+			run: func(s Store) error {
+				s.DelSong("4")
+				return s.AddSongToPlaylist("1", "4", 0)
+			},
+			wantErr: ErrNotFound,
+			want:    []int{1, 2, 3},
+		},
+		{
+			name: "trashed playlist",
+			run: func(s Store) error {
+				s.DelPlaylist("1")
+				err := s.AddSongToPlaylist("1", "4", 0)
+				s.RestorePlaylist("1")
+				return err
+			},
+			wantErr: ErrNotFound,
+			want:    []int{1, 2, 3},
+		},
+		{
+			name:          "trashed songs hidden",
+			run:           func(s Store) error { return s.DelSong("1") },
+			want:          []int{2, 3},
+			wantPositions: []int{2, 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := storeWithSongs(t, "a", "b", "c", "d")
+			if _, err := s.AddPlaylist(Playlist{Name: "list"}); err != nil {
+				t.Fatal(err)
+			}
+			for _, songid := range []string{"1", "2", "3"} {
+				if err := s.AddSongToPlaylist("1", songid, 0); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := tt.run(s); err != tt.wantErr {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+
+			entries, err := s.PlaylistEntries("1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got, positions []int
+			for _, entry := range entries {
+				got = append(got, entry.SongId)
+				positions = append(positions, entry.Position)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("order = %v, want %v", got, tt.want)
+			}
+			wantPositions := tt.wantPositions
+			if wantPositions == nil {
+				for i := range tt.want {
+					wantPositions = append(wantPositions, i+1)
+				}
+			}
+			if !reflect.DeepEqual(positions, wantPositions) {
+				t.Errorf("positions = %v, want %v", positions, wantPositions)
+			}
+		})
+	}
+}
+
+func TestMemoryTrash(t *testing.T) {
+	tests := []struct {
+		name        string
+		run         func(s Store) error
+		wantErr     error
+		wantSongs   []int
+		wantTrashed []int
+	}{
+		{
+			name:        "delete",
+			run:         func(s Store) error { return s.DelSong("2") },
+			wantSongs:   []int{1, 3},
+			wantTrashed: []int{2},
+		},
+		{
+			name:        "delete twice",
+			run:         func(s Store) error { s.DelSong("2"); return s.DelSong("2") },
+			wantErr:     ErrNotFound,
+			wantSongs:   []int{1, 3},
+			wantTrashed: []int{2},
+		},
+		{
+			name:      "restore",
+			run:       func(s Store) error { s.DelSong("2"); return s.RestoreSong("2") },
+			wantSongs: []int{1, 2, 3},
+		},
+		{
+			name:      "restore a song outside the trash",
+			run:       func(s Store) error { return s.RestoreSong("1") },
+			wantErr:   ErrNotFound,
+			wantSongs: []int{1, 2, 3},
+		},
+		{
+			name: "purge older than the cutoff",
+			run: func(s Store) error {
+				s.DelSong("2")
+				_, err := s.PurgeTrash(time.Now().Add(time.Minute))
+				return err
+			},
+			wantSongs: []int{1, 3},
+		},
+		{
+			name: "keep newer than the cutoff",
+			run: func(s Store) error {
+				s.DelSong("2")
+				_, err := s.PurgeTrash(time.Now().Add(-time.Minute))
+				return err
+			},
+			wantSongs:   []int{1, 3},
+			wantTrashed: []int{2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := storeWithSongs(t, "a", "b", "c")
+			if err := tt.run(s); err != tt.wantErr {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+
+			songs, _ := s.Songs()
+			trashed, _ := s.TrashedSongs()
+			if got := songIds(songs); !reflect.DeepEqual(got, tt.wantSongs) {
+				t.Errorf("songs = %v, want %v", got, tt.wantSongs)
+			}
+			if got := songIds(trashed); !reflect.DeepEqual(got, tt.wantTrashed) {
+				t.Errorf("trashed = %v, want %v", got, tt.wantTrashed)
+			}
+		})
+	}
+}
+
+// purging does what the foreign keys cascade in MySQL
+func TestMemoryPurgeTrash(t *testing.T) {
+	tests := []struct {
+		name        string
+		trash       func(s Store)
+		wantPurged  int
+		wantEntries int
+		wantVotes   int
+		wantBlocks  int
+	}{
+		{
+			name:        "nothing trashed",
+			trash:       func(s Store) {},
+			wantEntries: 2,
+			wantVotes:   2,
+			wantBlocks:  2,
+		},
+		{
+			name:        "song",
+			trash:       func(s Store) { s.DelSong("1") },
+			wantPurged:  1,
+			wantEntries: 1,
+			wantVotes:   1,
+			wantBlocks:  2,
+		},
+		{
+			name:       "playlist",
+			trash:      func(s Store) { s.DelPlaylist("1") },
+			wantPurged: 1,
+			wantVotes:  2,
+			wantBlocks: 1,
+		},
+		{
+			name:       "both",
+			trash:      func(s Store) { s.DelSong("1"); s.DelPlaylist("1") },
+			wantPurged: 2,
+			wantVotes:  1,
+			wantBlocks: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := storeWithSongs(t, "a", "b")
+			s.AddPlaylist(Playlist{Name: "list"})
+			s.AddSongToPlaylist("1", "1", 0)
+			s.AddSongToPlaylist("1", "2", 0)
+			from, to := WeekBounds(time.Now())
+			s.UpdateVote("a", "1", 1, from, to)
+			s.UpdateVote("a", "2", 1, from, to)
+			s.SetSchedule("2026-10-12", Schedule{
+				NewPlanBlock(BlockPlaylist, from, from.Add(time.Hour), "1", nil),
+				NewPlanBlock(BlockSilence, from.Add(time.Hour), from.Add(2*time.Hour), "", nil),
+			})
+			tt.trash(s)
+
+			purged, err := s.PurgeTrash(time.Now().Add(time.Minute))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if purged != tt.wantPurged {
+				t.Errorf("purged %d, want %d", purged, tt.wantPurged)
+			}
+			if len(s.entries) != tt.wantEntries || len(s.votes) != tt.wantVotes {
+				t.Errorf("%d entries and %d votes left, want %d and %d", len(s.entries), len(s.votes), tt.wantEntries, tt.wantVotes)
+			}
+			if blocks, _ := s.ScheduleBlocks(ScheduleQuery{}); len(blocks) != tt.wantBlocks {
+				t.Errorf("%d schedule blocks left, want %d", len(blocks), tt.wantBlocks)
+			}
+			if playlists, _ := s.TrashedPlaylists(); len(playlists) != 0 {
+				t.Errorf("trashed playlists = %v, want none", playlists)
+			}
+		})
+	}
+}
+
+func TestMemoryVotes(t *testing.T) {
+	from, to := WeekBounds(time.Now())
+	lastWeek := from.Add(-time.Hour)
+	tests := []struct {
+		name     string
+		existing []Vote
+		student  string
+		votetype int
+		wantUp   int
+		wantDown int
+	}{
+		{
+			name:     "first vote",
+			student:  "a",
+			votetype: 1,
+			wantUp:   1,
+		},
+		{
+			name:     "changed vote",
+			existing: []Vote{{Student: "a", Song: 1, VoteType: 1, SubmitDate: time.Now()}},
+			student:  "a",
+			votetype: 0,
+			wantDown: 1,
+		},
+		{
+			name:     "other student",
+			existing: []Vote{{Student: "a", Song: 1, VoteType: 1, SubmitDate: time.Now()}},
+			student:  "b",
+			votetype: 0,
+			wantUp:   1,
+			wantDown: 1,
+		},
+		{
+			name:     "last week's vote left alone",
+			existing: []Vote{{Student: "a", Song: 1, VoteType: 0, SubmitDate: lastWeek}},
+			student:  "a",
+			votetype: 1,
+			wantUp:   1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := storeWithSongs(t, "a")
+			s.votes = append(s.votes, tt.existing...)
+			if err := s.UpdateVote(tt.student, "1", tt.votetype, from, to); err != nil {
+				t.Fatal(err)
+			}
+
+			up, err := s.Votes("1", 1, from, to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			down, err := s.Votes("1", 0, from, to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(up) != tt.wantUp || len(down) != tt.wantDown {
+				t.Errorf("votes = %d up, %d down, want %d up, %d down", len(up), len(down), tt.wantUp, tt.wantDown)
+			}
+		})
+	}
+}
+
+func TestMemoryImportVote(t *testing.T) {
+	monday := time.Date(2026, 10, 12, 9, 0, 0, 0, time.Local)
+	tests := []struct {
+		name      string
+		votes     []Vote
+		wantTypes []int
+	}{
+		{
+			name:      "same week replaced",
+			votes:     []Vote{{Student: "a", Song: 1, VoteType: 1, SubmitDate: monday}, {Student: "a", Song: 1, VoteType: 0, SubmitDate: monday.AddDate(0, 0, 3)}},
+			wantTypes: []int{0},
+		},
+		{
+			name:      "next week kept",
+			votes:     []Vote{{Student: "a", Song: 1, VoteType: 1, SubmitDate: monday}, {Student: "a", Song: 1, VoteType: 0, SubmitDate: monday.AddDate(0, 0, 7)}},
+			wantTypes: []int{1, 0},
+		},
+		{
+			name:      "other student kept",
+			votes:     []Vote{{Student: "a", Song: 1, VoteType: 1, SubmitDate: monday}, {Student: "b", Song: 1, VoteType: 0, SubmitDate: monday}},
+			wantTypes: []int{1, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := storeWithSongs(t, "a")
+			for _, vote := range tt.votes {
+				if err := s.ImportVote(vote); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var types []int
+			for _, vote := range s.votes {
+				types = append(types, vote.VoteType)
+			}
+			if !reflect.DeepEqual(types, tt.wantTypes) {
+				t.Errorf("vote types = %v, want %v", types, tt.wantTypes)
+			}
+		})
+	}
+}
+
+func TestMemorySchedule(t *testing.T) {
+	s := NewMemoryStore()
+	schedule, err := s.Schedule("2026-10-12")
+	if schedule != nil || err != nil {
+		t.Fatalf("Schedule of an unplanned date = %v, %v, want nil, nil", schedule, err)
+	}
+
+	morning := time.Date(2026, 10, 12, 8, 0, 0, 0, time.UTC)
+	evening := time.Date(2026, 10, 12, 18, 0, 0, 0, time.UTC)
+	planned := Schedule{
+		{Range: Range{Start: morning, End: morning.Add(time.Hour)}},
+		{Range: Range{Start: evening, End: evening.Add(time.Hour)}},
+	}
+	if err := s.SetSchedule("2026-10-12", planned); err != nil {
+		t.Fatal(err)
+	}
+	// the store keeps its own copy
+	planned[0].Range.Start = evening
+	schedule, err = s.Schedule("2026-10-12")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schedule) != 2 || !schedule[0].Range.Start.Equal(morning) {
+		t.Errorf("Schedule = %+v, want the blocks as they were set", schedule)
+	}
+}
+
+func TestMemoryScheduleBlocks(t *testing.T) {
+	day := func(d, hour int) time.Time {
+		return time.Date(2026, 10, d, hour, 0, 0, 0, time.UTC)
+	}
+	block := func(d, hour int, playlistid string) PlanBlock {
+		plan := PlanBlock{Range: Range{Start: day(d, hour), End: day(d, hour+2)}}
+		if playlistid != "" {
+			plan.Type.Playlist.Active = true
+			plan.Type.Playlist.PlaylistId = playlistid
+		}
+		return plan
+	}
+
+	s := NewMemoryStore()
+	s.SetSchedule("2026-10-12", Schedule{block(12, 18, "1"), block(12, 8, "2")})
+	s.SetSchedule("2026-10-13", Schedule{block(13, 8, ""), block(13, 12, "1")})
+
+	tests := []struct {
+		name string
+		q    ScheduleQuery
+		// block starts as day*100+hour
+		want []int
+	}{
+		{"everything in order", ScheduleQuery{}, []int{1208, 1218, 1308, 1312}},
+		{"from", ScheduleQuery{From: day(13, 9)}, []int{1308, 1312}},
+		{"to", ScheduleQuery{To: day(12, 8)}, []int{1208}},
+		{"overlapping range", ScheduleQuery{From: day(12, 19), To: day(13, 8)}, []int{1218, 1308}},
+		{"playlist", ScheduleQuery{PlaylistId: "1"}, []int{1218, 1312}},
+		{"unscheduled playlist", ScheduleQuery{PlaylistId: "3"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks, err := s.ScheduleBlocks(tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []int
+			for _, block := range blocks {
+				got = append(got, block.Range.Start.Day()*100+block.Range.Start.Hour())
+				if block.Date != block.Range.Start.Format("2006-01-02") {
+					t.Errorf("block at %v listed under %s", block.Range.Start, block.Date)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("blocks = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryVoteTallies(t *testing.T) {
+	from, to := WeekBounds(time.Now())
+	tests := []struct {
+		name  string
+		votes []Vote
+		trash string
+		want  []Tally
+	}{
+		{name: "no votes"},
+		{
+			name: "counted per song",
+			votes: []Vote{
+				{Student: "a", Song: 1, VoteType: 1},
+				{Student: "b", Song: 1, VoteType: 0},
+				{Student: "c", Song: 1, VoteType: 1},
+				{Student: "a", Song: 2, VoteType: 0},
+			},
+			want: []Tally{{SongId: 1, Up: 2, Down: 1}, {SongId: 2, Down: 1}},
+		},
+		{
+			name: "outside the range",
+			votes: []Vote{
+				{Student: "a", Song: 1, VoteType: 1, SubmitDate: from.Add(-time.Hour)},
+				{Student: "a", Song: 1, VoteType: 1, SubmitDate: to},
+				{Student: "a", Song: 2, VoteType: 1},
+			},
+			want: []Tally{{SongId: 2, Up: 1}},
+		},
+		{
+			name: "trashed songs left out",
+			votes: []Vote{
+				{Student: "a", Song: 1, VoteType: 1},
+				{Student: "a", Song: 2, VoteType: 1},
+			},
+			trash: "1",
+			want:  []Tally{{SongId: 2, Up: 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := storeWithSongs(t, "a", "b")
+			for _, vote := range tt.votes {
+				if vote.SubmitDate.IsZero() {
+					vote.SubmitDate = from.Add(time.Hour)
+				}
+				s.votes = append(s.votes, vote)
+			}
+			if tt.trash != "" {
+				s.DelSong(tt.trash)
+			}
+
+			got, err := s.VoteTallies(from, to)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tallies = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVoteScoresCache(t *testing.T) {
+	SetStore(storeWithSongs(t, "a"))
+	tallies.invalidate()
+	defer tallies.invalidate()
+
+	if got := VoteScores()[1]; got != 0 {
+		t.Fatalf("score before voting = %d, want 0", got)
+	}
+	// votes drop the cached tallies
+	for _, vote := range []struct {
+		student  string
+		votetype int
+		want     int
+	}{
+		{"a", 1, 1},
+		{"b", 1, 2},
+		{"a", 0, 0},
+	} {
+		if err := UpdateVote(vote.student, "1", vote.votetype); err != nil {
+			t.Fatal(err)
+		}
+		if got := VoteScores()[1]; got != vote.want {
+			t.Errorf("score after %s voted %d = %d, want %d", vote.student, vote.votetype, got, vote.want)
+		}
+	}
+}
+
+func TestMemoryVotingPeriods(t *testing.T) {
+	monday := time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC)
+	week := func(weeks int) VotingPeriod {
+		start := monday.AddDate(0, 0, 7*weeks)
+		return VotingPeriod{Kind: "weekly", Start: start, End: start.AddDate(0, 0, 7)}
+	}
+
+	s := NewMemoryStore()
+	// added out of order, listed by start
+	for _, period := range []VotingPeriod{week(1), week(0), week(2)} {
+		if _, err := s.AddVotingPeriod(period); err != nil {
+			t.Fatal(err)
+		}
+	}
+	periods, err := s.VotingPeriods()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	for _, period := range periods {
+		ids = append(ids, period.Id)
+	}
+	if want := []int{2, 1, 3}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("periods = %v, want %v", ids, want)
+	}
+
+	tests := []struct {
+		name     string
+		periodid int
+		chart    []ChartPosition
+		wantErr  error
+	}{
+		{"first", 1, []ChartPosition{{Position: 1, SongId: 7}, {Position: 2, SongId: 8}}, nil},
+		{"earlier", 2, []ChartPosition{{Position: 1, SongId: 8}}, nil},
+		{"closed twice", 1, nil, ErrNotFound},
+		{"unknown", 4, nil, ErrNotFound},
+	}
+	for _, tt := range tests {
+		if err := s.ClosePeriod(tt.periodid, tt.chart); err != tt.wantErr {
+			t.Errorf("%s: ClosePeriod error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	results, err := s.PeriodResults(1)
+	if err != nil || len(results) != 2 {
+		t.Errorf("PeriodResults(1) = %v, %v, want the chart it was closed with", results, err)
+	}
+	// a song's placings, oldest period first
+	chart, err := s.SongChart("8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var placings []int
+	for _, entry := range chart {
+		placings = append(placings, entry.PeriodId*10+entry.Position)
+	}
+	if want := []int{21, 12}; !reflect.DeepEqual(placings, want) {
+		t.Errorf("SongChart placings = %v, want %v", placings, want)
+	}
+}
+
+func TestMemoryMergeSongs(t *testing.T) {
+	from, to := WeekBounds(time.Now())
+	tests := []struct {
+		name          string
+		keep          int
+		duplicate     int
+		wantErr       error
+		wantPlaylists []int
+		// song ids of both playlists in running order
+		wantEntries [2][]int
+		wantTallies []Tally
+	}{
+		{
+			name:          "merged",
+			keep:          1,
+			duplicate:     2,
+			wantPlaylists: []int{1, 2},
+			wantEntries:   [2][]int{{1, 3}, {1}},
+			// a's vote for the duplicate clashes with the one for the kept song
+			wantTallies: []Tally{{SongId: 1, Up: 2}, {SongId: 3, Up: 1}},
+		},
+		{
+			name:          "the other way around",
+			keep:          2,
+			duplicate:     1,
+			wantPlaylists: []int{1},
+			wantEntries:   [2][]int{{2, 3}, {2}},
+			wantTallies:   []Tally{{SongId: 2, Up: 2}, {SongId: 3, Up: 1}},
+		},
+		{
+			name:        "unknown song",
+			keep:        1,
+			duplicate:   4,
+			wantErr:     ErrNotFound,
+			wantEntries: [2][]int{{1, 2, 3}, {2}},
+			wantTallies: []Tally{{SongId: 1, Up: 1}, {SongId: 2, Up: 2}, {SongId: 3, Up: 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := storeWithSongs(t, "a", "b", "c")
+			s.AddPlaylist(Playlist{Name: "both"})
+			s.AddPlaylist(Playlist{Name: "duplicate"})
+			for _, songid := range []string{"1", "2", "3"} {
+				s.AddSongToPlaylist("1", songid, 0)
+			}
+			s.AddSongToPlaylist("2", "2", 0)
+			for _, vote := range []Vote{{Student: "a", Song: 1}, {Student: "a", Song: 2}, {Student: "b", Song: 2}, {Student: "a", Song: 3}} {
+				vote.VoteType = 1
+				vote.SubmitDate = from.Add(time.Hour)
+				s.ImportVote(vote)
+			}
+
+			playlists, err := s.MergeSongs(tt.keep, tt.duplicate)
+			if err != tt.wantErr {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(playlists, tt.wantPlaylists) {
+				t.Errorf("changed playlists = %v, want %v", playlists, tt.wantPlaylists)
+			}
+			for i, playlistid := range []string{"1", "2"} {
+				entries, _ := s.PlaylistEntries(playlistid)
+				var got []int
+				for position, entry := range entries {
+					got = append(got, entry.SongId)
+					if entry.Position != position+1 {
+						t.Errorf("playlist %s: song %d at position %d, want %d", playlistid, entry.SongId, entry.Position, position+1)
+					}
+				}
+				if !reflect.DeepEqual(got, tt.wantEntries[i]) {
+					t.Errorf("playlist %s = %v, want %v", playlistid, got, tt.wantEntries[i])
+				}
+			}
+			tallies, _ := s.VoteTallies(from, to)
+			sort.Slice(tallies, func(i, j int) bool { return tallies[i].SongId < tallies[j].SongId })
+			if !reflect.DeepEqual(tallies, tt.wantTallies) {
+				t.Errorf("tallies = %v, want %v", tallies, tt.wantTallies)
+			}
+		})
+	}
+}
+
+func TestVoteScoresAfterTrash(t *testing.T) {
+	SetStore(storeWithSongs(t, "a", "b"))
+	tallies.invalidate()
+	defer tallies.invalidate()
+
+	UpdateVote("a", "1", 1)
+	UpdateVote("a", "2", 1)
+	if scores := VoteScores(); scores[1] != 1 || scores[2] != 1 {
+		t.Fatalf("scores = %v, want one vote each", scores)
+	}
+	if err := DelSong("1"); err != nil {
+		t.Fatal(err)
+	}
+	if scores := VoteScores(); scores[1] != 0 || scores[2] != 1 {
+		t.Errorf("scores after trashing song 1 = %v, want only song 2's vote", scores)
+	}
+}
+
+func TestQueueAfterTrash(t *testing.T) {
+	s := storeWithSongs(t, "a", "b")
+	SetStore(s)
+	s.AddPlaylist(Playlist{Name: "list", Mode: PlaybackOrdered})
+	s.AddSongToPlaylist("1", "1", 0)
+	s.AddSongToPlaylist("1", "2", 0)
+
+	queues := map[string][]int{}
+	OnPlaylistChange = func(playlistid string) { queues[playlistid] = CreateQueue(playlistid) }
+	defer func() { OnPlaylistChange = func(string) {} }()
+
+	if err := DelPlaylist("1"); err != nil {
+		t.Fatal(err)
+	}
+	if queue, ok := queues["1"]; !ok || len(queue) != 0 {
+		t.Errorf("queue after trashing = %v (refreshed %v), want an empty one", queue, ok)
+	}
+	if err := RestorePlaylist("1"); err != nil {
+		t.Fatal(err)
+	}
+	if queue := queues["1"]; !reflect.DeepEqual(queue, []int{1, 2}) {
+		t.Errorf("queue after restoring = %v, want [1 2]", queue)
+	}
+}
+
+func TestCreateSampleSchedule(t *testing.T) {
+	yesterday := time.Now().AddDate(0, 0, -1)
+	tests := []struct {
+		name       string
+		playlists  int
+		planned    Schedule
+		wantBlocks int
+	}{
+		{name: "fresh install", playlists: 2, wantBlocks: 2},
+		{name: "one playlist", playlists: 1, wantBlocks: 2},
+		{name: "no playlists to play", wantBlocks: 0},
+		{
+			name:       "scheduled before",
+			playlists:  2,
+			planned:    Schedule{NewPlanBlock(BlockSilence, yesterday, yesterday.Add(time.Hour), "", nil)},
+			wantBlocks: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewMemoryStore()
+			SetStore(s)
+			for i := 0; i < tt.playlists; i++ {
+				s.AddPlaylist(Playlist{Name: "list"})
+			}
+			if tt.planned != nil {
+				s.SetSchedule(yesterday.Format("2006-01-02"), tt.planned)
+			}
+
+			CreateSampleSchedule()
+			blocks, err := s.ScheduleBlocks(ScheduleQuery{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(blocks) != tt.wantBlocks {
+				t.Errorf("%d blocks planned, want %d", len(blocks), tt.wantBlocks)
+			}
+		})
+	}
+}
+
+func TestMemoryEnsureVotingPeriod(t *testing.T) {
+	monday := time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC)
+	weekly := VotingPeriod{Kind: "weekly", Start: monday, End: monday.AddDate(0, 0, 7)}
+	custom := VotingPeriod{Kind: "custom", Start: monday, End: monday.AddDate(0, 0, 3)}
+
+	tests := []struct {
+		name    string
+		run     func(s Store) (int, error)
+		want    int
+		wantErr bool
+	}{
+		{
+			name: "ensure creates",
+			run:  func(s Store) (int, error) { return s.EnsureVotingPeriod(weekly) },
+			want: 1,
+		},
+		{
+			name: "ensure finds",
+			run: func(s Store) (int, error) {
+				s.EnsureVotingPeriod(weekly)
+				return s.EnsureVotingPeriod(weekly)
+			},
+			want: 1,
+		},
+		{
+			name: "same start, other kind",
+			run: func(s Store) (int, error) {
+				s.AddVotingPeriod(weekly)
+				return s.AddVotingPeriod(custom)
+			},
+			want: 2,
+		},
+		{
+			name: "add rejects a duplicate",
+			run: func(s Store) (int, error) {
+				s.AddVotingPeriod(weekly)
+				return s.AddVotingPeriod(weekly)
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.run(NewMemoryStore())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("id = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCurrentWeeklyPeriodConcurrently(t *testing.T) {
+	SetStore(NewMemoryStore())
+
+	ids := make(chan int)
+	for i := 0; i < 8; i++ {
+		go func() {
+			period, err := CurrentWeeklyPeriod()
+			if err != nil {
+				t.Error(err)
+				ids <- 0
+				return
+			}
+			ids <- period.Id
+		}()
+	}
+	for i := 0; i < 8; i++ {
+		if id := <-ids; id != 1 {
+			t.Errorf("period id = %d, want 1", id)
+		}
+	}
+	if periods, _ := GetVotingPeriods(); len(periods) != 1 {
+		t.Errorf("%d periods, want one", len(periods))
+	}
+}
+
+func TestMemoryImport(t *testing.T) {
+	failure := errors.New("failed")
+	tests := []struct {
+		name      string
+		fn        func(tx ImportTx) error
+		wantErr   error
+		wantSongs []int
+		wantVotes int
+	}{
+		{
+			name: "committed",
+			fn: func(tx ImportTx) error {
+				id, err := tx.AddSong(SongData{Title: "imported"})
+				if err != nil {
+					return err
+				}
+				return tx.ImportVote(Vote{Student: "a", Song: id, VoteType: 1, SubmitDate: time.Now()})
+			},
+			wantSongs: []int{1, 2},
+			wantVotes: 1,
+		},
+		{
+			name: "rolled back",
+			fn: func(tx ImportTx) error {
+				id, err := tx.AddSong(SongData{Title: "imported"})
+				if err != nil {
+					return err
+				}
+				tx.AddPlaylist(Playlist{Name: "imported"})
+				tx.AddSongToPlaylist("1", strconv.Itoa(id), 0)
+				tx.ImportVote(Vote{Student: "a", Song: id, VoteType: 1, SubmitDate: time.Now()})
+				tx.SetSchedule("2026-10-12", Schedule{})
+				return failure
+			},
+			wantErr:   failure,
+			wantSongs: []int{1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := storeWithSongs(t, "existing")
+			if err := s.Import(tt.fn); err != tt.wantErr {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+
+			songs, _ := s.Songs()
+			if got := songIds(songs); !reflect.DeepEqual(got, tt.wantSongs) {
+				t.Errorf("songs = %v, want %v", got, tt.wantSongs)
+			}
+			if len(s.votes) != tt.wantVotes {
+				t.Errorf("%d votes, want %d", len(s.votes), tt.wantVotes)
+			}
+			if tt.wantErr != nil {
+				if playlists, _ := s.Playlists(); len(playlists) != 0 {
+					t.Errorf("playlists = %v, want none", playlists)
+				}
+				if len(s.entries) != 0 || len(s.schedules) != 0 {
+					t.Errorf("entries or schedules left behind")
+				}
+				// ids handed out in the failed import are free again
+				if id, _ := s.AddSong(SongData{}); id != 2 {
+					t.Errorf("next song id = %d, want 2", id)
+				}
+			}
+		})
+	}
+}
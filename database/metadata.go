@@ -0,0 +1,168 @@
+package database
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// kinds of labels in the tags table
+const (
+	TagGenre = "genre"
+	TagPlain = "tag"
+)
+
+// CC-XXX-YY-NNNNN without the dashes
+var isrcPattern = regexp.MustCompile(`^[A-Z]{2}[A-Z0-9]{3}[0-9]{7}$`)
+var languagePattern = regexp.MustCompile(`^[a-z]{2,3}$`)
+
+// lowercases, trims and deduplicates labels, dropping empty ones
+func NormalizeTags(tags []string) []string {
+	seen := map[string]bool{}
+	var normalized []string
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+// splits a comma separated list of labels, as typed in the console or sent to the API
+func SplitTags(list string) []string {
+	return NormalizeTags(strings.Split(list, ","))
+}
+
+// normalizes the metadata and checks that it's well formed
+func (song *SongData) Validate() error {
+	song.Language = strings.ToLower(strings.TrimSpace(song.Language))
+	song.ISRC = strings.ToUpper(strings.Replace(strings.TrimSpace(song.ISRC), "-", "", -1))
+	song.Genres = NormalizeTags(song.Genres)
+	song.Tags = NormalizeTags(song.Tags)
+
+	if song.BPM < 0 || song.BPM > 400 {
+		return errors.New("BPM must be between 0 (unknown) and 400")
+	}
+	if song.Language != "" && !languagePattern.MatchString(song.Language) {
+		return errors.New("language must be an ISO 639 code, e.g. pl or en")
+	}
+	if song.ISRC != "" && !isrcPattern.MatchString(song.ISRC) {
+		return errors.New("ISRC must look like CC-XXX-YY-NNNNN")
+	}
+	for _, label := range append(append([]string{}, song.Genres...), song.Tags...) {
+		if len(label) > 64 {
+			return errors.New("genres and tags can't be longer than 64 characters")
+		}
+	}
+	return nil
+}
+
+// checks that the cue points come in order
+func (cues Cues) Validate() error {
+	if cues.CueIn < 0 || cues.CueOut <= cues.CueIn {
+		return errors.New("cue out must come after cue in")
+	}
+	if cues.IntroEnd != 0 && (cues.IntroEnd < cues.CueIn || cues.IntroEnd > cues.CueOut) {
+		return errors.New("intro end must lie between cue in and cue out")
+	}
+	if cues.OutroStart != 0 && (cues.OutroStart < cues.CueIn || cues.OutroStart >= cues.CueOut) {
+		return errors.New("outro start must lie between cue in and cue out")
+	}
+	if cues.IntroEnd != 0 && cues.OutroStart != 0 && cues.OutroStart < cues.IntroEnd {
+		return errors.New("outro start can't come before intro end")
+	}
+	return nil
+}
+
+func hasLabel(labels []string, label string) bool {
+	for _, l := range labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+// SongFilter narrows down song listings; zero values match everything
+type SongFilter struct {
+	Genre    string
+	Tag      string
+	Language string
+	// nil matches explicit and clean songs
+	Explicit *bool
+	MinBPM   int
+	MaxBPM   int
+}
+
+func (f SongFilter) Match(song SongData) bool {
+	if f.Genre != "" && !hasLabel(song.Genres, f.Genre) {
+		return false
+	}
+	if f.Tag != "" && !hasLabel(song.Tags, f.Tag) {
+		return false
+	}
+	if f.Language != "" && song.Language != f.Language {
+		return false
+	}
+	if f.Explicit != nil && song.Explicit != *f.Explicit {
+		return false
+	}
+	if f.MinBPM > 0 && song.BPM < f.MinBPM {
+		return false
+	}
+	if f.MaxBPM > 0 && (song.BPM == 0 || song.BPM > f.MaxBPM) {
+		return false
+	}
+	return true
+}
+
+func (f SongFilter) FilterSongs(songs []SongData) []SongData {
+	var kept []SongData
+	for _, song := range songs {
+		if f.Match(song) {
+			kept = append(kept, song)
+		}
+	}
+	return kept
+}
+
+func (f SongFilter) FilterEntries(entries []PlaylistEntry) []PlaylistEntry {
+	return filterEntries(entries, func(entry PlaylistEntry) bool {
+		return f.Match(entry.Song)
+	})
+}
+
+// reads genre, tag, language, explicit, minbpm and maxbpm
+func ParseSongFilter(values url.Values) (SongFilter, error) {
+	filter := SongFilter{
+		Genre:    strings.ToLower(strings.TrimSpace(values.Get("genre"))),
+		Tag:      strings.ToLower(strings.TrimSpace(values.Get("tag"))),
+		Language: strings.ToLower(strings.TrimSpace(values.Get("language"))),
+	}
+
+	if explicit := values.Get("explicit"); explicit != "" {
+		b, err := strconv.ParseBool(explicit)
+		if err != nil {
+			return filter, errors.New("explicit must be true or false")
+		}
+		filter.Explicit = &b
+	}
+
+	var err error
+	if minbpm := values.Get("minbpm"); minbpm != "" {
+		if filter.MinBPM, err = strconv.Atoi(minbpm); err != nil {
+			return filter, errors.New("minbpm must be a number")
+		}
+	}
+	if maxbpm := values.Get("maxbpm"); maxbpm != "" {
+		if filter.MaxBPM, err = strconv.Atoi(maxbpm); err != nil {
+			return filter, errors.New("maxbpm must be a number")
+		}
+	}
+	return filter, nil
+}
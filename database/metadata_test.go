@@ -0,0 +1,123 @@
+package database
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSongFilter(t *testing.T) {
+	yes, no := true, false
+	tests := []struct {
+		name    string
+		query   string
+		want    SongFilter
+		wantErr bool
+	}{
+		{"empty", "", SongFilter{}, false},
+		{"labels normalized", "genre=%20Rock%20&tag=Chill&language=PL", SongFilter{Genre: "rock", Tag: "chill", Language: "pl"}, false},
+		{"explicit", "explicit=true", SongFilter{Explicit: &yes}, false},
+		{"clean", "explicit=0", SongFilter{Explicit: &no}, false},
+		{"bpm range", "minbpm=90&maxbpm=120", SongFilter{MinBPM: 90, MaxBPM: 120}, false},
+		{"invalid explicit", "explicit=maybe", SongFilter{}, true},
+		{"invalid minbpm", "minbpm=fast", SongFilter{}, true},
+		{"invalid maxbpm", "maxbpm=1.5", SongFilter{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ParseSongFilter(values)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("filter = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSongFilterMatch(t *testing.T) {
+	yes := true
+	song := SongData{Genres: []string{"rock"}, Tags: []string{"chill"}, Language: "pl", BPM: 100}
+	tests := []struct {
+		name   string
+		filter SongFilter
+		song   SongData
+		want   bool
+	}{
+		{"everything", SongFilter{}, song, true},
+		{"genre", SongFilter{Genre: "rock"}, song, true},
+		{"other genre", SongFilter{Genre: "jazz"}, song, false},
+		{"tag", SongFilter{Tag: "chill"}, song, true},
+		{"other language", SongFilter{Language: "en"}, song, false},
+		{"clean song", SongFilter{Explicit: &yes}, song, false},
+		{"within bpm range", SongFilter{MinBPM: 90, MaxBPM: 110}, song, true},
+		{"too slow", SongFilter{MinBPM: 120}, song, false},
+		{"unknown bpm", SongFilter{MaxBPM: 110}, SongData{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(tt.song); got != tt.want {
+				t.Errorf("Match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitTags(t *testing.T) {
+	tests := []struct {
+		list string
+		want []string
+	}{
+		{"", nil},
+		{"rock", []string{"rock"}},
+		{" Rock , pop,,rock ", []string{"rock", "pop"}},
+	}
+
+	for _, tt := range tests {
+		if got := SplitTags(tt.list); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitTags(%q) = %v, want %v", tt.list, got, tt.want)
+		}
+	}
+}
+
+func TestSongDataValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		song    SongData
+		want    SongData
+		wantErr bool
+	}{
+		{"empty", SongData{}, SongData{}, false},
+		{
+			name: "normalized",
+			song: SongData{Language: " PL ", ISRC: "pl-a01-26-00001", Genres: []string{"Rock", "rock"}, Tags: []string{" Chill"}},
+			want: SongData{Language: "pl", ISRC: "PLA012600001", Genres: []string{"rock"}, Tags: []string{"chill"}},
+		},
+		{"negative bpm", SongData{BPM: -1}, SongData{}, true},
+		{"too fast", SongData{BPM: 401}, SongData{}, true},
+		{"language name", SongData{Language: "polish"}, SongData{}, true},
+		{"short isrc", SongData{ISRC: "PL-A01-26-001"}, SongData{}, true},
+		{"long tag", SongData{Tags: []string{strings.Repeat("a", 65)}}, SongData{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			song := tt.song
+			err := song.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(song, tt.want) {
+				t.Errorf("song = %+v, want %+v", song, tt.want)
+			}
+		})
+	}
+}
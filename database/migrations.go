@@ -0,0 +1,265 @@
+package database
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrations/NNNN_name.up.sql applies a schema change, NNNN_name.down.sql reverts it
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationState struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Migrator is implemented by stores which have a versioned schema
+type Migrator interface {
+	Migrate() error
+	MigrationStatus() ([]MigrationState, error)
+	// reverts every applied migration newer than version
+	Rollback(version int) error
+}
+
+// Go steps run right after the SQL of the same version has been applied
+var migrationHooks = map[int]func(s *mysqlStore) error{
+	2: convertLegacySchedules,
+	7: numberPlaylistEntries,
+}
+
+var ErrNoMigrations = errors.New("database backend has no schema migrations")
+
+func Migrate() error {
+	m, ok := store.(Migrator)
+	if !ok {
+		return ErrNoMigrations
+	}
+	return m.Migrate()
+}
+
+func MigrationStatus() ([]MigrationState, error) {
+	m, ok := store.(Migrator)
+	if !ok {
+		return nil, ErrNoMigrations
+	}
+	return m.MigrationStatus()
+}
+
+func Rollback(version int) error {
+	m, ok := store.(Migrator)
+	if !ok {
+		return ErrNoMigrations
+	}
+	return m.Rollback(version)
+}
+
+// returns the embedded migrations sorted by version
+func loadMigrations() ([]Migration, error) {
+	files, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, file := range files {
+		name := file.Name()
+		var direction string
+		if strings.HasSuffix(name, ".up.sql") {
+			direction = "up"
+		} else if strings.HasSuffix(name, ".down.sql") {
+			direction = "down"
+		} else {
+			return nil, fmt.Errorf("migration %s is neither .up.sql nor .down.sql", name)
+		}
+
+		underscore := strings.Index(name, "_")
+		if underscore < 0 {
+			return nil, fmt.Errorf("migration %s has no version prefix", name)
+		}
+		version, err := strconv.Atoi(name[:underscore])
+		if err != nil {
+			return nil, fmt.Errorf("migration %s has an invalid version: %v", name, err)
+		}
+
+		content, err := migrationFiles.ReadFile(path.Join("migrations", name))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: strings.TrimSuffix(name[underscore+1:], "."+direction+".sql")}
+			byVersion[version] = migration
+		}
+		if direction == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	var migrations []Migration
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d (%s) needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// splits a migration script into single statements,
+// since the driver doesn't run more than one per Exec
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSpace(current.String()))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
+
+func (s *mysqlStore) appliedVersions() (map[int]time.Time, error) {
+	if _, err := s.db.Exec(CreateSchemaVersionCmd); err != nil {
+		return nil, fmt.Errorf("couldn't prepare schema_version table: %v", err)
+	}
+
+	rows, err := s.db.Query(GetSchemaVersionsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+func (s *mysqlStore) runScript(script string) error {
+	for _, statement := range splitStatements(script) {
+		if _, err := s.db.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applies all pending migrations in order
+func (s *mysqlStore) Migrate() error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	applied, err := s.appliedVersions()
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		log.Printf("Applying migration %04d_%s\n", migration.Version, migration.Name)
+		if err := s.runScript(migration.Up); err != nil {
+			return fmt.Errorf("migration %04d_%s failed: %v", migration.Version, migration.Name, err)
+		}
+		if hook, ok := migrationHooks[migration.Version]; ok {
+			if err := hook(s); err != nil {
+				return fmt.Errorf("migration %04d_%s failed: %v", migration.Version, migration.Name, err)
+			}
+		}
+		if _, err := s.db.Exec(AddSchemaVersionCmd, migration.Version, migration.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *mysqlStore) MigrationStatus() ([]MigrationState, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := s.appliedVersions()
+	if err != nil {
+		return nil, err
+	}
+
+	var states []MigrationState
+	for _, migration := range migrations {
+		appliedAt, ok := applied[migration.Version]
+		states = append(states, MigrationState{Migration: migration, Applied: ok, AppliedAt: appliedAt})
+	}
+	return states, nil
+}
+
+func (s *mysqlStore) Rollback(version int) error {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	applied, err := s.appliedVersions()
+	if err != nil {
+		return err
+	}
+
+	// newest first
+	for i := len(migrations) - 1; i >= 0; i-- {
+		migration := migrations[i]
+		if migration.Version <= version {
+			break
+		}
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+
+		log.Printf("Reverting migration %04d_%s\n", migration.Version, migration.Name)
+		if err := s.runScript(migration.Down); err != nil {
+			return fmt.Errorf("rollback of %04d_%s failed: %v", migration.Version, migration.Name, err)
+		}
+		if _, err := s.db.Exec(DelSchemaVersionCmd, migration.Version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
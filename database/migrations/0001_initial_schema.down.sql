@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS schedule;
+DROP TABLE IF EXISTS votes;
+DROP TABLE IF EXISTS playlist_entries;
+DROP TABLE IF EXISTS playlists;
+DROP TABLE IF EXISTS songs;
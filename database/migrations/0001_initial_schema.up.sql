@@ -0,0 +1,48 @@
+CREATE TABLE IF NOT EXISTS playlists (
+	playlist_id int PRIMARY KEY NOT NULL AUTO_INCREMENT,
+
+	title VARCHAR(256) NOT NULL,
+	description VARCHAR(256) NOT NULL,
+	-- 0 is false, 1 is true
+	ranking int NOT NULL,
+
+	debuted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS playlist_entries (
+
+	playlist_id int NOT NULL,
+	song_id int NOT NULL,
+
+	debuted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS songs (
+	song_id int PRIMARY KEY NOT NULL AUTO_INCREMENT,
+
+	authors VARCHAR(128) NOT NULL,
+	title VARCHAR(256) NOT NULL,
+	youtube_id VARCHAR(16) NOT NULL,
+	length_seconds int NOT NULL,
+	release_date DATE,
+
+	debuted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS votes (
+	-- take the uuid from microsoft by calling an API endpoint with provided accesstoken
+	student VARCHAR(256) NOT NULL,
+
+	-- 0 if downvote, 1 if upvote
+	vote_type int NOT NULL,
+	song_id int NOT NULL,
+
+	submitted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS schedule (
+	date_at DATE NOT NULL PRIMARY KEY,
+	content TEXT NOT NULL,
+
+	submitted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS schedule_files;
+DROP TABLE IF EXISTS schedule_blocks;
@@ -0,0 +1,30 @@
+-- one row per plan block instead of a base64 json blob per day
+-- the old schedule table is left in place; its rows are converted once by convertLegacySchedules
+CREATE TABLE IF NOT EXISTS schedule_blocks (
+	block_id int PRIMARY KEY NOT NULL AUTO_INCREMENT,
+
+	date_at DATE NOT NULL,
+	-- order of the block within its day
+	position int NOT NULL,
+	start_at DATETIME NOT NULL,
+	end_at DATETIME NOT NULL,
+	-- playlist | silence | file
+	block_type VARCHAR(16) NOT NULL,
+	-- only set for playlist blocks
+	playlist_id int,
+
+	submitted_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+	INDEX schedule_blocks_date (date_at, position),
+	INDEX schedule_blocks_range (start_at, end_at),
+	INDEX schedule_blocks_playlist (playlist_id)
+);
+
+-- locations played by file blocks
+CREATE TABLE IF NOT EXISTS schedule_files (
+	block_id int NOT NULL,
+	position int NOT NULL,
+	location VARCHAR(1024) NOT NULL,
+
+	PRIMARY KEY (block_id, position)
+);
@@ -0,0 +1,12 @@
+-- trashed rows would otherwise come back as live ones
+DELETE FROM songs WHERE deleted_at IS NOT NULL;
+DELETE FROM playlists WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE playlists DROP COLUMN deleted_at;
+ALTER TABLE songs DROP COLUMN deleted_at;
+
+ALTER TABLE schedule_files DROP FOREIGN KEY schedule_files_block;
+ALTER TABLE votes DROP FOREIGN KEY votes_song;
+ALTER TABLE playlist_entries
+	DROP FOREIGN KEY playlist_entries_playlist,
+	DROP FOREIGN KEY playlist_entries_song;
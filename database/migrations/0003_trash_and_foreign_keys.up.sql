@@ -0,0 +1,18 @@
+-- drop rows left behind by hard deletes before foreign keys existed
+DELETE FROM playlist_entries WHERE song_id NOT IN (SELECT song_id FROM songs);
+DELETE FROM playlist_entries WHERE playlist_id NOT IN (SELECT playlist_id FROM playlists);
+DELETE FROM votes WHERE song_id NOT IN (SELECT song_id FROM songs);
+
+ALTER TABLE playlist_entries
+	ADD CONSTRAINT playlist_entries_playlist FOREIGN KEY (playlist_id) REFERENCES playlists(playlist_id) ON DELETE CASCADE,
+	ADD CONSTRAINT playlist_entries_song FOREIGN KEY (song_id) REFERENCES songs(song_id) ON DELETE CASCADE;
+
+ALTER TABLE votes
+	ADD CONSTRAINT votes_song FOREIGN KEY (song_id) REFERENCES songs(song_id) ON DELETE CASCADE;
+
+ALTER TABLE schedule_files
+	ADD CONSTRAINT schedule_files_block FOREIGN KEY (block_id) REFERENCES schedule_blocks(block_id) ON DELETE CASCADE;
+
+-- deleted songs and playlists stay in the trash until they are restored or purged
+ALTER TABLE songs ADD COLUMN deleted_at TIMESTAMP NULL DEFAULT NULL;
+ALTER TABLE playlists ADD COLUMN deleted_at TIMESTAMP NULL DEFAULT NULL;
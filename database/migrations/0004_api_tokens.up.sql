@@ -0,0 +1,12 @@
+-- bearer tokens for the admin endpoints; only a sha256 of each token is kept
+CREATE TABLE IF NOT EXISTS api_tokens (
+	token_id int PRIMARY KEY NOT NULL AUTO_INCREMENT,
+
+	name VARCHAR(128) NOT NULL,
+	token_hash CHAR(64) NOT NULL,
+
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	revoked_at TIMESTAMP NULL DEFAULT NULL,
+
+	UNIQUE INDEX api_tokens_hash (token_hash)
+);
@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS song_tags;
+DROP TABLE IF EXISTS tags;
+
+ALTER TABLE songs
+	DROP COLUMN isrc,
+	DROP COLUMN explicit,
+	DROP COLUMN language,
+	DROP COLUMN bpm;
@@ -0,0 +1,26 @@
+ALTER TABLE songs
+	-- 0 if unknown
+	ADD COLUMN bpm int NOT NULL DEFAULT 0,
+	-- ISO 639-1 code, empty if unknown
+	ADD COLUMN language VARCHAR(8) NOT NULL DEFAULT '',
+	ADD COLUMN explicit BOOLEAN NOT NULL DEFAULT FALSE,
+	ADD COLUMN isrc VARCHAR(12) NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS tags (
+	tag_id int PRIMARY KEY NOT NULL AUTO_INCREMENT,
+
+	-- genre | tag
+	kind VARCHAR(16) NOT NULL,
+	name VARCHAR(64) NOT NULL,
+
+	UNIQUE KEY tags_name (kind, name)
+);
+
+CREATE TABLE IF NOT EXISTS song_tags (
+	song_id int NOT NULL,
+	tag_id int NOT NULL,
+
+	PRIMARY KEY (song_id, tag_id),
+	CONSTRAINT song_tags_song FOREIGN KEY (song_id) REFERENCES songs(song_id) ON DELETE CASCADE,
+	CONSTRAINT song_tags_tag FOREIGN KEY (tag_id) REFERENCES tags(tag_id) ON DELETE CASCADE
+);
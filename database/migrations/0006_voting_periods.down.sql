@@ -0,0 +1,3 @@
+DROP INDEX votes_submitted ON votes;
+DROP TABLE IF EXISTS period_results;
+DROP TABLE IF EXISTS voting_periods;
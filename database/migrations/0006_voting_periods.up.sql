@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS voting_periods (
+	period_id int PRIMARY KEY NOT NULL AUTO_INCREMENT,
+
+	name VARCHAR(128) NOT NULL,
+	-- weekly | semester | custom
+	kind VARCHAR(16) NOT NULL,
+	-- votes submitted in [starts_at, ends_at) count towards the period
+	starts_at DATETIME NOT NULL,
+	ends_at DATETIME NOT NULL,
+	-- set once the results have been archived
+	closed_at TIMESTAMP NULL DEFAULT NULL,
+
+	INDEX voting_periods_range (starts_at, ends_at)
+);
+
+-- chart of a closed period; authors and title are copied so purged songs stay on old charts
+CREATE TABLE IF NOT EXISTS period_results (
+	period_id int NOT NULL,
+	position int NOT NULL,
+	song_id int NOT NULL,
+	authors VARCHAR(128) NOT NULL,
+	title VARCHAR(256) NOT NULL,
+	upvotes int NOT NULL,
+	downvotes int NOT NULL,
+
+	PRIMARY KEY (period_id, position),
+	INDEX period_results_song (song_id),
+	CONSTRAINT period_results_period FOREIGN KEY (period_id) REFERENCES voting_periods(period_id) ON DELETE CASCADE
+);
+
+CREATE INDEX votes_submitted ON votes (submitted_at, song_id);
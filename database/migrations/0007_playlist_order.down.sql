@@ -0,0 +1,10 @@
+ALTER TABLE playlists DROP COLUMN playback_mode;
+
+-- adding playlist_entries_position dropped the index MySQL made for the playlist foreign key,
+-- which needs one again before the composite index can go
+ALTER TABLE playlist_entries ADD INDEX playlist_entries_playlist (playlist_id);
+
+ALTER TABLE playlist_entries
+	DROP INDEX playlist_entries_position,
+	DROP COLUMN position,
+	DROP COLUMN entry_id;
@@ -0,0 +1,9 @@
+-- entries get an identity so the same song can sit in a playlist more than once
+ALTER TABLE playlist_entries
+	ADD COLUMN entry_id int NOT NULL AUTO_INCREMENT PRIMARY KEY FIRST,
+	-- 1-based running order within the playlist, filled in by the migration hook
+	ADD COLUMN position int NOT NULL DEFAULT 0,
+	ADD INDEX playlist_entries_position (playlist_id, position);
+
+-- shuffle | ordered
+ALTER TABLE playlists ADD COLUMN playback_mode VARCHAR(16) NOT NULL DEFAULT 'shuffle';
@@ -0,0 +1,3 @@
+ALTER TABLE songs
+	DROP COLUMN true_peak_dbtp,
+	DROP COLUMN loudness_lufs;
@@ -0,0 +1,4 @@
+ALTER TABLE songs
+	-- integrated loudness in LUFS and true peak in dBTP, NULL until the song is analysed
+	ADD COLUMN loudness_lufs DOUBLE NULL DEFAULT NULL,
+	ADD COLUMN true_peak_dbtp DOUBLE NULL DEFAULT NULL;
@@ -0,0 +1,5 @@
+ALTER TABLE songs
+	DROP COLUMN cue_out_ms,
+	DROP COLUMN outro_start_ms,
+	DROP COLUMN intro_end_ms,
+	DROP COLUMN cue_in_ms;
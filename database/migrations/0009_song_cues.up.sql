@@ -0,0 +1,7 @@
+ALTER TABLE songs
+	-- in milliseconds from the start of the audio, NULL until the song is analysed or cued by hand;
+	-- intro_end_ms and outro_start_ms are 0 if the song has no such part
+	ADD COLUMN cue_in_ms int NULL DEFAULT NULL,
+	ADD COLUMN intro_end_ms int NULL DEFAULT NULL,
+	ADD COLUMN outro_start_ms int NULL DEFAULT NULL,
+	ADD COLUMN cue_out_ms int NULL DEFAULT NULL;
@@ -0,0 +1,14 @@
+-- what duplicate detection knows about the audio of each song
+CREATE TABLE IF NOT EXISTS song_fingerprints (
+	song_id int PRIMARY KEY NOT NULL,
+
+	-- sha256 of the audio file, hex encoded; the fingerprint is redone when it changes
+	content_hash CHAR(64) NOT NULL,
+	-- 16 bits per 100 ms of audio
+	fingerprint MEDIUMBLOB NOT NULL,
+
+	analysed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+	INDEX song_fingerprints_hash (content_hash),
+	CONSTRAINT song_fingerprints_song FOREIGN KEY (song_id) REFERENCES songs(song_id) ON DELETE CASCADE
+);
@@ -0,0 +1 @@
+ALTER TABLE voting_periods DROP INDEX voting_periods_start;
@@ -0,0 +1,5 @@
+-- weekly periods created twice by concurrent requests; the first one is kept
+DELETE dup FROM voting_periods dup
+	JOIN voting_periods kept ON kept.kind = dup.kind AND kept.starts_at = dup.starts_at AND kept.period_id < dup.period_id;
+
+ALTER TABLE voting_periods ADD UNIQUE INDEX voting_periods_start (kind, starts_at);
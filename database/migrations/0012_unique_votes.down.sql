@@ -0,0 +1,4 @@
+ALTER TABLE votes
+	DROP INDEX votes_student_week,
+	DROP COLUMN week_start,
+	DROP COLUMN vote_id;
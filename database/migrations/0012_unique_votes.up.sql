@@ -0,0 +1,14 @@
+-- votes get an identity so duplicates can be told apart
+ALTER TABLE votes ADD COLUMN vote_id int NOT NULL AUTO_INCREMENT PRIMARY KEY FIRST;
+
+-- monday of the week the vote counts towards, as returned by WeekBounds
+ALTER TABLE votes ADD COLUMN week_start DATE NULL;
+UPDATE votes SET week_start = DATE_SUB(DATE(submitted_at), INTERVAL WEEKDAY(submitted_at) DAY);
+ALTER TABLE votes MODIFY week_start DATE NOT NULL;
+
+-- votes cast twice in a week by concurrent requests; the latest one is kept
+DELETE dup FROM votes dup
+	JOIN votes kept ON kept.student = dup.student AND kept.song_id = dup.song_id AND kept.week_start = dup.week_start
+		AND (kept.submitted_at > dup.submitted_at OR (kept.submitted_at = dup.submitted_at AND kept.vote_id > dup.vote_id));
+
+ALTER TABLE votes ADD UNIQUE INDEX votes_student_week (student, song_id, week_start);
@@ -0,0 +1 @@
+ALTER TABLE schedule_blocks DROP FOREIGN KEY schedule_blocks_playlist;
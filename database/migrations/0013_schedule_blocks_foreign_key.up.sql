@@ -0,0 +1,5 @@
+-- blocks of playlists purged before the foreign key existed; their files go with them
+DELETE FROM schedule_blocks WHERE playlist_id IS NOT NULL AND playlist_id NOT IN (SELECT playlist_id FROM playlists);
+
+ALTER TABLE schedule_blocks
+	ADD CONSTRAINT schedule_blocks_playlist FOREIGN KEY (playlist_id) REFERENCES playlists(playlist_id) ON DELETE CASCADE;
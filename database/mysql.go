@@ -0,0 +1,1083 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// MySQL-backed store
+type mysqlStore struct {
+	db *sql.DB
+}
+
+func NewMySQLStore(dsn string) (Store, error) {
+	db, err := sql.Open("mysql", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open database connection: %v", err)
+	}
+
+	err = db.Ping()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't ping database connection: %v", err)
+	}
+
+	db.SetConnMaxLifetime(0)
+	db.SetMaxOpenConns(50)
+	db.SetMaxIdleConns(50)
+
+	s := &mysqlStore{db: db}
+	if err := s.Migrate(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// common interface of *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// common interface of *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// genres and tags are loaded separately by loadTags
+func scanSong(row rowScanner, song *SongData) error {
+	var integrated, truePeak sql.NullFloat64
+	var cueIn, introEnd, outroStart, cueOut sql.NullInt32
+	err := row.Scan(&song.SongId, &song.Authors, &song.Title, &song.YTId, &song.Length, &song.ReleaseDate, &song.DebutedAt, &song.DeletedAt,
+		&song.BPM, &song.Language, &song.Explicit, &song.ISRC, &integrated, &truePeak, &cueIn, &introEnd, &outroStart, &cueOut)
+	if err == nil && integrated.Valid && truePeak.Valid {
+		song.Loudness = &Loudness{Integrated: integrated.Float64, TruePeak: truePeak.Float64}
+	}
+	if err == nil && cueIn.Valid && cueOut.Valid {
+		song.Cues = &Cues{CueIn: int(cueIn.Int32), IntroEnd: int(introEnd.Int32), OutroStart: int(outroStart.Int32), CueOut: int(cueOut.Int32)}
+	}
+	return err
+}
+
+func scanPlaylist(row rowScanner, playlist *Playlist) error {
+	return row.Scan(&playlist.Id, &playlist.Name, &playlist.Desc, &playlist.Rank, &playlist.Mode, &playlist.DebutDate, &playlist.DeletedAt)
+}
+
+// turns an update which touched no rows into ErrNotFound
+func expectAffected(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *mysqlStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *mysqlStore) Playlists() ([]Playlist, error) {
+	return s.queryPlaylists(GetPlaylistListQuery)
+}
+
+func (s *mysqlStore) TrashedPlaylists() ([]Playlist, error) {
+	return s.queryPlaylists(GetTrashedPlaylistsQuery)
+}
+
+func (s *mysqlStore) queryPlaylists(query string, args ...interface{}) ([]Playlist, error) {
+	results, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	var playlists []Playlist
+	for results.Next() {
+		var playlist Playlist
+
+		err = scanPlaylist(results, &playlist)
+		if err != nil {
+			return playlists, err
+		}
+		playlists = append(playlists, playlist)
+	}
+
+	return playlists, results.Err()
+}
+
+func (s *mysqlStore) AddPlaylist(playlist Playlist) (int, error) {
+	return addPlaylist(s.db, playlist)
+}
+
+func addPlaylist(db execer, playlist Playlist) (int, error) {
+	res, err := db.Exec(AddPlaylistCmd, playlist.Id, playlist.Name, playlist.Desc, playlist.Rank, playlist.Mode)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+func (s *mysqlStore) DelPlaylist(playlistid string) error {
+	return expectAffected(s.db.Exec(DelPlaylistCmd, playlistid))
+}
+
+func (s *mysqlStore) RestorePlaylist(playlistid string) error {
+	return expectAffected(s.db.Exec(RestorePlaylistCmd, playlistid))
+}
+
+func (s *mysqlStore) PlaylistEntries(playlistid string) ([]PlaylistEntry, error) {
+	results, err := s.db.Query(GetPlaylistSongsQuery, playlistid)
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	var playlistEntries []PlaylistEntry
+	for results.Next() {
+		var playlistEntry PlaylistEntry
+
+		row := entryScanner{results, &playlistEntry}
+		if err := scanSong(row, &playlistEntry.Song); err != nil {
+			return nil, err
+		}
+
+		playlistEntries = append(playlistEntries, playlistEntry)
+	}
+	if err := results.Err(); err != nil {
+		return nil, err
+	}
+
+	songs := make([]SongData, len(playlistEntries))
+	for i := range playlistEntries {
+		songs[i] = playlistEntries[i].Song
+	}
+	if err := s.loadTags(songs, GetPlaylistSongTagsQuery, playlistid); err != nil {
+		return nil, err
+	}
+	for i := range playlistEntries {
+		playlistEntries[i].Song = songs[i]
+	}
+	return playlistEntries, nil
+}
+
+// reads the entry columns which GetPlaylistSongsQuery puts in front of the song's
+type entryScanner struct {
+	row   rowScanner
+	entry *PlaylistEntry
+}
+
+func (e entryScanner) Scan(dest ...interface{}) error {
+	entry := []interface{}{&e.entry.PlaylistId, &e.entry.SongId, &e.entry.Position, &e.entry.DebutDate}
+	return e.row.Scan(append(entry, dest...)...)
+}
+
+func (s *mysqlStore) SetPlaylistMode(playlistid, mode string) error {
+	// unchanged rows don't count as affected, so existence is checked by the caller
+	_, err := s.db.Exec(SetPlaylistModeCmd, mode, playlistid)
+	return err
+}
+
+func (s *mysqlStore) AddSongToPlaylist(playlistid, songid string, position int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := addSongToPlaylist(tx, playlistid, songid, position); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func addSongToPlaylist(tx *sql.Tx, playlistid, songid string, position int) error {
+	var last int
+	if err := tx.QueryRow(GetLastPositionQuery, playlistid).Scan(&last); err != nil {
+		return err
+	}
+	if position <= 0 || position > last {
+		position = last + 1
+	} else if _, err := tx.Exec(ShiftPlaylistEntriesCmd, playlistid, position); err != nil {
+		return err
+	}
+
+	// inserts nothing when the playlist or the song is missing or in the trash
+	return expectAffected(tx.Exec(AddSongToPlaylistCmd, position, songid, playlistid))
+}
+
+func (s *mysqlStore) DelSongFromPlaylist(playlistid, songid string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(DelSongFromPlaylistCmd, playlistid, songid); err != nil {
+		return err
+	}
+	if err := reorderEntries(tx, playlistid, nil); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *mysqlStore) ReorderPlaylist(playlistid string, order []int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := reorderEntries(tx, playlistid, order); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// numbers the entries of a playlist from 1, putting the listed positions first
+func reorderEntries(tx *sql.Tx, playlistid interface{}, order []int) error {
+	rows, err := tx.Query(GetPlaylistPositionsQuery, playlistid)
+	if err != nil {
+		return err
+	}
+	var entryids []int
+	byPosition := map[int]int{}
+	for rows.Next() {
+		var entryid, position int
+		if err := rows.Scan(&entryid, &position); err != nil {
+			rows.Close()
+			return err
+		}
+		entryids = append(entryids, entryid)
+		byPosition[position] = entryid
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	placed := map[int]bool{}
+	var ordered []int
+	for _, position := range order {
+		entryid, ok := byPosition[position]
+		if !ok || placed[entryid] {
+			return ErrNotFound
+		}
+		placed[entryid] = true
+		ordered = append(ordered, entryid)
+	}
+	for _, entryid := range entryids {
+		if !placed[entryid] {
+			ordered = append(ordered, entryid)
+		}
+	}
+
+	for i, entryid := range ordered {
+		if _, err := tx.Exec(SetEntryPositionCmd, i+1, entryid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gives the entries of existing playlists their running order, oldest first
+func numberPlaylistEntries(s *mysqlStore) error {
+	rows, err := s.db.Query(GetOrderedPlaylistsQuery)
+	if err != nil {
+		return err
+	}
+	var playlistids []int
+	for rows.Next() {
+		var playlistid int
+		if err := rows.Scan(&playlistid); err != nil {
+			rows.Close()
+			return err
+		}
+		playlistids = append(playlistids, playlistid)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, playlistid := range playlistids {
+		if err := reorderEntries(tx, playlistid, nil); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *mysqlStore) Songs() ([]SongData, error) {
+	return s.querySongs(GetSongsQuery)
+}
+
+func (s *mysqlStore) TrashedSongs() ([]SongData, error) {
+	return s.querySongs(GetTrashedSongsQuery)
+}
+
+func (s *mysqlStore) querySongs(query string, args ...interface{}) ([]SongData, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var songs []SongData
+	for rows.Next() {
+		var song SongData
+
+		err := scanSong(rows, &song)
+		if err != nil {
+			return nil, err
+		}
+
+		songs = append(songs, song)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return songs, s.loadTags(songs, GetAllSongTagsQuery)
+}
+
+// fills in genres and tags of the songs from the rows of query
+func (s *mysqlStore) loadTags(songs []SongData, query string, args ...interface{}) error {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	type labels struct{ genres, tags []string }
+	bySong := map[int]*labels{}
+	for rows.Next() {
+		var songid int
+		var kind, name string
+		if err := rows.Scan(&songid, &kind, &name); err != nil {
+			return err
+		}
+		l, ok := bySong[songid]
+		if !ok {
+			l = &labels{}
+			bySong[songid] = l
+		}
+		if kind == TagGenre {
+			l.genres = append(l.genres, name)
+		} else {
+			l.tags = append(l.tags, name)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range songs {
+		if l, ok := bySong[songs[i].SongId]; ok {
+			songs[i].Genres = l.genres
+			songs[i].Tags = l.tags
+		}
+	}
+	return nil
+}
+
+// replaces the genres and tags of a song
+func setTags(tx *sql.Tx, songid int64, song SongData) error {
+	if _, err := tx.Exec(DelSongTagsCmd, songid); err != nil {
+		return err
+	}
+
+	for kind, names := range map[string][]string{TagGenre: song.Genres, TagPlain: song.Tags} {
+		for _, name := range names {
+			res, err := tx.Exec(AddTagCmd, kind, name)
+			if err != nil {
+				return err
+			}
+			tagid, err := res.LastInsertId()
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(AddSongTagCmd, songid, tagid); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *mysqlStore) Song(songid string) (*SongData, error) {
+	song := &SongData{}
+	err := scanSong(s.db.QueryRow(GetSongQuery, songid), song)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	songs := []SongData{*song}
+	if err := s.loadTags(songs, GetSongTagsQuery, song.SongId); err != nil {
+		return nil, err
+	}
+	return &songs[0], nil
+}
+
+func (s *mysqlStore) AddSong(song SongData) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	songid, err := addSong(tx, song)
+	if err != nil {
+		return 0, err
+	}
+	return songid, tx.Commit()
+}
+
+func addSong(tx *sql.Tx, song SongData) (int, error) {
+	var integrated, truePeak sql.NullFloat64
+	if song.Loudness != nil {
+		integrated = sql.NullFloat64{Float64: song.Loudness.Integrated, Valid: true}
+		truePeak = sql.NullFloat64{Float64: song.Loudness.TruePeak, Valid: true}
+	}
+	var cueIn, introEnd, outroStart, cueOut sql.NullInt32
+	if song.Cues != nil {
+		cueIn = sql.NullInt32{Int32: int32(song.Cues.CueIn), Valid: true}
+		introEnd = sql.NullInt32{Int32: int32(song.Cues.IntroEnd), Valid: true}
+		outroStart = sql.NullInt32{Int32: int32(song.Cues.OutroStart), Valid: true}
+		cueOut = sql.NullInt32{Int32: int32(song.Cues.CueOut), Valid: true}
+	}
+	res, err := tx.Exec(AddSongCmd, song.SongId, song.Authors, song.Title, song.YTId, song.Length, song.ReleaseDate,
+		song.BPM, song.Language, song.Explicit, song.ISRC, integrated, truePeak, cueIn, introEnd, outroStart, cueOut)
+	if err != nil {
+		return 0, err
+	}
+	songid, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if err := setTags(tx, songid, song); err != nil {
+		return 0, err
+	}
+	return int(songid), nil
+}
+
+func (s *mysqlStore) UpdateSong(song SongData) error {
+	// mysql reports unchanged rows as unaffected, so check for existence upfront
+	if _, err := s.Song(strconv.Itoa(song.SongId)); err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(UpdateSongCmd, song.Authors, song.Title, song.YTId, song.Length, song.ReleaseDate,
+		song.BPM, song.Language, song.Explicit, song.ISRC, song.SongId)
+	if err != nil {
+		return err
+	}
+	if err := setTags(tx, int64(song.SongId), song); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *mysqlStore) SetSongLoudness(songid int, loudness Loudness) error {
+	if _, err := s.Song(strconv.Itoa(songid)); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(SetSongLoudnessCmd, loudness.Integrated, loudness.TruePeak, songid)
+	return err
+}
+
+func (s *mysqlStore) SetSongCues(songid int, cues Cues) error {
+	if _, err := s.Song(strconv.Itoa(songid)); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(SetSongCuesCmd, cues.CueIn, cues.IntroEnd, cues.OutroStart, cues.CueOut, songid)
+	return err
+}
+
+func (s *mysqlStore) DelSong(songid string) error {
+	return expectAffected(s.db.Exec(DelSongCmd, songid))
+}
+
+func (s *mysqlStore) MergeSongs(keep, duplicate int) ([]int, error) {
+	for _, id := range []int{keep, duplicate} {
+		if _, err := s.Song(strconv.Itoa(id)); err != nil {
+			return nil, err
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(GetSongPlaylistsQuery, duplicate)
+	if err != nil {
+		return nil, err
+	}
+	var playlists []int
+	for rows.Next() {
+		var playlistid int
+		if err := rows.Scan(&playlistid); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		playlists = append(playlists, playlistid)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(DelMergedEntriesCmd, keep, duplicate); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(MoveSongEntriesCmd, keep, duplicate); err != nil {
+		return nil, err
+	}
+	for _, playlistid := range playlists {
+		if err := reorderEntries(tx, playlistid, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	kept, err := songVotes(tx, keep)
+	if err != nil {
+		return nil, err
+	}
+	duplicates, err := songVotes(tx, duplicate)
+	if err != nil {
+		return nil, err
+	}
+	for _, vote := range clashingVotes(kept, duplicates) {
+		if _, err := tx.Exec(DelVoteCmd, duplicate, vote.Student, vote.SubmitDate); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := tx.Exec(MoveSongVotesCmd, keep, duplicate); err != nil {
+		return nil, err
+	}
+
+	if err := expectAffected(tx.Exec(DelSongCmd, duplicate)); err != nil {
+		return nil, err
+	}
+	return playlists, tx.Commit()
+}
+
+func songVotes(tx *sql.Tx, songid int) ([]Vote, error) {
+	rows, err := tx.Query(GetSongVotesQuery, songid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var votes []Vote
+	for rows.Next() {
+		var vote Vote
+		if err := rows.Scan(&vote.Student, &vote.VoteType, &vote.Song, &vote.SubmitDate); err != nil {
+			return nil, err
+		}
+		votes = append(votes, vote)
+	}
+	return votes, rows.Err()
+}
+
+func (s *mysqlStore) RestoreSong(songid string) error {
+	return expectAffected(s.db.Exec(RestoreSongCmd, songid))
+}
+
+// entries, votes and block files go with them through ON DELETE CASCADE
+func (s *mysqlStore) PurgeTrash(before time.Time) (int, error) {
+	var purged int64
+	for _, cmd := range []string{PurgeSongsCmd, PurgePlaylistsCmd} {
+		res, err := s.db.Exec(cmd, before)
+		if err != nil {
+			return int(purged), err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return int(purged), err
+		}
+		purged += affected
+	}
+	return int(purged), nil
+}
+
+func (s *mysqlStore) Fingerprints() ([]Fingerprint, error) {
+	rows, err := s.db.Query(GetFingerprintsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var fingerprints []Fingerprint
+	for rows.Next() {
+		var fingerprint Fingerprint
+		if err := rows.Scan(&fingerprint.SongId, &fingerprint.ContentHash, &fingerprint.Data); err != nil {
+			return nil, err
+		}
+		fingerprints = append(fingerprints, fingerprint)
+	}
+	return fingerprints, rows.Err()
+}
+
+func (s *mysqlStore) SetFingerprint(fingerprint Fingerprint) error {
+	if _, err := s.Song(strconv.Itoa(fingerprint.SongId)); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(SetFingerprintCmd, fingerprint.SongId, fingerprint.ContentHash, fingerprint.Data)
+	return err
+}
+
+func (s *mysqlStore) Votes(songid string, votetype int, from, to time.Time) ([]Vote, error) {
+	results, err := s.db.Query(GetVotesQuery, songid, votetype, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	var votes []Vote
+	for results.Next() {
+		var vote Vote
+
+		err = results.Scan(&vote.Student, &vote.VoteType, &vote.Song, &vote.SubmitDate)
+		if err != nil {
+			return nil, err
+		}
+		votes = append(votes, vote)
+	}
+
+	return votes, results.Err()
+}
+
+func (s *mysqlStore) UpdateVote(student, songid string, votetype int, from, to time.Time) error {
+	// votes_student_week makes a second vote in the same week replace the first
+	_, err := s.db.Exec(AddVoteCmd, student, votetype, songid, from.Format("2006-01-02"))
+	return err
+}
+
+func (s *mysqlStore) ImportVote(vote Vote) error {
+	return importVote(s.db, vote)
+}
+
+func importVote(db execer, vote Vote) error {
+	start, _ := WeekBounds(vote.SubmitDate)
+	_, err := db.Exec(ImportVoteCmd, vote.Student, vote.VoteType, vote.Song, vote.SubmitDate, start.Format("2006-01-02"))
+	return err
+}
+
+func (s *mysqlStore) VoteTallies(from, to time.Time) ([]Tally, error) {
+	rows, err := s.db.Query(GetVoteTalliesQuery, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tallies []Tally
+	for rows.Next() {
+		var tally Tally
+		if err := rows.Scan(&tally.SongId, &tally.Up, &tally.Down); err != nil {
+			return nil, err
+		}
+		tallies = append(tallies, tally)
+	}
+	return tallies, rows.Err()
+}
+
+func (s *mysqlStore) VotingPeriods() ([]VotingPeriod, error) {
+	rows, err := s.db.Query(GetVotingPeriodsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var periods []VotingPeriod
+	for rows.Next() {
+		var period VotingPeriod
+		err := rows.Scan(&period.Id, &period.Name, &period.Kind, &period.Start, &period.End, &period.ClosedAt)
+		if err != nil {
+			return nil, err
+		}
+		periods = append(periods, period)
+	}
+	return periods, rows.Err()
+}
+
+func (s *mysqlStore) AddVotingPeriod(period VotingPeriod) (int, error) {
+	res, err := s.db.Exec(AddVotingPeriodCmd, period.Name, period.Kind, period.Start, period.End)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+func (s *mysqlStore) EnsureVotingPeriod(period VotingPeriod) (int, error) {
+	// on a duplicate the existing row's id becomes the insert id
+	res, err := s.db.Exec(EnsureVotingPeriodCmd, period.Name, period.Kind, period.Start, period.End)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+func (s *mysqlStore) ClosePeriod(periodid int, chart []ChartPosition) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := expectAffected(tx.Exec(CloseVotingPeriodCmd, periodid)); err != nil {
+		return err
+	}
+	for _, pos := range chart {
+		_, err := tx.Exec(AddPeriodResultCmd, periodid, pos.Position, pos.SongId, pos.Authors, pos.Title, pos.Up, pos.Down)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *mysqlStore) PeriodResults(periodid int) ([]ChartPosition, error) {
+	rows, err := s.db.Query(GetPeriodResultsQuery, periodid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var chart []ChartPosition
+	for rows.Next() {
+		var pos ChartPosition
+		if err := rows.Scan(&pos.Position, &pos.SongId, &pos.Authors, &pos.Title, &pos.Up, &pos.Down); err != nil {
+			return nil, err
+		}
+		pos.Score = pos.Up - pos.Down
+		chart = append(chart, pos)
+	}
+	return chart, rows.Err()
+}
+
+func (s *mysqlStore) SongChart(songid string) ([]SongChartEntry, error) {
+	rows, err := s.db.Query(GetSongChartQuery, songid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []SongChartEntry
+	for rows.Next() {
+		var entry SongChartEntry
+		err := rows.Scan(&entry.PeriodId, &entry.Position, &entry.SongId, &entry.Authors, &entry.Title, &entry.Up, &entry.Down)
+		if err != nil {
+			return nil, err
+		}
+		entry.Score = entry.Up - entry.Down
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// scans schedule_blocks rows and loads the file locations of file blocks
+func (s *mysqlStore) scanBlocks(rows *sql.Rows) ([]ScheduledBlock, error) {
+	defer rows.Close()
+
+	var blocks []ScheduledBlock
+	var blockids []int
+	for rows.Next() {
+		var blockid int
+		var date, start, end time.Time
+		var typename string
+		var playlistid sql.NullInt64
+
+		err := rows.Scan(&blockid, &date, &start, &end, &typename, &playlistid)
+		if err != nil {
+			return nil, err
+		}
+
+		var plid string
+		if playlistid.Valid {
+			plid = strconv.FormatInt(playlistid.Int64, 10)
+		}
+		blocks = append(blocks, ScheduledBlock{
+			Date:      date.Format("2006-01-02"),
+			PlanBlock: NewPlanBlock(typename, start, end, plid, nil),
+		})
+		blockids = append(blockids, blockid)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range blocks {
+		if !blocks[i].Type.File.Active {
+			continue
+		}
+		locations, err := s.scheduleFiles(blockids[i])
+		if err != nil {
+			return nil, err
+		}
+		blocks[i].Type.File.Location = locations
+	}
+	return blocks, nil
+}
+
+func (s *mysqlStore) scheduleFiles(blockid int) ([]string, error) {
+	rows, err := s.db.Query(GetScheduleFilesQuery, blockid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var locations []string
+	for rows.Next() {
+		var location string
+		if err := rows.Scan(&location); err != nil {
+			return nil, err
+		}
+		locations = append(locations, location)
+	}
+	return locations, rows.Err()
+}
+
+func (s *mysqlStore) Schedule(date string) (Schedule, error) {
+	rows, err := s.db.Query(GetScheduleBlocksQuery, date)
+	if err != nil {
+		return nil, err
+	}
+	blocks, err := s.scanBlocks(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	var schedule Schedule
+	for _, block := range blocks {
+		schedule = append(schedule, block.PlanBlock)
+	}
+	return schedule, nil
+}
+
+func (s *mysqlStore) SetSchedule(date string, schedule Schedule) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := setSchedule(tx, date, schedule); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func setSchedule(tx *sql.Tx, date string, schedule Schedule) error {
+	if _, err := tx.Exec(DelScheduleFilesCmd, date); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(DelScheduleBlocksCmd, date); err != nil {
+		return err
+	}
+
+	for position, plan := range schedule {
+		var playlistid interface{}
+		if plan.Type.Playlist.Active {
+			plid, err := strconv.Atoi(plan.Type.Playlist.PlaylistId)
+			if err != nil {
+				return fmt.Errorf("block %d: invalid playlist id '%s'", position, plan.Type.Playlist.PlaylistId)
+			}
+			playlistid = plid
+		}
+
+		res, err := tx.Exec(AddScheduleBlockCmd, date, position, plan.Range.Start, plan.Range.End, plan.TypeName(), playlistid)
+		if err != nil {
+			return err
+		}
+
+		if !plan.Type.File.Active {
+			continue
+		}
+		blockid, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		for filepos, location := range plan.Type.File.Location {
+			if _, err := tx.Exec(AddScheduleFileCmd, blockid, filepos, location); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *mysqlStore) ScheduleBlocks(q ScheduleQuery) ([]ScheduledBlock, error) {
+	var from, to, playlistid interface{}
+	if !q.From.IsZero() {
+		from = q.From
+	}
+	if !q.To.IsZero() {
+		to = q.To
+	}
+	if q.PlaylistId != "" {
+		playlistid = q.PlaylistId
+	}
+
+	rows, err := s.db.Query(FindScheduleBlocksQuery, from, from, to, to, playlistid, playlistid)
+	if err != nil {
+		return nil, err
+	}
+	return s.scanBlocks(rows)
+}
+
+// converts the base64 json blobs of the old schedule table into schedule blocks.
+// Runs once, as part of migration 2.
+func convertLegacySchedules(s *mysqlStore) error {
+	rows, err := s.db.Query(GetLegacySchedulesQuery)
+	if err != nil {
+		return err
+	}
+
+	legacy := map[string]string{}
+	for rows.Next() {
+		var date time.Time
+		var raw string
+		if err := rows.Scan(&date, &raw); err != nil {
+			rows.Close()
+			return err
+		}
+		legacy[date.Format("2006-01-02")] = raw
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for date, raw := range legacy {
+		var schedule Schedule
+		rawdecode, err := base64.StdEncoding.DecodeString(raw)
+		if err == nil {
+			err = json.Unmarshal(rawdecode, &schedule)
+		}
+		if err != nil {
+			log.Printf("Skipping unreadable schedule for %s: %v\n", date, err)
+			continue
+		}
+
+		if err := s.SetSchedule(date, schedule); err != nil {
+			return fmt.Errorf("couldn't convert schedule for %s: %v", date, err)
+		}
+	}
+	log.Printf("Converted %d legacy schedules\n", len(legacy))
+	return nil
+}
+
+func (s *mysqlStore) APITokens() ([]APIToken, error) {
+	rows, err := s.db.Query(GetAPITokensQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []APIToken
+	for rows.Next() {
+		var token APIToken
+		if err := rows.Scan(&token.Id, &token.Name, &token.CreatedAt, &token.RevokedAt); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+func (s *mysqlStore) APITokenByHash(hash string) (*APIToken, error) {
+	var token APIToken
+	err := s.db.QueryRow(FindAPITokenQuery, hash).Scan(&token.Id, &token.Name, &token.CreatedAt, &token.RevokedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (s *mysqlStore) AddAPIToken(name, hash string) (int, error) {
+	res, err := s.db.Exec(AddAPITokenCmd, name, hash)
+	if err != nil {
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	return int(id), err
+}
+
+func (s *mysqlStore) RevokeAPIToken(tokenid int) error {
+	return expectAffected(s.db.Exec(RevokeAPITokenCmd, tokenid))
+}
+
+// the writes of Import, all in the same transaction
+type mysqlImportTx struct {
+	tx *sql.Tx
+}
+
+func (s *mysqlStore) Import(fn func(tx ImportTx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(&mysqlImportTx{tx}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (t *mysqlImportTx) AddSong(song SongData) (int, error) {
+	return addSong(t.tx, song)
+}
+
+func (t *mysqlImportTx) AddPlaylist(playlist Playlist) (int, error) {
+	return addPlaylist(t.tx, playlist)
+}
+
+func (t *mysqlImportTx) AddSongToPlaylist(playlistid, songid string, position int) error {
+	return addSongToPlaylist(t.tx, playlistid, songid, position)
+}
+
+func (t *mysqlImportTx) ImportVote(vote Vote) error {
+	return importVote(t.tx, vote)
+}
+
+func (t *mysqlImportTx) SetSchedule(date string, schedule Schedule) error {
+	return setSchedule(t.tx, date, schedule)
+}
@@ -0,0 +1,233 @@
+package database
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// kinds of voting periods
+const (
+	PeriodWeekly   = "weekly"
+	PeriodSemester = "semester"
+	PeriodCustom   = "custom"
+)
+
+// votes submitted in [Start, End) count towards the period. Weekly periods are
+// created automatically, every period's chart is archived once it ends.
+type VotingPeriod struct {
+	Id    int       `json:"id"`
+	Name  string    `json:"name"`
+	Kind  string    `json:"kind"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// set once the chart has been archived
+	ClosedAt *time.Time `json:"closed_at,omitempty"`
+}
+
+func (p VotingPeriod) Contains(t time.Time) bool {
+	return !t.Before(p.Start) && t.Before(p.End)
+}
+
+// up and down votes of a song within a time range
+type Tally struct {
+	SongId int `json:"song_id"`
+	Up     int `json:"upvotes"`
+	Down   int `json:"downvotes"`
+}
+
+func (t Tally) Score() int {
+	return t.Up - t.Down
+}
+
+// one line of a chart
+type ChartPosition struct {
+	Position int    `json:"position"`
+	SongId   int    `json:"song_id"`
+	Authors  string `json:"authors"`
+	Title    string `json:"title"`
+	Up       int    `json:"upvotes"`
+	Down     int    `json:"downvotes"`
+	Score    int    `json:"score"`
+}
+
+// where a song placed in an archived chart
+type SongChartEntry struct {
+	PeriodId int `json:"period_id"`
+	ChartPosition
+}
+
+// returns the monday midnight starting the week of t, and the one after it
+func WeekBounds(t time.Time) (time.Time, time.Time) {
+	daysSinceMonday := (int(t.Weekday()) + 6) % 7
+	start := time.Date(t.Year(), t.Month(), t.Day()-daysSinceMonday, 0, 0, 0, 0, t.Location())
+	return start, start.AddDate(0, 0, 7)
+}
+
+// the week whose votes weigh the queues and can be changed by students
+func CurrentWeek() (time.Time, time.Time) {
+	return WeekBounds(time.Now())
+}
+
+func GetVotingPeriods() ([]VotingPeriod, error) {
+	return store.VotingPeriods()
+}
+
+func GetVotingPeriod(periodid int) (*VotingPeriod, error) {
+	periods, err := store.VotingPeriods()
+	if err != nil {
+		return nil, err
+	}
+	for _, period := range periods {
+		if period.Id == periodid {
+			return &period, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// returns the id of the new period
+func AddVotingPeriod(name, kind string, start, end time.Time) (int, error) {
+	if kind != PeriodWeekly && kind != PeriodSemester && kind != PeriodCustom {
+		return 0, errors.New("period kind must be weekly, semester or custom")
+	}
+	if !end.After(start) {
+		return 0, errors.New("period must end after it starts")
+	}
+	return store.AddVotingPeriod(VotingPeriod{Name: name, Kind: kind, Start: start, End: end})
+}
+
+// returns the weekly period of the current week, creating it if needed
+func CurrentWeeklyPeriod() (*VotingPeriod, error) {
+	start, end := CurrentWeek()
+	periods, err := store.VotingPeriods()
+	if err != nil {
+		return nil, err
+	}
+	for _, period := range periods {
+		if period.Kind == PeriodWeekly && period.Start.Equal(start) {
+			return &period, nil
+		}
+	}
+
+	// concurrent requests all end up with the period the first one created
+	year, week := start.ISOWeek()
+	name := strconv.Itoa(year) + "-W" + strconv.Itoa(week)
+	id, err := store.EnsureVotingPeriod(VotingPeriod{Name: name, Kind: PeriodWeekly, Start: start, End: end})
+	if err != nil {
+		return nil, err
+	}
+	return GetVotingPeriod(id)
+}
+
+// ranks the votes submitted in [start, end)
+func liveChart(start, end time.Time) ([]ChartPosition, error) {
+	tallies, err := store.VoteTallies(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	songs := map[int]SongData{}
+	for _, song := range GetSongArray() {
+		songs[song.SongId] = song
+	}
+
+	var chart []ChartPosition
+	for _, tally := range tallies {
+		song := songs[tally.SongId]
+		chart = append(chart, ChartPosition{
+			SongId:  tally.SongId,
+			Authors: song.Authors,
+			Title:   song.Title,
+			Up:      tally.Up,
+			Down:    tally.Down,
+			Score:   tally.Score(),
+		})
+	}
+
+	sort.Slice(chart, func(i, j int) bool {
+		if chart[i].Score != chart[j].Score {
+			return chart[i].Score > chart[j].Score
+		}
+		if chart[i].Up != chart[j].Up {
+			return chart[i].Up > chart[j].Up
+		}
+		return chart[i].SongId < chart[j].SongId
+	})
+	for i := range chart {
+		chart[i].Position = i + 1
+	}
+	return chart, nil
+}
+
+// returns the archived chart of a closed period, or the standings so far of an open one
+func Leaderboard(period VotingPeriod) ([]ChartPosition, error) {
+	if period.ClosedAt != nil {
+		return store.PeriodResults(period.Id)
+	}
+
+	end := period.End
+	if now := time.Now(); now.Before(end) {
+		end = now
+	}
+	return liveChart(period.Start, end)
+}
+
+// archives the chart of a period; it may be closed before its end
+func ClosePeriod(periodid int) error {
+	period, err := GetVotingPeriod(periodid)
+	if err != nil {
+		return err
+	}
+	if period.ClosedAt != nil {
+		return errors.New("period " + period.Name + " is already closed")
+	}
+
+	chart, err := liveChart(period.Start, period.End)
+	if err != nil {
+		return err
+	}
+	return store.ClosePeriod(periodid, chart)
+}
+
+// returns the placements of a song in every archived chart
+func SongChart(songid string) ([]SongChartEntry, error) {
+	return store.SongChart(songid)
+}
+
+func closeDuePeriods() {
+	if _, err := CurrentWeeklyPeriod(); err != nil {
+		log.Printf("DB error (weekly period): %v\n", err)
+	}
+
+	periods, err := store.VotingPeriods()
+	if err != nil {
+		log.Printf("DB error (voting periods): %v\n", err)
+		return
+	}
+
+	now := time.Now()
+	for _, period := range periods {
+		if period.ClosedAt != nil || now.Before(period.End) {
+			continue
+		}
+		if err := ClosePeriod(period.Id); err != nil {
+			log.Printf("Couldn't close voting period %s: %v\n", period.Name, err)
+			continue
+		}
+		log.Printf("Voting period %s closed, results archived\n", period.Name)
+	}
+}
+
+// keeps weekly periods coming and archives periods as they end
+func StartPeriodCloser() {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		for {
+			closeDuePeriods()
+			<-ticker.C
+		}
+	}()
+}
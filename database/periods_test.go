@@ -0,0 +1,60 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWeekBounds(t *testing.T) {
+	warsaw, err := time.LoadLocation("Europe/Warsaw")
+	if err != nil {
+		t.Skip("no time zone data:", err)
+	}
+
+	tests := []struct {
+		name      string
+		t         time.Time
+		wantStart time.Time
+		wantEnd   time.Time
+	}{
+		{
+			name:      "monday midnight",
+			t:         time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC),
+			wantStart: time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "midweek",
+			t:         time.Date(2026, 10, 15, 13, 45, 0, 0, time.UTC),
+			wantStart: time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "sunday night",
+			t:         time.Date(2026, 10, 18, 23, 59, 59, 0, time.UTC),
+			wantStart: time.Date(2026, 10, 12, 0, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "across new year",
+			t:         time.Date(2027, 1, 1, 12, 0, 0, 0, time.UTC),
+			wantStart: time.Date(2026, 12, 28, 0, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2027, 1, 4, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "week with a clock change",
+			t:         time.Date(2026, 10, 25, 12, 0, 0, 0, warsaw),
+			wantStart: time.Date(2026, 10, 19, 0, 0, 0, 0, warsaw),
+			wantEnd:   time.Date(2026, 10, 26, 0, 0, 0, 0, warsaw),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := WeekBounds(tt.t)
+			if !start.Equal(tt.wantStart) || !end.Equal(tt.wantEnd) {
+				t.Errorf("WeekBounds = %v, %v, want %v, %v", start, end, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
@@ -0,0 +1 @@
+INSERT INTO api_tokens(name, token_hash) VALUES (?, ?)
\ No newline at end of file
@@ -0,0 +1 @@
+INSERT INTO period_results(period_id, position, song_id, authors, title, upvotes, downvotes) VALUES (?, ?, ?, ?, ?, ?, ?)
\ No newline at end of file
@@ -1 +1 @@
-INSERT INTO playlists VALUES (NULL, ?, ?, ?, NULL)
\ No newline at end of file
+INSERT INTO playlists(playlist_id, title, description, ranking, playback_mode) VALUES (NULLIF(?, 0), ?, ?, ?, ?)
\ No newline at end of file
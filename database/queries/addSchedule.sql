@@ -1 +0,0 @@
-INSERT INTO schedule(date_at, content, submitted_at) VALUES (?, ?, CURDATE())
\ No newline at end of file
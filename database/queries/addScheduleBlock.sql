@@ -0,0 +1 @@
+INSERT INTO schedule_blocks(date_at, position, start_at, end_at, block_type, playlist_id) VALUES (?, ?, ?, ?, ?, ?)
\ No newline at end of file
@@ -0,0 +1 @@
+INSERT INTO schedule_files(block_id, position, location) VALUES (?, ?, ?)
\ No newline at end of file
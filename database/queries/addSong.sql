@@ -1 +1 @@
-INSERT INTO songs VALUES(NULL, ?, ?, ?, ?, ?, NULL)
\ No newline at end of file
+INSERT INTO songs(song_id, authors, title, youtube_id, length_seconds, release_date, bpm, language, explicit, isrc, loudness_lufs, true_peak_dbtp, cue_in_ms, intro_end_ms, outro_start_ms, cue_out_ms) VALUES (NULLIF(?, 0), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
\ No newline at end of file
@@ -0,0 +1 @@
+INSERT INTO song_tags(song_id, tag_id) VALUES (?, ?)
\ No newline at end of file
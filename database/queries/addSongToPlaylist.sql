@@ -1 +1,4 @@
-INSERT INTO playlist_entries VALUES (?, ?, NULL)
\ No newline at end of file
+INSERT INTO playlist_entries(playlist_id, song_id, position)
+SELECT playlists.playlist_id, songs.song_id, ? FROM playlists
+JOIN songs ON songs.song_id=? AND songs.deleted_at IS NULL
+WHERE playlists.playlist_id=? AND playlists.deleted_at IS NULL
\ No newline at end of file
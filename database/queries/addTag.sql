@@ -0,0 +1 @@
+INSERT INTO tags(kind, name) VALUES (?, ?) ON DUPLICATE KEY UPDATE tag_id=LAST_INSERT_ID(tag_id)
\ No newline at end of file
@@ -1 +1,2 @@
-INSERT INTO votes(student, vote_type, song_id, submitted_at) VALUES (?, ?, ?, CURDATE())
\ No newline at end of file
+INSERT INTO votes(student, vote_type, song_id, week_start) VALUES (?, ?, ?, ?)
+ON DUPLICATE KEY UPDATE vote_type=VALUES(vote_type)
\ No newline at end of file
@@ -0,0 +1 @@
+INSERT INTO voting_periods(name, kind, starts_at, ends_at) VALUES (?, ?, ?, ?)
\ No newline at end of file
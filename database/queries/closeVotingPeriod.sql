@@ -0,0 +1 @@
+UPDATE voting_periods SET closed_at=CURRENT_TIMESTAMP WHERE period_id=? AND closed_at IS NULL
\ No newline at end of file
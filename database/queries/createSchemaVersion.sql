@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS schema_version (
+	version int PRIMARY KEY NOT NULL,
+	name VARCHAR(256) NOT NULL,
+
+	applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+)
\ No newline at end of file
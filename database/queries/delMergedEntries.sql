@@ -0,0 +1,3 @@
+DELETE duplicate FROM playlist_entries duplicate
+JOIN playlist_entries kept ON kept.playlist_id=duplicate.playlist_id AND kept.song_id=?
+WHERE duplicate.song_id=?
\ No newline at end of file
@@ -1 +1 @@
-DELETE FROM playlists,playlist_entries WHERE playlist_id=?
\ No newline at end of file
+UPDATE playlists SET deleted_at=CURRENT_TIMESTAMP WHERE playlist_id=? AND deleted_at IS NULL
\ No newline at end of file
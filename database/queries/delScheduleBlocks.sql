@@ -0,0 +1 @@
+DELETE FROM schedule_blocks WHERE date_at=?
\ No newline at end of file
@@ -0,0 +1 @@
+DELETE FROM schedule_files WHERE block_id IN (SELECT block_id FROM schedule_blocks WHERE date_at=?)
\ No newline at end of file
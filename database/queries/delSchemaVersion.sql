@@ -0,0 +1 @@
+DELETE FROM schema_version WHERE version=?
\ No newline at end of file
@@ -1 +1 @@
-DELETE FROM songs WHERE song_id=?
\ No newline at end of file
+UPDATE songs SET deleted_at=CURRENT_TIMESTAMP WHERE song_id=? AND deleted_at IS NULL
\ No newline at end of file
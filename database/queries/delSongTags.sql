@@ -0,0 +1 @@
+DELETE FROM song_tags WHERE song_id=?
\ No newline at end of file
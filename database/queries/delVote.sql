@@ -0,0 +1 @@
+DELETE FROM votes WHERE song_id=? AND student=? AND submitted_at=?
\ No newline at end of file
@@ -0,0 +1 @@
+INSERT INTO voting_periods(name, kind, starts_at, ends_at) VALUES (?, ?, ?, ?) ON DUPLICATE KEY UPDATE period_id = LAST_INSERT_ID(period_id)
\ No newline at end of file
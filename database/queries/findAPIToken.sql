@@ -0,0 +1 @@
+SELECT token_id, name, created_at, revoked_at FROM api_tokens WHERE token_hash=? AND revoked_at IS NULL
\ No newline at end of file
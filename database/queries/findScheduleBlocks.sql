@@ -0,0 +1,3 @@
+SELECT block_id, date_at, start_at, end_at, block_type, playlist_id FROM schedule_blocks
+WHERE (? IS NULL OR end_at >= ?) AND (? IS NULL OR start_at <= ?) AND (? IS NULL OR playlist_id = ?)
+ORDER BY start_at, date_at, position
\ No newline at end of file
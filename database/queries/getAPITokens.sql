@@ -0,0 +1 @@
+SELECT token_id, name, created_at, revoked_at FROM api_tokens ORDER BY token_id
\ No newline at end of file
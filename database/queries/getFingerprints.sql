@@ -0,0 +1,4 @@
+SELECT song_fingerprints.song_id, song_fingerprints.content_hash, song_fingerprints.fingerprint FROM song_fingerprints
+JOIN songs ON songs.song_id=song_fingerprints.song_id
+WHERE songs.deleted_at IS NULL
+ORDER BY song_fingerprints.song_id
\ No newline at end of file
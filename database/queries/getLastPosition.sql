@@ -0,0 +1 @@
+SELECT COALESCE(MAX(position), 0) FROM playlist_entries WHERE playlist_id=?
\ No newline at end of file
@@ -0,0 +1 @@
+SELECT `date_at`, `content` FROM schedule
\ No newline at end of file
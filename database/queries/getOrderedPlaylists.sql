@@ -0,0 +1 @@
+SELECT DISTINCT playlist_id FROM playlist_entries
\ No newline at end of file
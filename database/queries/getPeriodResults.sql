@@ -0,0 +1 @@
+SELECT position, song_id, authors, title, upvotes, downvotes FROM period_results WHERE period_id=? ORDER BY position
\ No newline at end of file
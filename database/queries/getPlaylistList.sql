@@ -1 +1 @@
-SELECT * FROM playlists
\ No newline at end of file
+SELECT playlist_id, title, description, ranking, playback_mode, debuted_at, deleted_at FROM playlists WHERE deleted_at IS NULL
\ No newline at end of file
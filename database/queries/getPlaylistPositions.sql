@@ -0,0 +1 @@
+SELECT entry_id, position FROM playlist_entries WHERE playlist_id=? ORDER BY position, debuted_at, entry_id
\ No newline at end of file
@@ -0,0 +1,3 @@
+SELECT song_tags.song_id, tags.kind, tags.name FROM song_tags
+JOIN tags ON tags.tag_id=song_tags.tag_id
+WHERE song_tags.song_id IN (SELECT song_id FROM playlist_entries WHERE playlist_id=?) ORDER BY tags.name
\ No newline at end of file
@@ -1 +1,5 @@
-SELECT * FROM playlist_entries WHERE playlist_id=?
\ No newline at end of file
+SELECT playlist_entries.playlist_id, playlist_entries.song_id, playlist_entries.position, playlist_entries.debuted_at,
+songs.song_id, songs.authors, songs.title, songs.youtube_id, songs.length_seconds, songs.release_date, songs.debuted_at, songs.deleted_at, songs.bpm, songs.language, songs.explicit, songs.isrc, songs.loudness_lufs, songs.true_peak_dbtp, songs.cue_in_ms, songs.intro_end_ms, songs.outro_start_ms, songs.cue_out_ms FROM playlist_entries
+JOIN songs ON songs.song_id=playlist_entries.song_id
+WHERE playlist_entries.playlist_id=? AND songs.deleted_at IS NULL
+ORDER BY playlist_entries.position, playlist_entries.entry_id
\ No newline at end of file
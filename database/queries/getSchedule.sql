@@ -1 +0,0 @@
-SELECT `content` FROM schedule WHERE `date_at`=?
\ No newline at end of file
@@ -0,0 +1 @@
+SELECT block_id, date_at, start_at, end_at, block_type, playlist_id FROM schedule_blocks WHERE date_at=? ORDER BY position
\ No newline at end of file
@@ -0,0 +1 @@
+SELECT location FROM schedule_files WHERE block_id=? ORDER BY position
\ No newline at end of file
@@ -0,0 +1 @@
+SELECT version, applied_at FROM schema_version
\ No newline at end of file
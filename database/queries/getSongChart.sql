@@ -0,0 +1,5 @@
+SELECT period_results.period_id, period_results.position, period_results.song_id, period_results.authors, period_results.title, period_results.upvotes, period_results.downvotes
+FROM period_results
+JOIN voting_periods ON voting_periods.period_id=period_results.period_id
+WHERE period_results.song_id=?
+ORDER BY voting_periods.starts_at
\ No newline at end of file
@@ -0,0 +1 @@
+SELECT DISTINCT playlist_id FROM playlist_entries WHERE song_id=?
\ No newline at end of file
@@ -0,0 +1 @@
+SELECT student, vote_type, song_id, submitted_at FROM votes WHERE song_id=?
\ No newline at end of file
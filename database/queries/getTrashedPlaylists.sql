@@ -0,0 +1 @@
+SELECT playlist_id, title, description, ranking, playback_mode, debuted_at, deleted_at FROM playlists WHERE deleted_at IS NOT NULL
\ No newline at end of file
@@ -0,0 +1 @@
+SELECT song_id, authors, title, youtube_id, length_seconds, release_date, debuted_at, deleted_at, bpm, language, explicit, isrc, loudness_lufs, true_peak_dbtp, cue_in_ms, intro_end_ms, outro_start_ms, cue_out_ms FROM songs WHERE deleted_at IS NOT NULL
\ No newline at end of file
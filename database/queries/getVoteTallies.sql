@@ -0,0 +1,4 @@
+SELECT votes.song_id, SUM(votes.vote_type=1), SUM(votes.vote_type=0) FROM votes
+JOIN songs ON songs.song_id=votes.song_id
+WHERE songs.deleted_at IS NULL AND votes.submitted_at >= ? AND votes.submitted_at < ?
+GROUP BY votes.song_id
\ No newline at end of file
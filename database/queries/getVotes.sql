@@ -1 +1 @@
-SELECT * FROM votes WHERE song_id=? AND WEEK(submitted_at)=WEEK(CURDATE()) AND vote_type=?
\ No newline at end of file
+SELECT student, vote_type, song_id, submitted_at FROM votes WHERE song_id=? AND vote_type=? AND submitted_at >= ? AND submitted_at < ?
\ No newline at end of file
@@ -0,0 +1 @@
+SELECT period_id, name, kind, starts_at, ends_at, closed_at FROM voting_periods ORDER BY starts_at, period_id
\ No newline at end of file
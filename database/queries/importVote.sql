@@ -0,0 +1,2 @@
+INSERT INTO votes(student, vote_type, song_id, submitted_at, week_start) VALUES (?, ?, ?, ?, ?)
+ON DUPLICATE KEY UPDATE vote_type=VALUES(vote_type), submitted_at=VALUES(submitted_at)
\ No newline at end of file
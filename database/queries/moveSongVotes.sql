@@ -0,0 +1 @@
+UPDATE votes SET song_id=? WHERE song_id=?
\ No newline at end of file
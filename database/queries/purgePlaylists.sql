@@ -0,0 +1 @@
+DELETE FROM playlists WHERE deleted_at IS NOT NULL AND deleted_at < ?
\ No newline at end of file
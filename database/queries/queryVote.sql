@@ -1 +0,0 @@
-SELECT * FROM votes WHERE `student`=? && `song_id`=?
\ No newline at end of file
@@ -0,0 +1 @@
+UPDATE playlists SET deleted_at=NULL WHERE playlist_id=? AND deleted_at IS NOT NULL
\ No newline at end of file
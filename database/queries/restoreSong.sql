@@ -0,0 +1 @@
+UPDATE songs SET deleted_at=NULL WHERE song_id=? AND deleted_at IS NOT NULL
\ No newline at end of file
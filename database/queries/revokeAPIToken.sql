@@ -0,0 +1 @@
+UPDATE api_tokens SET revoked_at=CURRENT_TIMESTAMP WHERE token_id=? AND revoked_at IS NULL
\ No newline at end of file
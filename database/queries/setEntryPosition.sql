@@ -0,0 +1 @@
+UPDATE playlist_entries SET position=? WHERE entry_id=?
\ No newline at end of file
@@ -0,0 +1,2 @@
+INSERT INTO song_fingerprints(song_id, content_hash, fingerprint) VALUES (?, ?, ?)
+ON DUPLICATE KEY UPDATE content_hash=VALUES(content_hash), fingerprint=VALUES(fingerprint), analysed_at=CURRENT_TIMESTAMP
\ No newline at end of file
@@ -0,0 +1 @@
+UPDATE playlists SET playback_mode=? WHERE playlist_id=? AND deleted_at IS NULL
\ No newline at end of file
@@ -1 +0,0 @@
-UPDATE schedule SET `content`=? WHERE `date_at`=DATE(?)
\ No newline at end of file
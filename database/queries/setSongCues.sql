@@ -0,0 +1 @@
+UPDATE songs SET cue_in_ms=?, intro_end_ms=?, outro_start_ms=?, cue_out_ms=? WHERE song_id=? AND deleted_at IS NULL
\ No newline at end of file
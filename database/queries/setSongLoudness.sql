@@ -0,0 +1 @@
+UPDATE songs SET loudness_lufs=?, true_peak_dbtp=? WHERE song_id=? AND deleted_at IS NULL
\ No newline at end of file
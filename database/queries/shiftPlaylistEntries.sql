@@ -0,0 +1 @@
+UPDATE playlist_entries SET position=position+1 WHERE playlist_id=? AND position>=?
\ No newline at end of file
@@ -0,0 +1 @@
+UPDATE songs SET authors=?, title=?, youtube_id=?, length_seconds=?, release_date=?, bpm=?, language=?, explicit=?, isrc=? WHERE song_id=? AND deleted_at IS NULL
\ No newline at end of file
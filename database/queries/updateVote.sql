@@ -1 +0,0 @@
-UPDATE votes SET `vote_type`=? WHERE `student`=? && `song_id`=? && WEEK(`submitted_at`)=WEEK(CURDATE())
\ No newline at end of file
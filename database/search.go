@@ -0,0 +1,515 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Search runs queries like
+//
+//	queen -live title:"we will" year:1975..1980 tag:rock
+//
+// against an inverted index of the library. Bare terms match the title, authors,
+// genres and tags (playlists: title and description) by word prefix, quoted terms
+// match whole phrases, a leading - excludes matches. Matching ignores case and diacritics.
+
+// latin letters folded to their base form
+var foldedRunes = map[rune]string{
+	'ą': "a", 'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a", 'ă': "a",
+	'ć': "c", 'ç': "c", 'č': "c", 'ĉ': "c",
+	'ď': "d", 'đ': "d",
+	'ę': "e", 'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ě': "e",
+	'ğ': "g",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ī': "i", 'ı': "i",
+	'ł': "l", 'ľ': "l", 'ĺ': "l",
+	'ń': "n", 'ñ': "n", 'ň': "n",
+	'ó': "o", 'ò': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ō': "o", 'ő': "o",
+	'ř': "r", 'ŕ': "r",
+	'ś': "s", 'š': "s", 'ş': "s", 'ß': "ss",
+	'ť': "t", 'ţ': "t",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ū': "u", 'ů': "u", 'ű': "u",
+	'ý': "y", 'ÿ': "y",
+	'ź': "z", 'ż': "z", 'ž': "z",
+	'æ': "ae", 'œ': "oe",
+}
+
+// lowercases s and strips diacritics
+func FoldText(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if folded, ok := foldedRunes[r]; ok {
+			b.WriteString(folded)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// splits folded text into words
+func tokenize(s string) []string {
+	return strings.FieldsFunc(FoldText(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// text fields and the weight a match in them adds to the score
+var songFields = map[string]float64{"title": 3, "author": 2, "genre": 1, "tag": 1}
+var playlistFields = map[string]float64{"title": 3, "description": 1}
+
+// query prefixes mapped to field names
+var fieldAliases = map[string]string{
+	"title":       "title",
+	"name":        "title",
+	"author":      "author",
+	"authors":     "author",
+	"artist":      "author",
+	"genre":       "genre",
+	"tag":         "tag",
+	"desc":        "description",
+	"description": "description",
+	"year":        "year",
+	"lang":        "language",
+	"language":    "language",
+	"id":          "id",
+}
+
+type searchClause struct {
+	// empty for bare terms
+	field  string
+	words  []string
+	negate bool
+	// set for year: clauses, 0 means unbounded
+	yearFrom int
+	yearTo   int
+}
+
+// phrases are quoted or consist of several words
+func (c searchClause) phrase() bool {
+	return len(c.words) > 1
+}
+
+// splits a query into clauses, honouring quotes
+func parseSearchQuery(query string) ([]searchClause, error) {
+	var clauses []searchClause
+	runes := []rune(query)
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+
+		var clause searchClause
+		if runes[i] == '-' {
+			clause.negate = true
+			i++
+		}
+
+		// read up to the next unquoted space
+		var raw strings.Builder
+		quoted := false
+		for ; i < len(runes) && (quoted || !unicode.IsSpace(runes[i])); i++ {
+			if runes[i] == '"' {
+				quoted = !quoted
+				continue
+			}
+			raw.WriteRune(runes[i])
+		}
+		if quoted {
+			return nil, fmt.Errorf("unterminated quote in '%s'", query)
+		}
+
+		value := raw.String()
+		if colon := strings.Index(value, ":"); colon > 0 {
+			if field, ok := fieldAliases[strings.ToLower(value[:colon])]; ok {
+				clause.field = field
+				value = value[colon+1:]
+			}
+		}
+
+		if clause.field == "year" {
+			if err := clause.parseYears(value); err != nil {
+				return nil, err
+			}
+		} else if clause.field == "id" || clause.field == "language" {
+			clause.words = []string{strings.ToLower(value)}
+		} else {
+			clause.words = tokenize(value)
+		}
+
+		if len(clause.words) == 0 && clause.field != "year" {
+			continue
+		}
+		clauses = append(clauses, clause)
+	}
+	return clauses, nil
+}
+
+// accepts 2019, 2019..2021, 2019.. and ..2021
+func (c *searchClause) parseYears(value string) error {
+	from, to := value, value
+	if parts := strings.SplitN(value, "..", 2); len(parts) == 2 {
+		from, to = parts[0], parts[1]
+	}
+
+	var err error
+	if from != "" {
+		if c.yearFrom, err = strconv.Atoi(from); err != nil {
+			return fmt.Errorf("invalid year '%s'", from)
+		}
+	}
+	if to != "" {
+		if c.yearTo, err = strconv.Atoi(to); err != nil {
+			return fmt.Errorf("invalid year '%s'", to)
+		}
+	}
+	if c.yearFrom == 0 && c.yearTo == 0 {
+		return fmt.Errorf("invalid year range '%s'", value)
+	}
+	return nil
+}
+
+// a searchable song or playlist
+type searchDoc struct {
+	id       int
+	year     int
+	language string
+	// words of each text field, joined by single spaces for phrase matching
+	text map[string]string
+}
+
+// inverted index over one kind of document
+type searchIndex struct {
+	fields map[string]float64
+	docs   map[int]*searchDoc
+	// field -> word -> doc ids
+	postings map[string]map[string][]int
+	// sorted words of every field, for prefix lookups
+	vocab map[string][]string
+}
+
+func newSearchIndex(fields map[string]float64) *searchIndex {
+	return &searchIndex{
+		fields:   fields,
+		docs:     map[int]*searchDoc{},
+		postings: map[string]map[string][]int{},
+		vocab:    map[string][]string{},
+	}
+}
+
+func (idx *searchIndex) add(doc *searchDoc, raw map[string]string) {
+	doc.text = map[string]string{}
+	for field, value := range raw {
+		words := tokenize(value)
+		doc.text[field] = strings.Join(words, " ")
+
+		if idx.postings[field] == nil {
+			idx.postings[field] = map[string][]int{}
+		}
+		seen := map[string]bool{}
+		for _, word := range words {
+			if seen[word] {
+				continue
+			}
+			seen[word] = true
+			if _, ok := idx.postings[field][word]; !ok {
+				idx.vocab[field] = append(idx.vocab[field], word)
+			}
+			idx.postings[field][word] = append(idx.postings[field][word], doc.id)
+		}
+	}
+	idx.docs[doc.id] = doc
+}
+
+func (idx *searchIndex) finish() {
+	for field := range idx.vocab {
+		sort.Strings(idx.vocab[field])
+	}
+}
+
+// ids of documents which have a word starting with prefix in any of the fields
+func (idx *searchIndex) lookup(prefix string, fields []string) map[int]bool {
+	ids := map[int]bool{}
+	for _, field := range fields {
+		vocab := idx.vocab[field]
+		for i := sort.SearchStrings(vocab, prefix); i < len(vocab) && strings.HasPrefix(vocab[i], prefix); i++ {
+			for _, id := range idx.postings[field][vocab[i]] {
+				ids[id] = true
+			}
+		}
+	}
+	return ids
+}
+
+func (idx *searchIndex) clauseFields(c searchClause) []string {
+	// genres are tags too, but genre: only looks at genres
+	if c.field == "tag" {
+		return []string{"genre", "tag"}
+	}
+	if c.field != "" {
+		return []string{c.field}
+	}
+	var fields []string
+	for field := range idx.fields {
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// scores how well the document matches a text clause, 0 if it doesn't
+func (idx *searchIndex) score(doc *searchDoc, c searchClause) float64 {
+	var score float64
+	for _, field := range idx.clauseFields(c) {
+		text := doc.text[field]
+		if text == "" {
+			continue
+		}
+		weight := idx.fields[field]
+
+		if c.phrase() {
+			if strings.Contains(" "+text+" ", " "+strings.Join(c.words, " ")+" ") {
+				score += 2 * weight
+			}
+			continue
+		}
+
+		// whole words count double compared to prefixes
+		best := 0.0
+		for _, word := range strings.Split(text, " ") {
+			if word == c.words[0] {
+				best = weight
+				break
+			} else if strings.HasPrefix(word, c.words[0]) {
+				best = weight / 2
+			}
+		}
+		score += best
+	}
+	return score
+}
+
+// bare terms also match the id and the release date, as the console query always did
+func (doc *searchDoc) matchesBare(c searchClause, released string) bool {
+	if c.phrase() {
+		return false
+	}
+	term := c.words[0]
+	return term == strconv.Itoa(doc.id) || (released != "" && strings.HasPrefix(released, term) && len(term) >= 4)
+}
+
+// returns matching document ids with their scores
+func (idx *searchIndex) search(clauses []searchClause, released map[int]string) map[int]float64 {
+	// narrow down the candidates with the index first
+	var candidates map[int]bool
+	for _, c := range clauses {
+		if c.negate || c.field == "year" || c.field == "id" || c.field == "language" {
+			continue
+		}
+		ids := idx.lookup(c.words[0], idx.clauseFields(c))
+		if c.field == "" {
+			for id, doc := range idx.docs {
+				if doc.matchesBare(c, released[id]) {
+					ids[id] = true
+				}
+			}
+		}
+		if candidates == nil {
+			candidates = ids
+			continue
+		}
+		for id := range candidates {
+			if !ids[id] {
+				delete(candidates, id)
+			}
+		}
+	}
+	if candidates == nil {
+		candidates = map[int]bool{}
+		for id := range idx.docs {
+			candidates[id] = true
+		}
+	}
+
+	results := map[int]float64{}
+	for id := range candidates {
+		doc := idx.docs[id]
+		total := 0.0
+		matches := true
+		for _, c := range clauses {
+			var matched bool
+			var score float64
+			switch c.field {
+			case "year":
+				matched = doc.year != 0 && (c.yearFrom == 0 || doc.year >= c.yearFrom) && (c.yearTo == 0 || doc.year <= c.yearTo)
+			case "id":
+				matched = strconv.Itoa(doc.id) == c.words[0]
+			case "language":
+				matched = doc.language == c.words[0]
+			default:
+				score = idx.score(doc, c)
+				matched = score > 0
+				if !matched && c.field == "" && doc.matchesBare(c, released[id]) {
+					matched = true
+					score = 1
+				}
+			}
+
+			if matched == c.negate {
+				matches = false
+				break
+			}
+			if !c.negate {
+				total += score
+			}
+		}
+		if matches {
+			results[id] = total
+		}
+	}
+	return results
+}
+
+// indexes built from the store, rebuilt lazily after the library changes
+type searchIndexes struct {
+	mutex     sync.Mutex
+	songs     *searchIndex
+	playlists *searchIndex
+	released  map[int]string
+
+	// what the indexes were built from
+	songData     map[int]SongData
+	playlistData map[int]Playlist
+}
+
+var searcher searchIndexes
+
+func invalidateSearch() {
+	searcher.mutex.Lock()
+	searcher.songs = nil
+	searcher.playlists = nil
+	searcher.mutex.Unlock()
+}
+
+func (s *searchIndexes) build() error {
+	if s.songs != nil {
+		return nil
+	}
+
+	songs, err := store.Songs()
+	if err != nil {
+		return err
+	}
+	playlists, err := store.Playlists()
+	if err != nil {
+		return err
+	}
+
+	songIndex := newSearchIndex(songFields)
+	released := map[int]string{}
+	songData := map[int]SongData{}
+	for _, song := range songs {
+		songData[song.SongId] = song
+		doc := &searchDoc{id: song.SongId, language: song.Language}
+		if !song.ReleaseDate.IsZero() {
+			doc.year = song.ReleaseDate.Year()
+			released[song.SongId] = song.ReleaseDate.Format("2006-01-02")
+		}
+		songIndex.add(doc, map[string]string{
+			"title":  song.Title,
+			"author": song.Authors,
+			"genre":  strings.Join(song.Genres, " "),
+			"tag":    strings.Join(song.Tags, " "),
+		})
+	}
+	songIndex.finish()
+
+	playlistIndex := newSearchIndex(playlistFields)
+	playlistData := map[int]Playlist{}
+	for _, playlist := range playlists {
+		playlistData[playlist.Id] = playlist
+		playlistIndex.add(&searchDoc{id: playlist.Id}, map[string]string{
+			"title":       playlist.Name,
+			"description": playlist.Desc,
+		})
+	}
+	playlistIndex.finish()
+
+	s.songs = songIndex
+	s.playlists = playlistIndex
+	s.released = released
+	s.songData = songData
+	s.playlistData = playlistData
+	return nil
+}
+
+type SongResult struct {
+	SongData
+	Score float64 `json:"score"`
+}
+
+type PlaylistResult struct {
+	Playlist
+	Score float64 `json:"score"`
+}
+
+// returns the songs matching query, best matches first
+func SearchSongs(query string) ([]SongResult, error) {
+	clauses, err := parseSearchQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	searcher.mutex.Lock()
+	if err := searcher.build(); err != nil {
+		searcher.mutex.Unlock()
+		return nil, err
+	}
+	var results []SongResult
+	for id, score := range searcher.songs.search(clauses, searcher.released) {
+		results = append(results, SongResult{SongData: searcher.songData[id], Score: score})
+	}
+	searcher.mutex.Unlock()
+
+	votes := VoteScores()
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		if votes[results[i].SongId] != votes[results[j].SongId] {
+			return votes[results[i].SongId] > votes[results[j].SongId]
+		}
+		return results[i].SongId < results[j].SongId
+	})
+	return results, nil
+}
+
+// returns the playlists matching query, best matches first
+func SearchPlaylists(query string) ([]PlaylistResult, error) {
+	clauses, err := parseSearchQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	searcher.mutex.Lock()
+	if err := searcher.build(); err != nil {
+		searcher.mutex.Unlock()
+		return nil, err
+	}
+	var results []PlaylistResult
+	for id, score := range searcher.playlists.search(clauses, nil) {
+		results = append(results, PlaylistResult{Playlist: searcher.playlistData[id], Score: score})
+	}
+	searcher.mutex.Unlock()
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Rank > results[j].Rank
+	})
+	return results, nil
+}
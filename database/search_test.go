@@ -0,0 +1,119 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFoldText(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Queen", "queen"},
+		{"Zażółć GĘŚLĄ jaźń", "zazolc gesla jazn"},
+		{"Straße", "strasse"},
+		{"Motörhead", "motorhead"},
+	}
+
+	for _, tt := range tests {
+		if got := FoldText(tt.text); got != tt.want {
+			t.Errorf("FoldText(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		want    []searchClause
+		wantErr bool
+	}{
+		{
+			name:  "empty",
+			query: "   ",
+		},
+		{
+			name:  "bare terms",
+			query: "Queen  live",
+			want:  []searchClause{{words: []string{"queen"}}, {words: []string{"live"}}},
+		},
+		{
+			name:  "negated",
+			query: "queen -live",
+			want:  []searchClause{{words: []string{"queen"}}, {words: []string{"live"}, negate: true}},
+		},
+		{
+			name:  "quoted phrase",
+			query: `"We Will Rock"`,
+			want:  []searchClause{{words: []string{"we", "will", "rock"}}},
+		},
+		{
+			name:  "field with a quoted phrase",
+			query: `title:"we will"`,
+			want:  []searchClause{{field: "title", words: []string{"we", "will"}}},
+		},
+		{
+			name:  "field alias",
+			query: "artist:Queen",
+			want:  []searchClause{{field: "author", words: []string{"queen"}}},
+		},
+		{
+			name:  "unknown field is a term",
+			query: "foo:bar",
+			want:  []searchClause{{words: []string{"foo", "bar"}}},
+		},
+		{
+			name:  "language and id kept whole",
+			query: "lang:PL id:12",
+			want:  []searchClause{{field: "language", words: []string{"pl"}}, {field: "id", words: []string{"12"}}},
+		},
+		{
+			name:  "punctuation only",
+			query: "- ...",
+		},
+		{
+			name:  "year",
+			query: "year:1975",
+			want:  []searchClause{{field: "year", yearFrom: 1975, yearTo: 1975}},
+		},
+		{
+			name:  "year range",
+			query: "year:1975..1980",
+			want:  []searchClause{{field: "year", yearFrom: 1975, yearTo: 1980}},
+		},
+		{
+			name:  "open year ranges",
+			query: "year:1975.. -year:..1980",
+			want:  []searchClause{{field: "year", yearFrom: 1975}, {field: "year", yearTo: 1980, negate: true}},
+		},
+		{
+			name:    "invalid year",
+			query:   "year:seventies",
+			wantErr: true,
+		},
+		{
+			name:    "empty year range",
+			query:   "year:..",
+			wantErr: true,
+		},
+		{
+			name:    "unterminated quote",
+			query:   `title:"we will`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSearchQuery(tt.query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("clauses = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
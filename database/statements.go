@@ -20,6 +20,24 @@ var AddSongToPlaylistCmd string
 //go:embed queries/delSongFromPlaylist.sql
 var DelSongFromPlaylistCmd string
 
+//go:embed queries/getLastPosition.sql
+var GetLastPositionQuery string
+
+//go:embed queries/shiftPlaylistEntries.sql
+var ShiftPlaylistEntriesCmd string
+
+//go:embed queries/getPlaylistPositions.sql
+var GetPlaylistPositionsQuery string
+
+//go:embed queries/setEntryPosition.sql
+var SetEntryPositionCmd string
+
+//go:embed queries/getOrderedPlaylists.sql
+var GetOrderedPlaylistsQuery string
+
+//go:embed queries/setPlaylistMode.sql
+var SetPlaylistModeCmd string
+
 //go:embed queries/getSong.sql
 var GetSongQuery string
 
@@ -38,32 +56,146 @@ var GetVotesQuery string
 //go:embed queries/addVote.sql
 var AddVoteCmd string
 
-//go:embed queries/updateVote.sql
-var UpdateVoteCmd string
+//go:embed queries/getLegacySchedules.sql
+var GetLegacySchedulesQuery string
+
+//go:embed queries/getScheduleBlocks.sql
+var GetScheduleBlocksQuery string
+
+//go:embed queries/findScheduleBlocks.sql
+var FindScheduleBlocksQuery string
+
+//go:embed queries/addScheduleBlock.sql
+var AddScheduleBlockCmd string
+
+//go:embed queries/delScheduleBlocks.sql
+var DelScheduleBlocksCmd string
+
+//go:embed queries/getScheduleFiles.sql
+var GetScheduleFilesQuery string
+
+//go:embed queries/addScheduleFile.sql
+var AddScheduleFileCmd string
+
+//go:embed queries/delScheduleFiles.sql
+var DelScheduleFilesCmd string
+
+//go:embed queries/createSchemaVersion.sql
+var CreateSchemaVersionCmd string
+
+//go:embed queries/getSchemaVersions.sql
+var GetSchemaVersionsQuery string
+
+//go:embed queries/addSchemaVersion.sql
+var AddSchemaVersionCmd string
+
+//go:embed queries/delSchemaVersion.sql
+var DelSchemaVersionCmd string
+
+//go:embed queries/importVote.sql
+var ImportVoteCmd string
+
+//go:embed queries/getVoteTallies.sql
+var GetVoteTalliesQuery string
+
+//go:embed queries/getVotingPeriods.sql
+var GetVotingPeriodsQuery string
+
+//go:embed queries/addVotingPeriod.sql
+var AddVotingPeriodCmd string
+
+//go:embed queries/ensureVotingPeriod.sql
+var EnsureVotingPeriodCmd string
+
+//go:embed queries/closeVotingPeriod.sql
+var CloseVotingPeriodCmd string
+
+//go:embed queries/addPeriodResult.sql
+var AddPeriodResultCmd string
+
+//go:embed queries/getPeriodResults.sql
+var GetPeriodResultsQuery string
+
+//go:embed queries/getSongChart.sql
+var GetSongChartQuery string
+
+//go:embed queries/getTrashedSongs.sql
+var GetTrashedSongsQuery string
+
+//go:embed queries/getTrashedPlaylists.sql
+var GetTrashedPlaylistsQuery string
+
+//go:embed queries/restoreSong.sql
+var RestoreSongCmd string
+
+//go:embed queries/restorePlaylist.sql
+var RestorePlaylistCmd string
+
+//go:embed queries/purgeSongs.sql
+var PurgeSongsCmd string
+
+//go:embed queries/purgePlaylists.sql
+var PurgePlaylistsCmd string
+
+//go:embed queries/updateSong.sql
+var UpdateSongCmd string
+
+//go:embed queries/setSongLoudness.sql
+var SetSongLoudnessCmd string
+
+//go:embed queries/setSongCues.sql
+var SetSongCuesCmd string
+
+//go:embed queries/addTag.sql
+var AddTagCmd string
+
+//go:embed queries/delSongTags.sql
+var DelSongTagsCmd string
+
+//go:embed queries/addSongTag.sql
+var AddSongTagCmd string
+
+//go:embed queries/getSongTags.sql
+var GetSongTagsQuery string
+
+//go:embed queries/getPlaylistSongTags.sql
+var GetPlaylistSongTagsQuery string
+
+//go:embed queries/getAllSongTags.sql
+var GetAllSongTagsQuery string
+
+//go:embed queries/getAPITokens.sql
+var GetAPITokensQuery string
+
+//go:embed queries/findAPIToken.sql
+var FindAPITokenQuery string
+
+//go:embed queries/addAPIToken.sql
+var AddAPITokenCmd string
 
-//go:embed queries/queryVote.sql
-var VoteQuery string
+//go:embed queries/revokeAPIToken.sql
+var RevokeAPITokenCmd string
 
-//go:embed queries/addSchedule.sql
-var AddScheduleCmd string
+//go:embed queries/getFingerprints.sql
+var GetFingerprintsQuery string
 
-//go:embed queries/setSchedule.sql
-var SetScheduleCmd string
+//go:embed queries/setFingerprint.sql
+var SetFingerprintCmd string
 
-//go:embed queries/getSchedule.sql
-var GetScheduleQuery string
+//go:embed queries/getSongPlaylists.sql
+var GetSongPlaylistsQuery string
 
-//go:embed dbschemas/playlists.sql
-var SchemaPlaylists string
+//go:embed queries/delMergedEntries.sql
+var DelMergedEntriesCmd string
 
-//go:embed dbschemas/playlist_entries.sql
-var SchemaPlaylistEntries string
+//go:embed queries/moveSongEntries.sql
+var MoveSongEntriesCmd string
 
-//go:embed dbschemas/songs.sql
-var SchemaSongs string
+//go:embed queries/getSongVotes.sql
+var GetSongVotesQuery string
 
-//go:embed dbschemas/votes.sql
-var SchemaVotes string
+//go:embed queries/delVote.sql
+var DelVoteCmd string
 
-//go:embed dbschemas/schedule.sql
-var SchemaSchedule string
+//go:embed queries/moveSongVotes.sql
+var MoveSongVotesCmd string
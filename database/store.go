@@ -0,0 +1,130 @@
+package database
+
+import (
+	"errors"
+	"log"
+	"time"
+)
+
+// returned by a Store when the requested row doesn't exist
+var ErrNotFound = errors.New("not found")
+
+// Store is the storage backend behind the package-level functions.
+// Ids are passed the same way the console and the HTTP API receive them.
+type Store interface {
+	Playlists() ([]Playlist, error)
+	// returns the id of the new playlist; a non-zero playlist.Id is kept
+	AddPlaylist(playlist Playlist) (int, error)
+	DelPlaylist(playlistid string) error
+	SetPlaylistMode(playlistid, mode string) error
+
+	// entries in running order
+	PlaylistEntries(playlistid string) ([]PlaylistEntry, error)
+	// inserts the song at position, moving later entries down; 0 appends it
+	AddSongToPlaylist(playlistid, songid string, position int) error
+	// removes every entry of the song and closes the gaps
+	DelSongFromPlaylist(playlistid, songid string) error
+	// order lists current positions in their new running order;
+	// entries left out (e.g. of trashed songs) go after them
+	ReorderPlaylist(playlistid string, order []int) error
+
+	Songs() ([]SongData, error)
+	Song(songid string) (*SongData, error)
+	// returns the id of the new song; a non-zero song.SongId is kept
+	AddSong(song SongData) (int, error)
+	// overwrites everything but the id and dates, including genres and tags
+	UpdateSong(song SongData) error
+	// stores the result of a loudness analysis, which UpdateSong leaves alone
+	SetSongLoudness(songid int, loudness Loudness) error
+	// stores cue points, which UpdateSong leaves alone as well
+	SetSongCues(songid int, cues Cues) error
+	DelSong(songid string) error
+	// moves the playlist entries and votes of duplicate onto keep and trashes duplicate;
+	// returns the playlists whose entries changed
+	MergeSongs(keep, duplicate int) ([]int, error)
+
+	// fingerprints of the songs which aren't in the trash
+	Fingerprints() ([]Fingerprint, error)
+	// adds or replaces the fingerprint of fingerprint.SongId
+	SetFingerprint(fingerprint Fingerprint) error
+
+	// deleting only moves songs and playlists to the trash
+	TrashedSongs() ([]SongData, error)
+	TrashedPlaylists() ([]Playlist, error)
+	RestoreSong(songid string) error
+	RestorePlaylist(playlistid string) error
+	// permanently removes what was trashed before the cutoff, with its entries and votes
+	PurgeTrash(before time.Time) (int, error)
+
+	// votes submitted in [from, to)
+	Votes(songid string, votetype int, from, to time.Time) ([]Vote, error)
+	// adds a vote, or changes the type of the one the student already submitted in [from, to)
+	UpdateVote(student, songid string, votetype int, from, to time.Time) error
+	// stores a vote as it is, submit date included
+	ImportVote(vote Vote) error
+	// votes per song submitted in [from, to); songs without votes and trashed songs are left out
+	VoteTallies(from, to time.Time) ([]Tally, error)
+
+	VotingPeriods() ([]VotingPeriod, error)
+	// returns the id of the new period
+	AddVotingPeriod(period VotingPeriod) (int, error)
+	// adds the period unless one of the same kind starts at the same time,
+	// and returns the id of whichever is stored
+	EnsureVotingPeriod(period VotingPeriod) (int, error)
+	// archives the chart and marks the period closed
+	ClosePeriod(periodid int, chart []ChartPosition) error
+	PeriodResults(periodid int) ([]ChartPosition, error)
+	SongChart(songid string) ([]SongChartEntry, error)
+
+	// returns nil without an error if nothing was planned for that date
+	Schedule(date string) (Schedule, error)
+	SetSchedule(date string, schedule Schedule) error
+	ScheduleBlocks(q ScheduleQuery) ([]ScheduledBlock, error)
+
+	APITokens() ([]APIToken, error)
+	// returns ErrNotFound for unknown and revoked tokens
+	APITokenByHash(hash string) (*APIToken, error)
+	AddAPIToken(name, hash string) (int, error)
+	RevokeAPIToken(tokenid int) error
+
+	// runs fn in one transaction, which is rolled back if fn returns an error
+	Import(fn func(tx ImportTx) error) error
+
+	Close() error
+}
+
+// the writes of an archive import, which are applied all together or not at all
+type ImportTx interface {
+	AddSong(song SongData) (int, error)
+	AddPlaylist(playlist Playlist) (int, error)
+	AddSongToPlaylist(playlistid, songid string, position int) error
+	ImportVote(vote Vote) error
+	SetSchedule(date string, schedule Schedule) error
+}
+
+// backend in use, set by Init or SetStore
+var store Store
+
+// Init opens the backend selected by driver ("mysql" or "memory")
+func Init(driver, dsn string) {
+	var err error
+	switch driver {
+	case "mysql":
+		log.Println("Initializing MySQL")
+		store, err = NewMySQLStore(dsn)
+	case "memory":
+		log.Println("Initializing in-memory database")
+		store = NewMemoryStore()
+	default:
+		log.Fatalf("Unknown database driver '%s'\n", driver)
+	}
+
+	if err != nil {
+		log.Fatalf("Couldn't initialize database: %v\n", err)
+	}
+}
+
+// SetStore replaces the backend, e.g. with a memory store in tests
+func SetStore(s Store) {
+	store = s
+}
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"log"
+	"time"
+)
+
+// contents of the trash
+type Trash struct {
+	Songs     []SongData `json:"songs"`
+	Playlists []Playlist `json:"playlists"`
+}
+
+func GetTrash() (*Trash, error) {
+	songs, err := store.TrashedSongs()
+	if err != nil {
+		return nil, err
+	}
+	playlists, err := store.TrashedPlaylists()
+	if err != nil {
+		return nil, err
+	}
+	return &Trash{Songs: songs, Playlists: playlists}, nil
+}
+
+func RestoreSong(songid string) error {
+	err := store.RestoreSong(songid)
+	// restored songs bring their votes back
+	tallies.invalidate()
+	invalidateSearch()
+	return err
+}
+
+func RestorePlaylist(playlistid string) error {
+	defer invalidateSearch()
+	if err := store.RestorePlaylist(playlistid); err != nil {
+		return err
+	}
+	// the queue was emptied when the playlist went to the trash
+	OnPlaylistChange(playlistid)
+	return nil
+}
+
+// permanently removes whatever has been in the trash for longer than retention
+func PurgeTrash(retention time.Duration) (int, error) {
+	purged, err := store.PurgeTrash(time.Now().Add(-retention))
+	if purged > 0 {
+		tallies.invalidate()
+	}
+	return purged, err
+}
+
+// purges the trash now and then every hour
+func StartTrashPurger(retention time.Duration) {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		for {
+			purged, err := PurgeTrash(retention)
+			if err != nil {
+				log.Printf("DB error (trash purge): %v\n", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d items from the trash\n", purged)
+			}
+			<-ticker.C
+		}
+	}()
+}
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// tallies of the current voting week, loaded with one aggregate query
+// and dropped whenever a vote is written or the week changes
+type voteCache struct {
+	mutex  sync.Mutex
+	scores map[int]int
+	week   time.Time
+}
+
+var tallies voteCache
+
+func (c *voteCache) get() (map[int]int, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	start, end := CurrentWeek()
+	if c.scores == nil || !c.week.Equal(start) {
+		weekTallies, err := store.VoteTallies(start, end)
+		if err != nil {
+			return nil, err
+		}
+		c.scores = map[int]int{}
+		for _, tally := range weekTallies {
+			c.scores[tally.SongId] = tally.Score()
+		}
+		c.week = start
+	}
+	return c.scores, nil
+}
+
+func (c *voteCache) invalidate() {
+	c.mutex.Lock()
+	c.scores = nil
+	c.mutex.Unlock()
+}
+
+// VoteScores returns the net vote score per song id for the current week.
+// The returned map is shared and must not be modified.
+func VoteScores() map[int]int {
+	scores, err := tallies.get()
+	if err != nil {
+		log.Printf("DB error (vote scores): %v\n", err)
+		return map[int]int{}
+	}
+	return scores
+}
+
+// UpdateVote records a student's vote for the current week and refreshes the tallies
+func UpdateVote(student, songid string, votetype int) error {
+	start, end := CurrentWeek()
+	err := store.UpdateVote(student, songid, votetype, start, end)
+	tallies.invalidate()
+	return err
+}
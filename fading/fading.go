@@ -56,8 +56,15 @@ type Fader struct {
 	AudioLength float64
 	// ID so that it can persist itterators between bits of slices
 	Id int
-	// edit by radio
+	// edit by radio: set by Skip and FadeOut, the stream ends once it has faded out
 	Stop bool
+	// edit by radio: where in samples the fade out, and the next stream, begin
+	FadeStart float64
+}
+
+// edit by radio: streams which know where their outro starts, in samples; 0 means they don't
+type Outro interface {
+	OutroStart() int
 }
 
 func init() {
@@ -80,6 +87,8 @@ type OwnStreamer struct {
 	Faders []*Fader
 	Pos    int
 	Mixer  beep.Mixer
+	// edit by radio: set by FadeOut, no further stream starts
+	Ending bool
 }
 
 func (bs *OwnStreamer) Err() error {
@@ -109,14 +118,50 @@ func (bs *OwnStreamer) Stream(samples [][2]float64) (n int, ok bool) {
 	if len(ittrz) == 0 {
 		log.Println("new stream")
 		bs.Mixer.Add(beep.StreamerFunc(bs.Faders[bs.Pos].Stream))
-	} else if len(ittrz) > 0 && ittrz[1] >= fader.AudioLength-fader.TimeSpan {
-		bs.Mixer.Clear() // TODO make the Fader.Stream() phase out when skipping
+	} else if len(ittrz) > 0 && ittrz[1] >= fader.FadeStart && bs.Pos+1 < bs.Len() && !bs.Ending {
+		// edit by radio: the stream keeps fading out in the mixer until it ends, while the next one fades in
 		bs.Pos++
 	}
 
 	return bs.Mixer.Stream(samples)
 }
 
+// edit by radio: fades the current stream out from where it is, while the next one fades in
+func (bs *OwnStreamer) Skip() error {
+	if bs.Pos+1 >= bs.Len() || bs.Ending {
+		return fmt.Errorf("buffer: nothing to skip to after stream %v", bs.Pos)
+	}
+	if len(itters[bs.Pos]) == 0 {
+		// it hasn't started, so there's nothing to fade
+		bs.Pos++
+		return nil
+	}
+	bs.fadeOut()
+	return nil
+}
+
+// edit by radio: fades the current stream out from where it is, and ends there
+func (bs *OwnStreamer) FadeOut() {
+	bs.Ending = true
+	if bs.Pos < bs.Len() && len(itters[bs.Pos]) > 0 {
+		bs.fadeOut()
+	}
+}
+
+func (bs *OwnStreamer) fadeOut() {
+	fader := bs.Faders[bs.Pos]
+	ittrz := itters[bs.Pos]
+	if ittrz[1] >= fader.FadeStart {
+		// already fading out
+		return
+	}
+	fader.FadeStart = ittrz[1]
+	fader.AudioLength = math.Min(fader.AudioLength, ittrz[1]+fader.TimeSpan)
+	fader.Stop = true
+	// the fade out starts at full volume, even halfway through the fade in
+	ittrz[0] = 0
+}
+
 // CrossfadeStream crossfades between all songs specified in files
 // The sample-rates between the two streams must be the same, otherwise weird things might happen
 // If opts is nil, then reasonable defaults are used
@@ -140,6 +185,11 @@ func CrossfadeStream(format beep.Format, opts *Options, streams ...beep.StreamSe
 	for id, stream := range streams {
 		// Create the set of parameters for it's stream function
 		var faderStream = &Fader{Streamer: stream, Volume: volume, TimeSpan: float64(format.SampleRate.N(timeSpan)), AudioLength: float64(stream.Len()), Id: id, Stop: false}
+		// edit by radio: fade out over the outro, or over the last TimeSpan
+		faderStream.FadeStart = faderStream.AudioLength - faderStream.TimeSpan
+		if outro, ok := stream.(Outro); ok && outro.OutroStart() > 0 {
+			faderStream.FadeStart = float64(outro.OutroStart())
+		}
 		// Create streamer with fading applied
 		//changedStreamer := beep.StreamerFunc(faderStream.Stream)
 		// Create amount of silence before playing sound. Uses position, which by itself would make it play after the previous song. Subtracting lastTimeSpan makes a crossfade effect
@@ -202,19 +252,20 @@ func (v *Fader) Stream(samples [][2]float64) (n int, ok bool) {
 	var y2 = gain
 	// Create the slope for a line representing this
 	slopeUp := slopeCalc(x1, y1, x2, y2)
-	//slopeDown := slopeCalc(x1, y2, x2, y1)
+	// edit by radio: fade out from FadeStart to the end
+	slopeDown := slopeCalc(v.FadeStart, y2, v.AudioLength, y1)
 	// By default, sampleGain is the requested gain so between fadepoints, it is normal
 	var sampleGain = gain
 	// For each recieved sample, apply fade to it if necessary
 	for i := range samples[:n] {
 		// If the position in the track is after or at the time where it should begin to fade, then fade
-		if *trackItter >= v.AudioLength-v.TimeSpan {
+		if *trackItter >= v.FadeStart { // edit by radio
 			// Slope-intercept form to get gain
 			/*
 				m					x 							+ 	b
 				Calculated slope	The position in the fade		The y intercept of the gain, so that it fades down from the gain
 			*/
-			sampleGain = -slopeUp*float64(*fadeItter) + gain
+			sampleGain = slopeDown*float64(*fadeItter) + gain // edit by radio
 			// Increment fade so that the next iteration will reduce the gain by more
 			*fadeItter++
 			// Prevents possible bug where the gain may become negative, which will result in the song's gain becoming high again
@@ -242,6 +293,11 @@ func (v *Fader) Stream(samples [][2]float64) (n int, ok bool) {
 		*trackItter++
 	}
 
+	// edit by radio: a skipped stream is done once faded out, rather than playing on silently
+	if v.Stop && *trackItter >= v.AudioLength {
+		return n, false
+	}
+
 	if debug%int64(100) == 0 {
 		log.Println("doing")
 	}
@@ -251,6 +307,14 @@ func (v *Fader) Stream(samples [][2]float64) (n int, ok bool) {
 	return n, ok // edit by radio
 }
 
+// edit by radio: how far into the stream playback is, in samples
+func (v *Fader) Position() int {
+	if ittrz, ok := itters[v.Id]; ok {
+		return int(ittrz[1])
+	}
+	return 0
+}
+
 // Calculates the slope between two points
 func slopeCalc(x1 float64, y1 float64, x2 float64, y2 float64) float64 {
 	return (y2 - y1) / (x2 - x1)
@@ -8,10 +8,13 @@ require github.com/go-sql-driver/mysql v1.6.0
 
 require github.com/faiface/beep v1.1.0
 
+require github.com/jfreymuth/oggvorbis v1.0.5
+
+require github.com/hajimehoshi/oto v0.7.1
+
 require (
 	github.com/Programmerino/beepFade v0.0.0-20190629210434-15545366e670 // indirect
 	github.com/hajimehoshi/go-mp3 v0.3.0 // indirect
-	github.com/hajimehoshi/oto v0.7.1 // indirect
 	github.com/icza/bitio v1.0.0 // indirect
 	github.com/mewkiz/flac v1.0.7 // indirect
 	github.com/mewkiz/pkg v0.0.0-20190919212034-518ade7978e2 // indirect
@@ -0,0 +1,463 @@
+package library
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	_ "image/png"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"radio/database"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// cover files looked for in a song's folder before falling back on embedded art
+var coverFiles = []string{"cover.jpg", "cover.jpeg", "cover.png"}
+
+// thumbnails are never bigger than this, whatever size is asked for
+const maxThumbSize = 1024
+
+// how many thumbnails are kept in memory
+const maxCachedThumbs = 512
+
+// covers with more pixels than this aren't decoded, as each one takes 4 bytes of memory
+const maxCoverPixels = 4096 * 4096
+
+var ErrNoCover = errors.New("song has no cover")
+var ErrCoverTooLarge = fmt.Errorf("cover is larger than %d megapixels", maxCoverPixels/1000000)
+
+// checks the dimensions in the header, so an image is only decoded if it's small enough
+func checkCoverSize(config image.Config) error {
+	if config.Width <= 0 || config.Height <= 0 {
+		return errors.New("cover has no pixels")
+	}
+	if config.Width*config.Height > maxCoverPixels {
+		return ErrCoverTooLarge
+	}
+	return nil
+}
+
+type Cover struct {
+	Data []byte
+	// "jpeg" or "png"
+	Format  string
+	ModTime time.Time
+}
+
+func (c *Cover) ContentType() string {
+	return "image/" + c.Format
+}
+
+// where a song's cover comes from; embedded covers are read out of the audio file
+type coverSource struct {
+	path     string
+	embedded bool
+	modTime  time.Time
+	size     int64
+}
+
+// changes whenever the source file does
+func (s coverSource) etag(size int) string {
+	return fmt.Sprintf(`"%x-%x-%d"`, s.modTime.UnixNano(), s.size, size)
+}
+
+func findCoverSource(songid int) (coverSource, error) {
+	dir := filepath.Join(database.MusicDir, strconv.Itoa(songid))
+	for _, name := range coverFiles {
+		if info, err := os.Stat(filepath.Join(dir, name)); err == nil && info.Mode().IsRegular() {
+			return coverSource{path: filepath.Join(dir, name), modTime: info.ModTime(), size: info.Size()}, nil
+		}
+	}
+
+	file := AudioFile(songid)
+	if file == "" {
+		return coverSource{}, ErrNoCover
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return coverSource{}, err
+	}
+	return coverSource{path: file, embedded: true, modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+// checks that data is a JPEG or PNG image and says which
+func coverFormat(data []byte) (string, error) {
+	_, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || (format != "jpeg" && format != "png") {
+		return "", errors.New("cover must be a JPEG or PNG image")
+	}
+	return format, nil
+}
+
+func (s coverSource) load() (*Cover, error) {
+	var data []byte
+	var err error
+	if s.embedded {
+		data, err = EmbeddedCover(s.path)
+	} else {
+		data, err = ioutil.ReadFile(s.path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	format, err := coverFormat(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", s.path, err)
+	}
+	return &Cover{Data: data, Format: format, ModTime: s.modTime}, nil
+}
+
+// returns the cover in the song's folder, or else the one embedded in its audio
+func GetCover(songid int) (*Cover, error) {
+	source, err := findCoverSource(songid)
+	if err != nil {
+		return nil, err
+	}
+	return source.load()
+}
+
+// the picture type ID3 and FLAC use for front covers
+const frontCover = 3
+
+// returns the picture embedded in an mp3 or flac, preferring the front cover
+func EmbeddedCover(file string) ([]byte, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var picture []byte
+	found := false
+	keep := func(picType byte, data []byte) {
+		if len(data) > 0 && (picture == nil || (picType == frontCover && !found)) {
+			picture = data
+			found = picType == frontCover
+		}
+	}
+
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".mp3":
+		err = id3Frames(f, func(id string, data []byte) {
+			if id == "APIC" || id == "PIC" {
+				if picType, picData, ok := id3Picture(id, data); ok {
+					keep(picType, picData)
+				}
+			}
+		})
+	case ".flac":
+		err = flacBlocks(f, func(blockType byte, block []byte) error {
+			if blockType == 6 {
+				if picType, picData, ok := flacPicture(block); ok {
+					keep(picType, picData)
+				}
+			}
+			return nil
+		})
+	default:
+		return nil, ErrNoCover
+	}
+	if err == ErrNoTags || (err == nil && picture == nil) {
+		return nil, ErrNoCover
+	}
+	if err != nil {
+		return nil, err
+	}
+	return picture, nil
+}
+
+// skips a zero terminated string in the given ID3 text encoding
+func skipID3String(encoding byte, b []byte) ([]byte, bool) {
+	if encoding == 1 || encoding == 2 {
+		for i := 0; i+1 < len(b); i += 2 {
+			if b[i] == 0 && b[i+1] == 0 {
+				return b[i+2:], true
+			}
+		}
+		return nil, false
+	}
+	if end := bytes.IndexByte(b, 0); end >= 0 {
+		return b[end+1:], true
+	}
+	return nil, false
+}
+
+// splits an APIC frame, or a v2.2 PIC one, into the picture type and data
+func id3Picture(id string, data []byte) (byte, []byte, bool) {
+	if len(data) < 2 {
+		return 0, nil, false
+	}
+	encoding, rest := data[0], data[1:]
+	if id == "PIC" {
+		// three letter image format instead of a MIME type
+		if len(rest) < 4 {
+			return 0, nil, false
+		}
+		rest = rest[3:]
+	} else {
+		var ok bool
+		if rest, ok = skipID3String(0, rest); !ok || len(rest) < 1 {
+			return 0, nil, false
+		}
+	}
+	picType := rest[0]
+	rest, ok := skipID3String(encoding, rest[1:])
+	return picType, rest, ok
+}
+
+// splits a FLAC PICTURE block into the picture type and data
+func flacPicture(block []byte) (byte, []byte, bool) {
+	field := func() ([]byte, bool) {
+		if len(block) < 4 {
+			return nil, false
+		}
+		length := binary.BigEndian.Uint32(block)
+		if uint64(length) > uint64(len(block)-4) {
+			return nil, false
+		}
+		value := block[4 : 4+length]
+		block = block[4+length:]
+		return value, true
+	}
+
+	if len(block) < 4 {
+		return 0, nil, false
+	}
+	picType := binary.BigEndian.Uint32(block)
+	block = block[4:]
+	if _, ok := field(); !ok { // MIME type
+		return 0, nil, false
+	}
+	if _, ok := field(); !ok { // description
+		return 0, nil, false
+	}
+	// width, height, colour depth and palette size
+	if len(block) < 16 {
+		return 0, nil, false
+	}
+	block = block[16:]
+	data, ok := field()
+	if picType > 255 {
+		picType = 0
+	}
+	return byte(picType), data, ok
+}
+
+// shrinks the image to fit in size x size by averaging the pixels each
+// thumbnail pixel covers; images which already fit are returned as they are
+func resize(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= size && height <= size {
+		return img
+	}
+
+	thumbWidth, thumbHeight := size, size
+	if width > height {
+		thumbHeight = height * size / width
+	} else {
+		thumbWidth = width * size / height
+	}
+	if thumbWidth < 1 {
+		thumbWidth = 1
+	}
+	if thumbHeight < 1 {
+		thumbHeight = 1
+	}
+
+	// the source is converted a row at a time rather than copied whole
+	row := image.NewRGBA(image.Rect(0, 0, width, 1))
+	thumb := image.NewRGBA(image.Rect(0, 0, thumbWidth, thumbHeight))
+	sums := make([]int, thumbWidth*4)
+
+	for y := 0; y < thumbHeight; y++ {
+		y0, y1 := y*height/thumbHeight, (y+1)*height/thumbHeight
+		if y1 == y0 {
+			y1++
+		}
+		for i := range sums {
+			sums[i] = 0
+		}
+		for sy := y0; sy < y1; sy++ {
+			draw.Draw(row, row.Bounds(), img, image.Pt(bounds.Min.X, bounds.Min.Y+sy), draw.Src)
+			for x := 0; x < thumbWidth; x++ {
+				x0, x1 := x*width/thumbWidth, (x+1)*width/thumbWidth
+				if x1 == x0 {
+					x1++
+				}
+				sum := sums[x*4 : x*4+4]
+				pixels := row.Pix[x0*4 : x1*4]
+				for i := 0; i < len(pixels); i += 4 {
+					sum[0] += int(pixels[i])
+					sum[1] += int(pixels[i+1])
+					sum[2] += int(pixels[i+2])
+					sum[3] += int(pixels[i+3])
+				}
+			}
+		}
+		for x := 0; x < thumbWidth; x++ {
+			x0, x1 := x*width/thumbWidth, (x+1)*width/thumbWidth
+			if x1 == x0 {
+				x1++
+			}
+			count := (y1 - y0) * (x1 - x0)
+			pixel := thumb.Pix[y*thumb.Stride+x*4:]
+			for i, sum := range sums[x*4 : x*4+4] {
+				pixel[i] = uint8(sum / count)
+			}
+		}
+	}
+	return thumb
+}
+
+// returns the cover scaled down to fit in size x size, as a JPEG
+func Thumbnail(cover *Cover, size int) (*Cover, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(cover.Data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width <= size && config.Height <= size {
+		return cover, nil
+	}
+	if err := checkCoverSize(config); err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(cover.Data))
+	if err != nil {
+		return nil, err
+	}
+
+	var buffer bytes.Buffer
+	if err := jpeg.Encode(&buffer, resize(img, size), &jpeg.Options{Quality: 85}); err != nil {
+		return nil, err
+	}
+	return &Cover{Data: buffer.Bytes(), Format: "jpeg", ModTime: cover.ModTime}, nil
+}
+
+type cachedCover struct {
+	etag  string
+	cover *Cover
+}
+
+var coverCacheMutex sync.Mutex
+
+// keyed by "<song id>/<size>"
+var coverCache = map[string]cachedCover{}
+
+// returns the cover of the given size, from the cache while its source is unchanged;
+// full size covers, size 0, are read from their file every time instead of being kept
+func cachedThumbnail(songid int, source coverSource, size int) (*Cover, error) {
+	if size == 0 {
+		return source.load()
+	}
+	key := strconv.Itoa(songid) + "/" + strconv.Itoa(size)
+	etag := source.etag(size)
+
+	coverCacheMutex.Lock()
+	cached, ok := coverCache[key]
+	coverCacheMutex.Unlock()
+	if ok && cached.etag == etag {
+		return cached.cover, nil
+	}
+
+	cover, err := source.load()
+	if err != nil {
+		return nil, err
+	}
+	if cover, err = Thumbnail(cover, size); err != nil {
+		return nil, err
+	}
+
+	coverCacheMutex.Lock()
+	if _, ok := coverCache[key]; !ok && len(coverCache) >= maxCachedThumbs {
+		// any entry will do, listeners mostly ask for the same few sizes
+		for old := range coverCache {
+			delete(coverCache, old)
+			break
+		}
+	}
+	coverCache[key] = cachedCover{etag: etag, cover: cover}
+	coverCacheMutex.Unlock()
+	return cover, nil
+}
+
+// whether the client's copy is still current, going by If-None-Match or else If-Modified-Since
+func notModified(r *http.Request, etag string, modTime time.Time) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == etag || candidate == "*" {
+				return true
+			}
+		}
+		return false
+	}
+	if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil {
+		// the header only has whole seconds
+		return !modTime.Truncate(time.Second).After(since)
+	}
+	return false
+}
+
+// ?id=<song id>&size=<longest side in pixels, the original if left out>
+func HTTPGetCover(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	songid, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	size := 0
+	if value := r.URL.Query().Get("size"); value != "" {
+		if size, err = strconv.Atoi(value); err != nil || size < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if size > maxThumbSize {
+			size = maxThumbSize
+		}
+	}
+
+	source, err := findCoverSource(songid)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	etag := source.etag(size)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", source.modTime.UTC().Format(http.TimeFormat))
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	// answered before the cover is read, which is the point
+	if notModified(r, etag, source.modTime) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	cover, err := cachedThumbnail(songid, source, size)
+	if err != nil {
+		if err != ErrNoCover {
+			log.Printf("Couldn't load the cover of song %d: %v\n", songid, err)
+		}
+		w.Header().Del("ETag")
+		w.Header().Del("Last-Modified")
+		w.Header().Del("Cache-Control")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", cover.ContentType())
+	http.ServeContent(w, r, "", source.modTime, bytes.NewReader(cover.Data))
+}
@@ -0,0 +1,118 @@
+package library
+
+import (
+	"encoding/binary"
+	"image"
+	"testing"
+)
+
+func TestID3Picture(t *testing.T) {
+	tests := []struct {
+		name     string
+		id       string
+		data     string
+		wantType byte
+		wantData string
+		wantOk   bool
+	}{
+		{"APIC", "APIC", "\x00image/jpeg\x00\x03desc\x00JPEG", 3, "JPEG", true},
+		{"UTF-16 description", "APIC", "\x01image/png\x00\x03d\x00e\x00\x00\x00PNG", 3, "PNG", true},
+		{"zero byte inside UTF-16", "APIC", "\x01image/png\x00\x03\x00d\x00\x00PNG", 3, "PNG", true},
+		{"PIC", "PIC", "\x00JPG\x00\x00JPEG", 0, "JPEG", true},
+		{"empty picture", "APIC", "\x00image/jpeg\x00\x03\x00", 3, "", true},
+		{"empty", "APIC", "", 0, "", false},
+		{"only the encoding", "APIC", "\x00", 0, "", false},
+		{"unterminated MIME type", "APIC", "\x00image/jpeg", 0, "", false},
+		{"no picture type", "APIC", "\x00image/jpeg\x00", 0, "", false},
+		{"unterminated description", "APIC", "\x00image/jpeg\x00\x03desc", 0, "", false},
+		{"odd UTF-16 description", "APIC", "\x01image/png\x00\x03d\x00", 0, "", false},
+		{"short PIC", "PIC", "\x00JP", 0, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			picType, data, ok := id3Picture(tt.id, []byte(tt.data))
+			if ok != tt.wantOk {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOk)
+			}
+			if ok && (picType != tt.wantType || string(data) != tt.wantData) {
+				t.Errorf("id3Picture = %d, %q, want %d, %q", picType, data, tt.wantType, tt.wantData)
+			}
+		})
+	}
+}
+
+// a PICTURE block; lengths that are negative are replaced with the real ones
+func flacPictureBlock(picType uint32, mime string, mimeLength int, data string, dataLength int) []byte {
+	field := func(b []byte, value string, length int) []byte {
+		if length < 0 {
+			length = len(value)
+		}
+		b = append(b, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(b[len(b)-4:], uint32(length))
+		return append(b, value...)
+	}
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, picType)
+	b = field(b, mime, mimeLength)
+	b = field(b, "", -1)
+	b = append(b, make([]byte, 16)...)
+	return field(b, data, dataLength)
+}
+
+func TestFLACPicture(t *testing.T) {
+	tests := []struct {
+		name     string
+		block    []byte
+		wantType byte
+		wantData string
+		wantOk   bool
+	}{
+		{"front cover", flacPictureBlock(3, "image/png", -1, "PNG", -1), 3, "PNG", true},
+		{"picture type out of range", flacPictureBlock(1000, "image/png", -1, "PNG", -1), 0, "PNG", true},
+		{"empty", nil, 0, "", false},
+		{"only the type", []byte{0, 0, 0, 3}, 0, "", false},
+		{"MIME type past the end", flacPictureBlock(3, "image/png", 1000, "PNG", -1), 0, "", false},
+		{"MIME type length with the top bit set", flacPictureBlock(3, "image/png", 0xffffffff, "PNG", -1), 0, "", false},
+		{"data past the end", flacPictureBlock(3, "image/png", -1, "PNG", 4), 0, "", false},
+		{"data length with the top bit set", flacPictureBlock(3, "image/png", -1, "PNG", 0xfffffffc), 0, "", false},
+		{"no dimensions", flacPictureBlock(3, "image/png", -1, "PNG", -1)[:25], 0, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			picType, data, ok := flacPicture(tt.block)
+			if ok != tt.wantOk {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOk)
+			}
+			if ok && (picType != tt.wantType || string(data) != tt.wantData) {
+				t.Errorf("flacPicture = %d, %q, want %d, %q", picType, data, tt.wantType, tt.wantData)
+			}
+		})
+	}
+}
+
+func TestCheckCoverSize(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height int
+		wantErr       bool
+	}{
+		{"small", 600, 600, false},
+		{"at the limit", 4096, 4096, false},
+		{"over the limit", 4097, 4096, true},
+		{"long and thin", 1, maxCoverPixels + 1, true},
+		{"huge in both", 1 << 30, 1 << 30, true},
+		{"no width", 0, 600, true},
+		{"negative height", 600, -1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkCoverSize(image.Config{Width: tt.width, Height: tt.height})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, want an error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
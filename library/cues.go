@@ -0,0 +1,252 @@
+package library
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"radio/database"
+	"radio/utils"
+
+	"github.com/faiface/beep"
+	"github.com/julienschmidt/httprouter"
+)
+
+// levels are measured over windows this many milliseconds long
+const cueWindow = 10
+
+// windows under this level in dBFS count as silence
+const silenceLevel = -50.0
+
+// the intro ends and the outro starts where a second of audio gets within
+// this many dB of the song's average level, or drops below it
+const loudMargin = 6.0
+
+// intros and outros shorter than this many milliseconds aren't marked
+const minCuePart = 2000
+
+type cueScanner struct {
+	channels     int
+	windowLength int
+	sum          float64
+	inWindow     int
+	// the mean square of every window
+	powers []float64
+}
+
+func newCueScanner(rate float64, channels int) *cueScanner {
+	if channels > 2 {
+		channels = 2
+	}
+	return &cueScanner{channels: channels, windowLength: int(rate * cueWindow / 1000)}
+}
+
+func (c *cueScanner) write(samples [][2]float64) {
+	for _, sample := range samples {
+		if c.channels == 1 {
+			c.sum += sample[0] * sample[0]
+		} else {
+			c.sum += (sample[0]*sample[0] + sample[1]*sample[1]) / 2
+		}
+		c.inWindow++
+		if c.inWindow == c.windowLength {
+			c.powers = append(c.powers, c.sum/float64(c.windowLength))
+			c.sum = 0
+			c.inWindow = 0
+		}
+	}
+}
+
+func decibels(power float64) float64 {
+	return 10 * math.Log10(power)
+}
+
+func (c *cueScanner) result() (*database.Cues, error) {
+	silence := math.Pow(10, silenceLevel/10)
+	first, last := -1, -1
+	for i, power := range c.powers {
+		if power > silence {
+			if first == -1 {
+				first = i
+			}
+			last = i
+		}
+	}
+	if first == -1 {
+		return nil, ErrSilent
+	}
+	cues := &database.Cues{CueIn: first * cueWindow, CueOut: (last + 1) * cueWindow}
+
+	// the average level of the song between the cues, and running sums for the level over a second
+	sums := make([]float64, len(c.powers)+1)
+	for i, power := range c.powers {
+		sums[i+1] = sums[i] + power
+	}
+	average := (sums[last+1] - sums[first]) / float64(last+1-first)
+	loud := math.Pow(10, (decibels(average)-loudMargin)/10)
+	second := 1000 / cueWindow
+	if last+1-first < second {
+		return cues, nil
+	}
+	secondAt := func(start int) float64 {
+		return (sums[start+second] - sums[start]) / float64(second)
+	}
+
+	// the first and last loud seconds, narrowed down to their first and last loud window
+	for i := first; i+second <= last+1; i++ {
+		if secondAt(i) >= loud {
+			for c.powers[i] < loud {
+				i++
+			}
+			if i*cueWindow-cues.CueIn >= minCuePart {
+				cues.IntroEnd = i * cueWindow
+			}
+			break
+		}
+	}
+	for i := last + 1 - second; i >= first; i-- {
+		if secondAt(i) >= loud {
+			end := i + second - 1
+			for c.powers[end] < loud {
+				end--
+			}
+			if cues.CueOut-(end+1)*cueWindow >= minCuePart {
+				cues.OutroStart = (end + 1) * cueWindow
+			}
+			break
+		}
+	}
+	if cues.IntroEnd != 0 && cues.OutroStart != 0 && cues.OutroStart < cues.IntroEnd {
+		cues.IntroEnd, cues.OutroStart = 0, 0
+	}
+	return cues, nil
+}
+
+// finds the cue points of a file from its silences and levels
+func DetectCues(file string) (*database.Cues, error) {
+	var scanner *cueScanner
+	err := scanAudio(file, func(format beep.Format) audioScanner {
+		scanner = newCueScanner(float64(format.SampleRate), format.NumChannels)
+		return scanner
+	})
+	if err != nil {
+		return nil, err
+	}
+	return scanner.result()
+}
+
+type CueResult struct {
+	SongId  int            `json:"song_id"`
+	Authors string         `json:"authors"`
+	Title   string         `json:"title"`
+	Cues    *database.Cues `json:"cues,omitempty"`
+	Error   string         `json:"error,omitempty"`
+}
+
+// detects and stores the cue points of the song with songid, or of every song
+// if it's empty; without all, songs which have cues already are skipped
+func DetectSongCues(songid string, all bool) ([]CueResult, error) {
+	songs, err := selectSongs(songid)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []CueResult
+	for _, song := range songs {
+		if song.Cues != nil && !all && songid == "" {
+			continue
+		}
+		result := CueResult{SongId: song.SongId, Authors: song.Authors, Title: song.Title}
+		var cues *database.Cues
+		err := ErrNoAudio
+		if file := AudioFile(song.SongId); file != "" {
+			cues, err = DetectCues(file)
+		}
+		if err == nil {
+			err = database.SetSongCues(song.SongId, *cues)
+			if err != nil {
+				log.Printf("DB error (cues): %v\n", err)
+			}
+		}
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Cues = cues
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// ?id=<song id>&cue_in=&intro_end=&outro_start=&cue_out= in milliseconds, fields left out keep
+// their stored values; or ?id=<song id>&detect=true to find them from the audio again
+func HTTPUpdateCues(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	query := r.URL.Query()
+	song := database.GetSongData(query.Get("id"))
+	if song == nil {
+		utils.SendErrorJSON(w, r, "No song with id "+query.Get("id")+" found")
+		return
+	}
+
+	if detect, _ := strconv.ParseBool(query.Get("detect")); detect {
+		results, err := DetectSongCues(strconv.Itoa(song.SongId), true)
+		if err != nil {
+			utils.SendErrorJSON(w, r, "Unknown error")
+			log.Printf("DB error (cues): %v\n", err)
+			return
+		}
+		if results[0].Error != "" {
+			utils.SendErrorJSON(w, r, results[0].Error)
+			return
+		}
+		j, _ := utils.JSONMarshal(results[0].Cues)
+		utils.SendJSON(w, r, j)
+		return
+	}
+
+	var cues database.Cues
+	if song.Cues != nil {
+		cues = *song.Cues
+	}
+	fields := []struct {
+		name  string
+		value *int
+	}{
+		{"cue_in", &cues.CueIn},
+		{"intro_end", &cues.IntroEnd},
+		{"outro_start", &cues.OutroStart},
+		{"cue_out", &cues.CueOut},
+	}
+	for _, field := range fields {
+		value := query.Get(field.name)
+		if value == "" {
+			continue
+		}
+		ms, err := strconv.Atoi(value)
+		if err != nil || ms < 0 {
+			utils.SendErrorJSON(w, r, field.name+" must be a number of milliseconds")
+			return
+		}
+		*field.value = ms
+	}
+
+	if err := cues.Validate(); err != nil {
+		utils.SendErrorJSON(w, r, err.Error())
+		return
+	}
+	err := database.SetSongCues(song.SongId, cues)
+	if err == database.ErrNotFound {
+		utils.SendErrorJSON(w, r, "No song with id "+query.Get("id")+" found")
+		return
+	}
+	if err != nil {
+		utils.SendErrorJSON(w, r, "Unknown error")
+		log.Printf("DB error (cues): %v\n", err)
+		return
+	}
+
+	j, _ := utils.JSONMarshal(cues)
+
+	utils.SendJSON(w, r, j)
+}
@@ -0,0 +1,123 @@
+package library
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"radio/database"
+)
+
+// a stretch of audio at a steady level
+type level struct {
+	ms int
+	db float64
+}
+
+// the window powers of the levels one after another
+func windowPowers(levels ...level) []float64 {
+	var powers []float64
+	for _, l := range levels {
+		for i := 0; i < l.ms/cueWindow; i++ {
+			powers = append(powers, math.Pow(10, l.db/10))
+		}
+	}
+	return powers
+}
+
+func TestCueScannerResult(t *testing.T) {
+	silent := math.Inf(-1)
+	withNaN := windowPowers(level{3000, -10})
+	withNaN[120] = math.NaN()
+	withInf := windowPowers(level{3000, -10})
+	withInf[150] = math.Inf(1)
+
+	tests := []struct {
+		name    string
+		powers  []float64
+		want    *database.Cues
+		wantErr error
+	}{
+		{
+			name:   "silence around the song",
+			powers: windowPowers(level{500, silent}, level{10000, -10}, level{300, silent}),
+			want:   &database.Cues{CueIn: 500, CueOut: 10500},
+		},
+		{
+			name:   "quiet intro and outro",
+			powers: windowPowers(level{1000, silent}, level{3000, -40}, level{10000, -10}, level{4000, -40}, level{500, silent}),
+			want:   &database.Cues{CueIn: 1000, IntroEnd: 4000, OutroStart: 14000, CueOut: 18000},
+		},
+		{
+			name:   "intro too short to mark",
+			powers: windowPowers(level{1000, -40}, level{10000, -10}),
+			want:   &database.Cues{CueOut: 11000},
+		},
+		{
+			name:   "under a second of audio",
+			powers: windowPowers(level{200, silent}, level{500, -10}),
+			want:   &database.Cues{CueIn: 200, CueOut: 700},
+		},
+		{
+			name:   "a single window",
+			powers: []float64{0.5},
+			want:   &database.Cues{CueOut: cueWindow},
+		},
+		{
+			name:   "NaN window",
+			powers: withNaN,
+			want:   &database.Cues{CueOut: 3000},
+		},
+		{
+			name:   "infinite window",
+			powers: withInf,
+			want:   &database.Cues{CueOut: 3000},
+		},
+		{
+			name:    "no windows",
+			wantErr: ErrSilent,
+		},
+		{
+			name:    "below the silence level",
+			powers:  windowPowers(level{5000, -60}),
+			wantErr: ErrSilent,
+		},
+		{
+			name:    "all NaN",
+			powers:  []float64{math.NaN(), math.NaN()},
+			wantErr: ErrSilent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanner := &cueScanner{powers: tt.powers}
+			cues, err := scanner.result()
+			if err != tt.wantErr {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(cues, tt.want) {
+				t.Errorf("cues = %+v, want %+v", cues, tt.want)
+			}
+			if cues != nil {
+				if err := cues.Validate(); err != nil {
+					t.Errorf("cues %+v don't validate: %v", cues, err)
+				}
+			}
+		})
+	}
+}
+
+func TestCueScannerWindows(t *testing.T) {
+	scanner := newCueScanner(1000, 6)
+	// two whole windows and part of a third, which isn't counted
+	samples := make([][2]float64, 2*cueWindow+3)
+	for i := range samples {
+		samples[i] = [2]float64{1, 0}
+	}
+	scanner.write(samples[:7])
+	scanner.write(samples[7:])
+	if want := []float64{0.5, 0.5}; !reflect.DeepEqual(scanner.powers, want) {
+		t.Errorf("powers = %v, want %v", scanner.powers, want)
+	}
+}
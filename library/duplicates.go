@@ -0,0 +1,362 @@
+package library
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"radio/database"
+	"radio/utils"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// why two songs are reported as duplicates
+const (
+	// their audio files are byte for byte the same
+	SameFile = "same_file"
+	// their fingerprints match, e.g. the same recording encoded twice
+	SameRecording = "same_recording"
+	// the authors overlap, the titles nearly match and so do the lengths
+	SameMetadata = "same_metadata"
+)
+
+// fingerprints matching in this share of bits come from the same recording
+const sameRecordingSimilarity = 0.8
+
+// normalised titles at least this similar count as the same title
+const sameTitleSimilarity = 0.85
+
+// songs whose lengths differ by more seconds aren't the same recording
+const maxLengthDifference = 10
+
+// parts of titles which say nothing about the song, e.g. "(Official Video)"
+var bracketed = regexp.MustCompile(`\([^)]*\)|\[[^\]]*\]|\{[^}]*\}`)
+
+// title words which describe the upload rather than the song
+var noiseWords = map[string]bool{
+	"official": true, "video": true, "audio": true, "lyrics": true, "lyric": true,
+	"hd": true, "hq": true, "4k": true, "remastered": true, "remaster": true,
+}
+
+// words which separate the names of authors
+var authorSeparators = map[string]bool{
+	"feat": true, "ft": true, "featuring": true, "and": true, "x": true, "vs": true, "with": true,
+}
+
+func words(s string) []string {
+	return strings.FieldsFunc(database.FoldText(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// folds case and diacritics and drops bracketed parts, featured authors and noise words
+func normalizeTitle(title string) string {
+	title = bracketed.ReplaceAllString(database.FoldText(title), " ")
+	var kept []string
+	for _, word := range words(title) {
+		if word == "feat" || word == "ft" || word == "featuring" {
+			break
+		}
+		if !noiseWords[word] {
+			kept = append(kept, word)
+		}
+	}
+	return strings.Join(kept, " ")
+}
+
+// splits authors into normalised names, e.g. "Queen & David Bowie" into "queen" and "david bowie"
+func normalizeAuthors(authors string) []string {
+	authors = strings.NewReplacer(",", " , ", "&", " , ", "+", " , ", ";", " , ", "/", " , ").Replace(authors)
+	var names []string
+	var name []string
+	flush := func() {
+		if len(name) > 0 {
+			names = append(names, strings.Join(name, " "))
+			name = nil
+		}
+	}
+	for _, field := range strings.Fields(database.FoldText(authors)) {
+		if field == "," {
+			flush()
+			continue
+		}
+		for _, word := range words(field) {
+			if authorSeparators[word] {
+				flush()
+			} else {
+				name = append(name, word)
+			}
+		}
+	}
+	flush()
+	return names
+}
+
+// true if a and b share a name, or neither has any
+func authorsOverlap(a, b []string) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// one minus the edit distance between a and b relative to the longer one
+func textSimilarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	ra, rb := []rune(a), []rune(b)
+	longer := len(ra)
+	if len(rb) > longer {
+		longer = len(rb)
+	}
+
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = previous[j-1] + cost
+			if previous[j]+1 < current[j] {
+				current[j] = previous[j] + 1
+			}
+			if current[j-1]+1 < current[j] {
+				current[j] = current[j-1] + 1
+			}
+		}
+		previous, current = current, previous
+	}
+	return 1 - float64(previous[len(rb)])/float64(longer)
+}
+
+// returns the sha256 of the file, hex encoded
+func hashFile(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// hashes and fingerprints the audio of the song and stores both for FindDuplicates,
+// which is done when songs are added and by song fingerprint
+func FingerprintSong(songid int) error {
+	file := AudioFile(songid)
+	if file == "" {
+		return ErrNoAudio
+	}
+	hash, err := hashFile(file)
+	if err != nil {
+		return err
+	}
+	data, err := FingerprintFile(file)
+	if err != nil {
+		return err
+	}
+	return database.SetFingerprint(database.Fingerprint{SongId: songid, ContentHash: hash, Data: data})
+}
+
+type FingerprintResult struct {
+	SongId  int    `json:"song_id"`
+	Authors string `json:"authors"`
+	Title   string `json:"title"`
+	Error   string `json:"error,omitempty"`
+}
+
+// fingerprints the song with songid, or every song if it's empty; without all,
+// songs which have a fingerprint already are skipped, e.g. ones from before fingerprinting at import
+func FingerprintSongs(songid string, all bool) ([]FingerprintResult, error) {
+	songs, err := selectSongs(songid)
+	if err != nil {
+		return nil, err
+	}
+	fingerprinted := map[int]bool{}
+	if !all && songid == "" {
+		fingerprints, err := database.GetFingerprints()
+		if err != nil {
+			return nil, err
+		}
+		for _, fingerprint := range fingerprints {
+			fingerprinted[fingerprint.SongId] = true
+		}
+	}
+
+	var results []FingerprintResult
+	for _, song := range songs {
+		if fingerprinted[song.SongId] {
+			continue
+		}
+		result := FingerprintResult{SongId: song.SongId, Authors: song.Authors, Title: song.Title}
+		if err := FingerprintSong(song.SongId); err != nil {
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+type DuplicateSong struct {
+	SongId  int    `json:"song_id"`
+	Authors string `json:"authors"`
+	Title   string `json:"title"`
+	Length  int    `json:"length"`
+}
+
+type DuplicatePair struct {
+	// the older song, which a merge keeps
+	Keep      DuplicateSong `json:"keep"`
+	Duplicate DuplicateSong `json:"duplicate"`
+	// SameFile, SameRecording or SameMetadata
+	Reasons []string `json:"reasons"`
+	// of the normalised titles, from 0 to 1
+	TitleSimilarity float64 `json:"title_similarity"`
+	// share of matching fingerprint bits, 0 if either song has none
+	AudioSimilarity float64 `json:"audio_similarity"`
+}
+
+type DuplicatesReport struct {
+	Pairs []DuplicatePair `json:"duplicates"`
+	// songs which are only compared by metadata until song fingerprint is run for them
+	Unfingerprinted []DuplicateSong `json:"unfingerprinted"`
+}
+
+// what the comparison needs of a song
+type duplicateCandidate struct {
+	song    database.SongData
+	title   string
+	authors []string
+	hash    string
+	frames  []uint16
+}
+
+func (candidate *duplicateCandidate) summary() DuplicateSong {
+	song := candidate.song
+	return DuplicateSong{SongId: song.SongId, Authors: song.Authors, Title: song.Title, Length: song.Length}
+}
+
+// compares every song in the library with every other by metadata and the stored
+// file hashes and fingerprints; no audio is read, that's done when songs are added
+func FindDuplicates() (*DuplicatesReport, error) {
+	songs, err := selectSongs("")
+	if err != nil {
+		return nil, err
+	}
+	fingerprints, err := database.GetFingerprints()
+	if err != nil {
+		return nil, err
+	}
+	stored := map[int]database.Fingerprint{}
+	for _, fingerprint := range fingerprints {
+		stored[fingerprint.SongId] = fingerprint
+	}
+	sort.Slice(songs, func(i, j int) bool {
+		return songs[i].SongId < songs[j].SongId
+	})
+
+	report := &DuplicatesReport{Pairs: []DuplicatePair{}, Unfingerprinted: []DuplicateSong{}}
+	candidates := make([]duplicateCandidate, len(songs))
+	for i, song := range songs {
+		candidates[i] = duplicateCandidate{
+			song:    song,
+			title:   normalizeTitle(song.Title),
+			authors: normalizeAuthors(song.Authors),
+		}
+		if fingerprint, ok := stored[song.SongId]; ok {
+			candidates[i].hash = fingerprint.ContentHash
+			candidates[i].frames = fingerprintFrames(fingerprint.Data)
+		} else {
+			report.Unfingerprinted = append(report.Unfingerprinted, candidates[i].summary())
+		}
+	}
+
+	for i := range candidates {
+		for j := i + 1; j < len(candidates); j++ {
+			if pair, ok := compareSongs(&candidates[i], &candidates[j]); ok {
+				report.Pairs = append(report.Pairs, pair)
+			}
+		}
+	}
+	return report, nil
+}
+
+// a is the older song
+func compareSongs(a, b *duplicateCandidate) (DuplicatePair, bool) {
+	pair := DuplicatePair{Reasons: []string{}}
+	lengthsMatch := a.song.Length == 0 || b.song.Length == 0 ||
+		abs(a.song.Length-b.song.Length) <= maxLengthDifference
+
+	if a.hash != "" && a.hash == b.hash {
+		pair.Reasons = append(pair.Reasons, SameFile)
+	}
+	if lengthsMatch && a.frames != nil && b.frames != nil {
+		pair.AudioSimilarity = fingerprintSimilarity(a.frames, b.frames)
+		if pair.AudioSimilarity >= sameRecordingSimilarity {
+			pair.Reasons = append(pair.Reasons, SameRecording)
+		}
+	}
+	overlap := authorsOverlap(a.authors, b.authors)
+	if overlap || len(pair.Reasons) > 0 {
+		pair.TitleSimilarity = textSimilarity(a.title, b.title)
+	}
+	if overlap && lengthsMatch && pair.TitleSimilarity >= sameTitleSimilarity {
+		pair.Reasons = append(pair.Reasons, SameMetadata)
+	}
+	if len(pair.Reasons) == 0 {
+		return pair, false
+	}
+
+	pair.TitleSimilarity = math.Round(pair.TitleSimilarity*100) / 100
+	pair.AudioSimilarity = math.Round(pair.AudioSimilarity*100) / 100
+	pair.Keep = a.summary()
+	pair.Duplicate = b.summary()
+	return pair, true
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// the duplicates report, see FindDuplicates; /mergesongs merges a pair
+func HTTPGetDuplicates(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	report, err := FindDuplicates()
+	if err != nil {
+		utils.SendErrorJSON(w, r, "Unknown error")
+		log.Printf("DB error (duplicates): %v\n", err)
+		return
+	}
+	j, _ := utils.JSONMarshal(report)
+
+	utils.SendJSON(w, r, j)
+}
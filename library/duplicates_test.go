@@ -0,0 +1,203 @@
+package library
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"radio/database"
+)
+
+func TestNormalizeTitle(t *testing.T) {
+	tests := []struct {
+		title string
+		want  string
+	}{
+		{"Bohemian Rhapsody", "bohemian rhapsody"},
+		{"Bohemian Rhapsody (Official Video) [HD]", "bohemian rhapsody"},
+		{"Żółć – Remastered", "zolc"},
+		{"Song feat. Someone Else", "song"},
+		{"Song (unclosed", "song unclosed"},
+		{"(Official Video)", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			if got := normalizeTitle(tt.title); got != tt.want {
+				t.Errorf("normalizeTitle(%q) = %q, want %q", tt.title, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeAuthors(t *testing.T) {
+	tests := []struct {
+		authors string
+		want    []string
+	}{
+		{"Queen", []string{"queen"}},
+		{"Queen & David Bowie", []string{"queen", "david bowie"}},
+		{"A feat. B, C x D", []string{"a", "b", "c", "d"}},
+		{"Beyoncé;JAY-Z", []string{"beyonce", "jay z"}},
+		{" , & ", nil},
+		{"", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.authors, func(t *testing.T) {
+			if got := normalizeAuthors(tt.authors); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizeAuthors(%q) = %q, want %q", tt.authors, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTextSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"song", "song", 1},
+		{"song", "sung", 0.75},
+		{"song", "songs", 0.8},
+		{"", "song", 0},
+		{"", "", 1},
+		{"żółć", "zolc", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+"/"+tt.b, func(t *testing.T) {
+			if got := textSimilarity(tt.a, tt.b); got != tt.want {
+				t.Errorf("textSimilarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+			if got := textSimilarity(tt.b, tt.a); got != tt.want {
+				t.Errorf("textSimilarity(%q, %q) = %v, want %v", tt.b, tt.a, got, tt.want)
+			}
+		})
+	}
+}
+
+func randomFrames(seed int64, n int) []uint16 {
+	random := rand.New(rand.NewSource(seed))
+	frames := make([]uint16, n)
+	for i := range frames {
+		frames[i] = uint16(random.Intn(1 << 16))
+	}
+	return frames
+}
+
+func TestFingerprintSimilarity(t *testing.T) {
+	frames := randomFrames(1, 2000)
+
+	tests := []struct {
+		name    string
+		a, b    []uint16
+		atLeast float64
+		atMost  float64
+	}{
+		{"same", frames, frames, 1, 1},
+		{"shifted", frames[10:], frames, 1, 1},
+		{"shifted too far", frames[fingerprintShift+5:], frames, 0.4, 0.6},
+		{"unrelated", frames, randomFrames(2, 2000), 0.4, 0.6},
+		{"too short to tell", frames[:fingerprintOverlap-1], frames, 0, 0},
+		{"empty", nil, frames, 0, 0},
+		{"both empty", nil, nil, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, got := range []float64{fingerprintSimilarity(tt.a, tt.b), fingerprintSimilarity(tt.b, tt.a)} {
+				if got < tt.atLeast || got > tt.atMost {
+					t.Errorf("similarity = %v, want from %v to %v", got, tt.atLeast, tt.atMost)
+				}
+			}
+		})
+	}
+}
+
+func TestFingerprintFrames(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want []uint16
+	}{
+		{"frames", []byte{1, 0, 0, 1}, []uint16{1, 256}},
+		{"odd byte dropped", []byte{1, 0, 7}, []uint16{1}},
+		{"empty", nil, []uint16{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fingerprintFrames(tt.data); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fingerprintFrames = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareSongs(t *testing.T) {
+	frames := randomFrames(1, 500)
+	candidate := func(id int, authors, title string, length int, hash string, frames []uint16) *duplicateCandidate {
+		song := database.SongData{SongId: id, Authors: authors, Title: title, Length: length}
+		return &duplicateCandidate{song: song, title: normalizeTitle(title), authors: normalizeAuthors(authors), hash: hash, frames: frames}
+	}
+
+	tests := []struct {
+		name        string
+		a, b        *duplicateCandidate
+		wantReasons []string
+	}{
+		{
+			name:        "same file",
+			a:           candidate(1, "A", "Song", 200, "h", nil),
+			b:           candidate(2, "B", "Other", 200, "h", nil),
+			wantReasons: []string{SameFile},
+		},
+		{
+			name:        "same recording",
+			a:           candidate(1, "A", "Song", 200, "h1", frames),
+			b:           candidate(2, "B", "Other", 205, "h2", frames),
+			wantReasons: []string{SameRecording},
+		},
+		{
+			name:        "same metadata",
+			a:           candidate(1, "A & B", "Song", 200, "", nil),
+			b:           candidate(2, "B", "Song (Official Video)", 195, "", nil),
+			wantReasons: []string{SameMetadata},
+		},
+		{
+			name:        "unknown length",
+			a:           candidate(1, "A", "Song", 0, "", nil),
+			b:           candidate(2, "A", "Song", 200, "", nil),
+			wantReasons: []string{SameMetadata},
+		},
+		{
+			name: "lengths too far apart",
+			a:    candidate(1, "A", "Song", 200, "", frames),
+			b:    candidate(2, "A", "Song", 260, "", frames),
+		},
+		{
+			name: "other authors",
+			a:    candidate(1, "A", "Song", 200, "", nil),
+			b:    candidate(2, "B", "Song", 200, "", nil),
+		},
+		{
+			name: "no hashes",
+			a:    candidate(1, "A", "Song", 200, "", nil),
+			b:    candidate(2, "B", "Other", 200, "", nil),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pair, ok := compareSongs(tt.a, tt.b)
+			if ok != (len(tt.wantReasons) > 0) {
+				t.Fatalf("reported = %v, want reasons %v", ok, tt.wantReasons)
+			}
+			if ok && !reflect.DeepEqual(pair.Reasons, tt.wantReasons) {
+				t.Errorf("reasons = %v, want %v", pair.Reasons, tt.wantReasons)
+			}
+		})
+	}
+}
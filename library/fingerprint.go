@@ -0,0 +1,177 @@
+package library
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+
+	"github.com/faiface/beep"
+)
+
+// a lightweight acoustic fingerprint in the manner of Haitsma and Kalker: every frame
+// gets one bit per pair of neighbouring bands, set when the energy difference between
+// them grew since the previous frame. Being made of signs alone, it doesn't change with
+// the gain, the sample rate or the encoding of a recording.
+
+// frames of this many milliseconds
+const fingerprintFrame = 100
+
+// bands a quarter octave apart from lowestBand up, giving 16 bits per frame
+const (
+	fingerprintBands = 17
+	lowestBand       = 250.0
+	// for bands a quarter octave wide
+	bandQ = 5.76
+)
+
+// fingerprints are compared shifted by up to this many frames against each other,
+// over at most fingerprintCompared frames, and not at all under fingerprintOverlap
+const (
+	fingerprintShift    = 30
+	fingerprintCompared = 1200
+	fingerprintOverlap  = 100
+)
+
+// a band-pass biquad with its peak at frequency
+func bandPass(rate, frequency, q float64) biquad {
+	w := 2 * math.Pi * frequency / rate
+	alpha := math.Sin(w) / (2 * q)
+	a0 := 1 + alpha
+	return biquad{
+		b0: alpha / a0,
+		b2: -alpha / a0,
+		a1: -2 * math.Cos(w) / a0,
+		a2: (1 - alpha) / a0,
+	}
+}
+
+type fingerprinter struct {
+	channels    int
+	frameLength int
+	bands       [fingerprintBands]biquad
+	energies    [fingerprintBands]float64
+	power       float64
+	inFrame     int
+	// leading silence is left out, so songs cued differently still line up
+	started bool
+	// energy differences between neighbouring bands in the previous frame
+	previous     [fingerprintBands - 1]float64
+	havePrevious bool
+	frames       []uint16
+}
+
+func newFingerprinter(rate float64, channels int) *fingerprinter {
+	if channels > 2 {
+		channels = 2
+	}
+	f := &fingerprinter{channels: channels, frameLength: int(rate * fingerprintFrame / 1000)}
+	for i := range f.bands {
+		f.bands[i] = bandPass(rate, lowestBand*math.Pow(2, float64(i)/4), bandQ)
+	}
+	return f
+}
+
+func (f *fingerprinter) write(samples [][2]float64) {
+	silence := math.Pow(10, silenceLevel/10)
+	for _, sample := range samples {
+		x := sample[0]
+		if f.channels == 2 {
+			x = (sample[0] + sample[1]) / 2
+		}
+		f.power += x * x
+		for i := range f.bands {
+			y := f.bands[i].process(x)
+			f.energies[i] += y * y
+		}
+
+		f.inFrame++
+		if f.inFrame < f.frameLength {
+			continue
+		}
+		if f.started || f.power/float64(f.frameLength) > silence {
+			f.started = true
+			f.frame()
+		}
+		f.energies = [fingerprintBands]float64{}
+		f.power = 0
+		f.inFrame = 0
+	}
+}
+
+func (f *fingerprinter) frame() {
+	var differences [fingerprintBands - 1]float64
+	for i := range differences {
+		differences[i] = f.energies[i] - f.energies[i+1]
+	}
+	if f.havePrevious {
+		var frame uint16
+		for i, difference := range differences {
+			if difference-f.previous[i] > 0 {
+				frame |= 1 << i
+			}
+		}
+		f.frames = append(f.frames, frame)
+	}
+	f.previous = differences
+	f.havePrevious = true
+}
+
+// decodes the whole file and returns its fingerprint, stored as two bytes per frame
+func FingerprintFile(file string) ([]byte, error) {
+	var f *fingerprinter
+	err := scanAudio(file, func(format beep.Format) audioScanner {
+		f = newFingerprinter(float64(format.SampleRate), format.NumChannels)
+		return f
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(f.frames) == 0 {
+		return nil, ErrSilent
+	}
+	data := make([]byte, 2*len(f.frames))
+	for i, frame := range f.frames {
+		binary.LittleEndian.PutUint16(data[2*i:], frame)
+	}
+	return data, nil
+}
+
+func fingerprintFrames(data []byte) []uint16 {
+	frames := make([]uint16, len(data)/2)
+	for i := range frames {
+		frames[i] = binary.LittleEndian.Uint16(data[2*i:])
+	}
+	return frames
+}
+
+// returns the share of matching bits in the best alignment of two fingerprints,
+// about 0.5 for unrelated audio; 0 if they're too short to tell
+func fingerprintSimilarity(a, b []uint16) float64 {
+	best := 0.0
+	for shift := -fingerprintShift; shift <= fingerprintShift; shift++ {
+		// a[i] lines up with b[i+shift]
+		start, end := 0, len(a)
+		if shift < 0 {
+			start = -shift
+		}
+		if len(b)-shift < end {
+			end = len(b) - shift
+		}
+		if end-start > fingerprintCompared {
+			end = start + fingerprintCompared
+		}
+		if end-start < fingerprintOverlap {
+			continue
+		}
+
+		differing := 0
+		for i := start; i < end; i++ {
+			differing += bits.OnesCount16(a[i] ^ b[i+shift])
+		}
+		similarity := 1 - float64(differing)/float64((fingerprintBands-1)*(end-start))
+		if similarity > best {
+			best = similarity
+		}
+	}
+	return best
+}
@@ -0,0 +1,130 @@
+package library
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"radio/database"
+	"radio/playback"
+	"radio/utils"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// stored lengths this far off the decoded ones are fine, since both are rounded
+const lengthTolerance = 1
+
+var ErrNoAudio = errors.New("song has no audio file")
+
+// rounds to whole seconds, as length_seconds is stored
+func seconds(d time.Duration) int {
+	return int(d.Round(time.Second) / time.Second)
+}
+
+// returns the length of the song's audio in seconds
+func DecodedLength(songid int) (int, error) {
+	file := AudioFile(songid)
+	if file == "" {
+		return 0, ErrNoAudio
+	}
+	length, err := playback.AudioLength(file)
+	if err != nil {
+		return 0, err
+	}
+	return seconds(length), nil
+}
+
+type LengthCheck struct {
+	SongId  int    `json:"song_id"`
+	Authors string `json:"authors"`
+	Title   string `json:"title"`
+	Stored  int    `json:"stored"`
+	// 0 when the audio couldn't be decoded
+	Actual int    `json:"actual"`
+	Error  string `json:"error,omitempty"`
+	Fixed  bool   `json:"fixed"`
+}
+
+// returns the song with songid, or every song if it's empty
+func selectSongs(songid string) ([]database.SongData, error) {
+	if songid == "" {
+		return database.GetSongArray(), nil
+	}
+	song := database.GetSongData(songid)
+	if song == nil {
+		return nil, database.ErrNotFound
+	}
+	return []database.SongData{*song}, nil
+}
+
+func (c LengthCheck) Mismatch() bool {
+	if c.Error != "" {
+		return false
+	}
+	diff := c.Stored - c.Actual
+	return diff > lengthTolerance || diff < -lengthTolerance
+}
+
+// decodes the audio of the song with songid, or of every song if it's empty,
+// and compares the lengths with the stored ones; fix writes the decoded lengths.
+// Only songs which are off or couldn't be checked are returned.
+func VerifyLengths(songid string, fix bool) ([]LengthCheck, error) {
+	songs, err := selectSongs(songid)
+	if err != nil {
+		return nil, err
+	}
+
+	var checks []LengthCheck
+	for _, song := range songs {
+		check := LengthCheck{SongId: song.SongId, Authors: song.Authors, Title: song.Title, Stored: song.Length}
+		actual, err := DecodedLength(song.SongId)
+		if err != nil {
+			check.Error = err.Error()
+			checks = append(checks, check)
+			continue
+		}
+		check.Actual = actual
+		if !check.Mismatch() {
+			continue
+		}
+
+		if fix {
+			song.Length = actual
+			if err := database.UpdateSong(song); err != nil {
+				log.Printf("DB error (song length): %v\n", err)
+				check.Error = "couldn't store the length: " + err.Error()
+			} else {
+				check.Fixed = true
+			}
+		}
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+// ?id=<song id, every song if empty>&fix=true
+func HTTPVerifySongs(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	fix, _ := strconv.ParseBool(r.URL.Query().Get("fix"))
+
+	checks, err := VerifyLengths(r.URL.Query().Get("id"), fix)
+	if err == database.ErrNotFound {
+		utils.SendErrorJSON(w, r, "No song with id "+r.URL.Query().Get("id")+" found")
+		return
+	}
+	if err != nil {
+		utils.SendErrorJSON(w, r, "Unknown error")
+		log.Printf("DB error (verify): %v\n", err)
+		return
+	}
+	if len(checks) == 0 {
+		utils.SendResponseJSON(w, r, "All lengths match")
+		return
+	}
+
+	j, _ := utils.JSONMarshal(checks)
+
+	utils.SendJSON(w, r, j)
+}
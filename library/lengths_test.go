@@ -0,0 +1,159 @@
+package library
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"radio/database"
+)
+
+// seconds of silence as 8 kHz mono 16 bit PCM
+func wavFile(seconds int) []byte {
+	data := 8000 * 2 * seconds
+	b := make([]byte, 44+data)
+	copy(b, "RIFF")
+	binary.LittleEndian.PutUint32(b[4:], uint32(36+data))
+	copy(b[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(b[16:], 16)
+	binary.LittleEndian.PutUint16(b[20:], 1)
+	binary.LittleEndian.PutUint16(b[22:], 1)
+	binary.LittleEndian.PutUint32(b[24:], 8000)
+	binary.LittleEndian.PutUint32(b[28:], 8000*2)
+	binary.LittleEndian.PutUint16(b[32:], 2)
+	binary.LittleEndian.PutUint16(b[34:], 16)
+	copy(b[36:], "data")
+	binary.LittleEndian.PutUint32(b[40:], uint32(data))
+	return b
+}
+
+// runs the test in an empty directory, where the music directory goes
+func inTempDir(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(dir) })
+}
+
+func TestVerifyLengths(t *testing.T) {
+	tests := []struct {
+		name   string
+		stored int
+		// written as the song's audio unless empty
+		file       string
+		audio      []byte
+		fix        bool
+		wantChecks int
+		wantActual int
+		wantFixed  bool
+		wantError  bool
+	}{
+		{
+			name:   "length right",
+			stored: 3,
+			file:   "audio.wav",
+			audio:  wavFile(3),
+		},
+		{
+			name:   "within the tolerance",
+			stored: 4,
+			file:   "audio.wav",
+			audio:  wavFile(3),
+		},
+		{
+			name:       "length off",
+			stored:     10,
+			file:       "audio.wav",
+			audio:      wavFile(3),
+			wantChecks: 1,
+			wantActual: 3,
+		},
+		{
+			name:       "length fixed",
+			stored:     10,
+			file:       "audio.wav",
+			audio:      wavFile(3),
+			fix:        true,
+			wantChecks: 1,
+			wantActual: 3,
+			wantFixed:  true,
+		},
+		{
+			name:       "no audio",
+			stored:     3,
+			wantChecks: 1,
+			wantError:  true,
+		},
+		{
+			name:       "truncated header",
+			stored:     3,
+			file:       "audio.wav",
+			audio:      wavFile(3)[:20],
+			wantChecks: 1,
+			wantError:  true,
+		},
+		{
+			name:       "empty file",
+			stored:     3,
+			file:       "audio.mp3",
+			wantChecks: 1,
+			wantError:  true,
+		},
+		{
+			name:       "not audio at all",
+			stored:     3,
+			file:       "audio.flac",
+			audio:      []byte("<html>not found</html>"),
+			wantChecks: 1,
+			wantError:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inTempDir(t)
+			database.SetStore(database.NewMemoryStore())
+			songid, err := database.AddSong(database.SongData{Authors: "A", Title: "Song", Length: tt.stored})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.file != "" {
+				dir := filepath.Join(database.MusicDir, strconv.Itoa(songid))
+				if err := os.MkdirAll(dir, 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(dir, tt.file), tt.audio, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			checks, err := VerifyLengths("", tt.fix)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(checks) != tt.wantChecks {
+				t.Fatalf("checks = %+v, want %d", checks, tt.wantChecks)
+			}
+			if len(checks) == 0 {
+				return
+			}
+			check := checks[0]
+			if (check.Error != "") != tt.wantError || check.Actual != tt.wantActual || check.Fixed != tt.wantFixed {
+				t.Errorf("check = %+v, want actual %d, fixed %v, an error %v", check, tt.wantActual, tt.wantFixed, tt.wantError)
+			}
+			want := tt.stored
+			if tt.wantFixed {
+				want = tt.wantActual
+			}
+			if song := database.GetSongData(strconv.Itoa(songid)); song == nil || song.Length != want {
+				t.Errorf("stored song = %+v, want a length of %d", song, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package library
+
+import (
+	"errors"
+	"log"
+	"math"
+
+	"radio/database"
+	"radio/playback"
+
+	"github.com/faiface/beep"
+)
+
+var ErrSilent = errors.New("audio is too quiet to measure")
+
+// something measured from the decoded samples of a file
+type audioScanner interface {
+	write(samples [][2]float64)
+}
+
+// decodes the file once, handing the samples to a scanner made by each function
+func scanAudio(file string, scanners ...func(format beep.Format) audioScanner) error {
+	streamer, format, err := playback.DecodeFile(file)
+	if err != nil {
+		return err
+	}
+	defer streamer.Close()
+
+	var made []audioScanner
+	for _, scanner := range scanners {
+		made = append(made, scanner(format))
+	}
+	samples := make([][2]float64, 4096)
+	for {
+		n, ok := streamer.Stream(samples)
+		for _, scanner := range made {
+			scanner.write(samples[:n])
+		}
+		if !ok {
+			break
+		}
+	}
+	return streamer.Err()
+}
+
+func (m *loudnessMeter) loudness() (*database.Loudness, error) {
+	integrated, truePeak, ok := m.result()
+	if !ok {
+		return nil, ErrSilent
+	}
+	round := func(x float64) float64 {
+		return math.Round(x*100) / 100
+	}
+	return &database.Loudness{Integrated: round(integrated), TruePeak: round(truePeak)}, nil
+}
+
+// decodes the whole file and measures its loudness
+func MeasureFile(file string) (*database.Loudness, error) {
+	var meter *loudnessMeter
+	err := scanAudio(file, func(format beep.Format) audioScanner {
+		meter = newLoudnessMeter(float64(format.SampleRate), format.NumChannels)
+		return meter
+	})
+	if err != nil {
+		return nil, err
+	}
+	return meter.loudness()
+}
+
+// measures the loudness and detects the cue points in one pass;
+// either is nil if the audio is too quiet for it
+func AnalyseFile(file string) (*database.Loudness, *database.Cues, error) {
+	var meter *loudnessMeter
+	var cues *cueScanner
+	err := scanAudio(file, func(format beep.Format) audioScanner {
+		meter = newLoudnessMeter(float64(format.SampleRate), format.NumChannels)
+		return meter
+	}, func(format beep.Format) audioScanner {
+		cues = newCueScanner(float64(format.SampleRate), format.NumChannels)
+		return cues
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	loudness, _ := meter.loudness()
+	detected, _ := cues.result()
+	return loudness, detected, nil
+}
+
+func MeasureSong(songid int) (*database.Loudness, error) {
+	file := AudioFile(songid)
+	if file == "" {
+		return nil, ErrNoAudio
+	}
+	return MeasureFile(file)
+}
+
+type LoudnessResult struct {
+	SongId   int                `json:"song_id"`
+	Authors  string             `json:"authors"`
+	Title    string             `json:"title"`
+	Loudness *database.Loudness `json:"loudness,omitempty"`
+	Error    string             `json:"error,omitempty"`
+}
+
+// measures and stores the loudness of the song with songid, or of every song
+// if it's empty; without all, songs which have been measured before are skipped
+func AnalyseLoudness(songid string, all bool) ([]LoudnessResult, error) {
+	songs, err := selectSongs(songid)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []LoudnessResult
+	for _, song := range songs {
+		if song.Loudness != nil && !all && songid == "" {
+			continue
+		}
+		result := LoudnessResult{SongId: song.SongId, Authors: song.Authors, Title: song.Title}
+		loudness, err := MeasureSong(song.SongId)
+		if err == nil {
+			err = database.SetSongLoudness(song.SongId, *loudness)
+			if err != nil {
+				log.Printf("DB error (loudness): %v\n", err)
+			}
+		}
+		if err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Loudness = loudness
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
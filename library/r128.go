@@ -0,0 +1,176 @@
+package library
+
+import (
+	"math"
+)
+
+// integrated loudness and true peak as in ITU-R BS.1770-4, which EBU R128 builds on
+
+// a biquad filter in direct form I
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+	return y
+}
+
+// the two stages of the K-weighting, a high shelf and a high pass, worked out
+// for any sample rate from the analog prototypes the 48 kHz coefficients come from
+func kWeighting(rate float64) (biquad, biquad) {
+	f0, gain, q := 1681.974450955533, 3.999843853973347, 0.7071752369554196
+	k := math.Tan(math.Pi * f0 / rate)
+	vh := math.Pow(10, gain/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf := biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	f0, q = 38.13547087602444, 0.5003270373238773
+	k = math.Tan(math.Pi * f0 / rate)
+	a0 = 1 + k/q + k*k
+	highPass := biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+	return shelf, highPass
+}
+
+// gating blocks are 400 ms long and start every 100 ms
+const gatingSteps = 4
+
+// blocks quieter than this, in LUFS, are left out altogether
+const absoluteGate = -70.0
+
+// and blocks this many LU under the loudness of the rest as well
+const relativeGate = -10.0
+
+// the true peak is found by upsampling four times with a windowed sinc
+const (
+	peakPhases = 4
+	peakTaps   = 12
+)
+
+var peakFilter [peakPhases][peakTaps]float64
+
+func init() {
+	n := peakPhases * peakTaps
+	for i := 0; i < n; i++ {
+		// in input samples from the middle of the filter
+		t := (float64(i) - float64(n-1)/2) / peakPhases
+		sinc := 1.0
+		if t != 0 {
+			sinc = math.Sin(math.Pi*t) / (math.Pi * t)
+		}
+		window := 0.5 - 0.5*math.Cos(2*math.Pi*float64(i+1)/float64(n+1))
+		peakFilter[i%peakPhases][i/peakPhases] = sinc * window
+	}
+}
+
+type loudnessMeter struct {
+	channels int
+	filters  [2][2]biquad
+	// samples in 100 ms
+	stepLength int
+	// sums of the squared K-weighted samples of every channel, one per 100 ms
+	steps   []float64
+	sum     float64
+	inStep  int
+	history [2][peakTaps]float64
+	peak    float64
+}
+
+func newLoudnessMeter(rate float64, channels int) *loudnessMeter {
+	if channels > 2 {
+		channels = 2
+	}
+	m := &loudnessMeter{channels: channels, stepLength: int(rate / 10)}
+	for c := range m.filters {
+		m.filters[c][0], m.filters[c][1] = kWeighting(rate)
+	}
+	return m
+}
+
+func (m *loudnessMeter) write(samples [][2]float64) {
+	for _, sample := range samples {
+		for c := 0; c < m.channels; c++ {
+			x := sample[c]
+			// one broken sample would otherwise stay in the filters for the rest of the song
+			if math.IsNaN(x) || math.IsInf(x, 0) {
+				x = 0
+			}
+			y := m.filters[c][1].process(m.filters[c][0].process(x))
+			m.sum += y * y
+
+			history := &m.history[c]
+			copy(history[1:], history[:peakTaps-1])
+			history[0] = x
+			for phase := range peakFilter {
+				var interpolated float64
+				for tap, coefficient := range peakFilter[phase] {
+					interpolated += history[tap] * coefficient
+				}
+				m.peak = math.Max(m.peak, math.Abs(interpolated))
+			}
+			m.peak = math.Max(m.peak, math.Abs(x))
+		}
+
+		m.inStep++
+		if m.inStep == m.stepLength {
+			m.steps = append(m.steps, m.sum)
+			m.sum = 0
+			m.inStep = 0
+		}
+	}
+}
+
+func blockLoudness(power float64) float64 {
+	return -0.691 + 10*math.Log10(power)
+}
+
+// returns the integrated loudness in LUFS and the true peak in dBTP;
+// ok is false if there's no block above the absolute gate
+func (m *loudnessMeter) result() (integrated, truePeak float64, ok bool) {
+	var blocks []float64
+	for i := 0; i+gatingSteps <= len(m.steps); i++ {
+		var sum float64
+		for _, step := range m.steps[i : i+gatingSteps] {
+			sum += step
+		}
+		power := sum / float64(gatingSteps*m.stepLength)
+		if power > 0 && blockLoudness(power) > absoluteGate {
+			blocks = append(blocks, power)
+		}
+	}
+	if len(blocks) == 0 {
+		return 0, 0, false
+	}
+
+	var sum float64
+	for _, power := range blocks {
+		sum += power
+	}
+	threshold := sum / float64(len(blocks)) * math.Pow(10, relativeGate/10)
+
+	sum = 0
+	count := 0
+	for _, power := range blocks {
+		if power > threshold {
+			sum += power
+			count++
+		}
+	}
+	return blockLoudness(sum / float64(count)), 20 * math.Log10(m.peak), true
+}
@@ -0,0 +1,149 @@
+package library
+
+import (
+	"math"
+	"testing"
+)
+
+// seconds of a sine at the given frequency, amplitude and phase in both channels
+func sine(rate, seconds, freq, amplitude, phase float64) [][2]float64 {
+	samples := make([][2]float64, int(rate*seconds))
+	for i := range samples {
+		x := amplitude * math.Sin(2*math.Pi*freq*float64(i)/rate+phase)
+		samples[i] = [2]float64{x, x}
+	}
+	return samples
+}
+
+func TestLoudnessMeter(t *testing.T) {
+	minus23 := math.Pow(10, -23.0/20)
+	withNaN := sine(48000, 5, 1000, minus23, 0)
+	withNaN[48000*2][0] = math.NaN()
+	withInf := sine(48000, 5, 1000, minus23, 0)
+	withInf[48000*2][1] = math.Inf(1)
+
+	tests := []struct {
+		name           string
+		rate           float64
+		channels       int
+		samples        [][2]float64
+		wantIntegrated float64
+		wantPeak       float64
+		wantOk         bool
+	}{
+		{
+			name:           "stereo sine at -23 dBFS",
+			rate:           48000,
+			channels:       2,
+			samples:        sine(48000, 5, 1000, minus23, 0),
+			wantIntegrated: -23,
+			wantPeak:       -23,
+			wantOk:         true,
+		},
+		{
+			name:           "at 44.1 kHz",
+			rate:           44100,
+			channels:       2,
+			samples:        sine(44100, 5, 1000, minus23, 0),
+			wantIntegrated: -23,
+			wantPeak:       -23,
+			wantOk:         true,
+		},
+		{
+			name:           "mono",
+			rate:           48000,
+			channels:       1,
+			samples:        sine(48000, 5, 1000, minus23, 0),
+			wantIntegrated: -26,
+			wantPeak:       -23,
+			wantOk:         true,
+		},
+		{
+			name:     "more channels than two",
+			rate:     48000,
+			channels: 6,
+			samples:  sine(48000, 5, 1000, minus23, 0),
+			// only the front pair is measured
+			wantIntegrated: -23,
+			wantPeak:       -23,
+			wantOk:         true,
+		},
+		{
+			// samples fall at ±0.71 while the wave between them reaches 1
+			name:           "peak between samples",
+			rate:           48000,
+			channels:       2,
+			samples:        sine(48000, 5, 12000, 1, math.Pi/4),
+			wantIntegrated: math.NaN(),
+			wantPeak:       0,
+			wantOk:         true,
+		},
+		{
+			name:           "NaN sample",
+			rate:           48000,
+			channels:       2,
+			samples:        withNaN,
+			wantIntegrated: -23,
+			wantPeak:       -23,
+			wantOk:         true,
+		},
+		{
+			name:           "infinite sample",
+			rate:           48000,
+			channels:       2,
+			samples:        withInf,
+			wantIntegrated: -23,
+			wantPeak:       -23,
+			wantOk:         true,
+		},
+		{
+			name:     "silence",
+			rate:     48000,
+			channels: 2,
+			samples:  make([][2]float64, 48000*5),
+		},
+		{
+			name:     "under the absolute gate",
+			rate:     48000,
+			channels: 2,
+			samples:  sine(48000, 5, 1000, math.Pow(10, -80.0/20), 0),
+		},
+		{
+			name:     "shorter than a gating block",
+			rate:     48000,
+			channels: 2,
+			samples:  sine(48000, 0.3, 1000, minus23, 0),
+		},
+		{
+			name:     "no samples",
+			rate:     48000,
+			channels: 2,
+		},
+		{
+			name:     "sample rate under 10 Hz",
+			rate:     5,
+			channels: 2,
+			samples:  sine(5, 60, 1, minus23, 0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meter := newLoudnessMeter(tt.rate, tt.channels)
+			meter.write(tt.samples)
+			integrated, peak, ok := meter.result()
+			if ok != tt.wantOk {
+				t.Fatalf("ok = %v, want %v (%.2f LUFS, %.2f dBTP)", ok, tt.wantOk, integrated, peak)
+			}
+			if !ok {
+				return
+			}
+			if !math.IsNaN(tt.wantIntegrated) && !(math.Abs(integrated-tt.wantIntegrated) <= 0.2) {
+				t.Errorf("integrated = %.2f LUFS, want %.2f", integrated, tt.wantIntegrated)
+			}
+			if !(math.Abs(peak-tt.wantPeak) <= 0.5) {
+				t.Errorf("true peak = %.2f dBTP, want %.2f", peak, tt.wantPeak)
+			}
+		})
+	}
+}
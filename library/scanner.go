@@ -0,0 +1,319 @@
+package library
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"radio/database"
+	"radio/playback"
+)
+
+// extensions the player can decode, in the order GetSongFormat looks for them
+var AudioExtensions = playback.Extensions()
+
+// files changed more recently than this may still be copied in and are left for the next scan
+const settleTime = 5 * time.Second
+
+func isAudio(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, audioExt := range AudioExtensions {
+		if ext == audioExt {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the audio file of a song, or "" if its folder has none
+func AudioFile(songid int) string {
+	return playback.SongFile(strconv.Itoa(songid))
+}
+
+type ScannedFile struct {
+	Path   string
+	SongId int
+	Title  string
+}
+
+type ScanFailure struct {
+	Path string
+	Err  error
+}
+
+type ScanReport struct {
+	// new files registered as songs and moved to music/<id>/audio.<ext>
+	Added  []ScannedFile
+	Failed []ScanFailure
+	// audio in music/<id>/ folders no song row has, trashed ones included
+	UnknownFiles []string
+	// songs whose folder has no audio
+	MissingAudio []database.SongData
+}
+
+// builds a song from the tags, falling back on "Artist - Title" file names
+func songFromFile(file string, tags Tags) database.SongData {
+	name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	song := database.SongData{
+		Authors:     tags.Artist,
+		Title:       tags.Title,
+		Length:      int(tags.Length / time.Second),
+		ReleaseDate: tags.ReleaseDate,
+		BPM:         tags.BPM,
+		Language:    tags.Language,
+		ISRC:        tags.ISRC,
+		Genres:      tags.Genres,
+	}
+
+	if song.Title == "" || song.Authors == "" {
+		if dash := strings.Index(name, " - "); dash > 0 {
+			if song.Authors == "" {
+				song.Authors = strings.TrimSpace(name[:dash])
+			}
+			if song.Title == "" {
+				song.Title = strings.TrimSpace(name[dash+3:])
+			}
+		}
+	}
+	if song.Title == "" {
+		song.Title = name
+	}
+	if song.Authors == "" {
+		song.Authors = "Unknown"
+	}
+
+	// tags are free text; drop what wouldn't pass validation instead of skipping the song
+	if checked := song; checked.Validate() != nil {
+		song.BPM = 0
+		song.Language = ""
+		song.ISRC = ""
+		if checked = song; checked.Validate() != nil {
+			song.Genres = nil
+		}
+	}
+	return song
+}
+
+// registers one new file and moves it into its song's folder
+func addFile(file string) (*ScannedFile, error) {
+	tags, err := ReadTags(file)
+	if err != nil && err != ErrNoTags {
+		log.Printf("Couldn't read the tags of %s: %v\n", file, err)
+	}
+	song := songFromFile(file, tags)
+	songid, err := importFile(file, song, false)
+	if err != nil {
+		return nil, err
+	}
+	return &ScannedFile{Path: file, SongId: songid, Title: song.Authors + " - " + song.Title}, nil
+}
+
+// adds song with the audio in file, which is copied into the song's folder and left where it is
+func AddSongFile(song database.SongData, file string) (int, error) {
+	if !isAudio(file) {
+		return 0, fmt.Errorf("%s isn't supported, use one of %s", filepath.Base(file), strings.Join(AudioExtensions, ", "))
+	}
+	return importFile(file, song, true)
+}
+
+// moves the file into music/<id>/, or copies it there if keep is set
+func importFile(file string, song database.SongData, keep bool) (int, error) {
+	ext := strings.ToLower(filepath.Ext(file))
+	return importAudio(file, song, func(dir string) error {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		target := filepath.Join(dir, "audio"+ext)
+		if keep {
+			return copyFile(file, target)
+		}
+		return os.Rename(file, target)
+	})
+}
+
+// decodes and analyses file, registers song with what was measured and has store put
+// the audio into the song's folder; what can't be decoded isn't added. The errors
+// are worded to follow the name of the file.
+func importAudio(file string, song database.SongData, store func(dir string) error) (int, error) {
+	// the decoder knows better than a TLEN frame
+	length, err := playback.AudioLength(file)
+	if err != nil {
+		return 0, fmt.Errorf("couldn't be decoded: %v", err)
+	}
+	if length <= 0 {
+		return 0, errors.New("has no audio in it")
+	}
+	song.Length = seconds(length)
+	// played as it is if it can't be analysed, e.g. when it's silent
+	if loudness, cues, err := AnalyseFile(file); err == nil {
+		song.Loudness = loudness
+		song.Cues = cues
+	} else {
+		log.Printf("Couldn't analyse %s: %v\n", file, err)
+	}
+
+	songid, err := database.AddSong(song)
+	if err != nil {
+		log.Printf("DB error (import): %v\n", err)
+		return 0, errors.New("couldn't be added to the database")
+	}
+
+	dir := filepath.Join(database.MusicDir, strconv.Itoa(songid))
+	if err := store(dir); err != nil {
+		// don't leave a song without audio behind
+		if delErr := database.DelSong(strconv.Itoa(songid)); delErr != nil {
+			log.Printf("Couldn't trash song %d: %v\n", songid, delErr)
+		}
+		return 0, fmt.Errorf("couldn't be stored in %s: %v", dir, err)
+	}
+	// for duplicate detection, which compares what's stored
+	if err := FingerprintSong(songid); err != nil {
+		log.Printf("Couldn't fingerprint song %d: %v\n", songid, err)
+	}
+	return songid, nil
+}
+
+func copyFile(from, to string) error {
+	source, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	target, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(target, source); err != nil {
+		target.Close()
+		return err
+	}
+	return target.Close()
+}
+
+var scanMutex sync.Mutex
+
+type failedFile struct {
+	modTime time.Time
+	err     error
+}
+
+// files which couldn't be added are retried only once they change
+var failedFiles = map[string]failedFile{}
+
+// registers audio files found outside the music/<id>/ folders, e.g. music/new/Artist - Title.mp3,
+// and reports where the folders and the songs table disagree
+func Scan() (*ScanReport, error) {
+	scanMutex.Lock()
+	defer scanMutex.Unlock()
+
+	report := &ScanReport{}
+
+	songs := database.GetSongArray()
+	trash, err := database.GetTrash()
+	if err != nil {
+		return nil, err
+	}
+	known := map[int]bool{}
+	for _, song := range append(songs, trash.Songs...) {
+		known[song.SongId] = true
+	}
+
+	infos, err := ioutil.ReadDir(database.MusicDir)
+	if os.IsNotExist(err) {
+		infos = nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var newFiles []string
+	modTimes := map[string]time.Time{}
+	for _, info := range infos {
+		path := filepath.Join(database.MusicDir, info.Name())
+		if songid, err := strconv.Atoi(info.Name()); err == nil && info.IsDir() {
+			if !known[songid] {
+				if file := AudioFile(songid); file != "" {
+					report.UnknownFiles = append(report.UnknownFiles, file)
+				}
+			}
+			continue
+		}
+
+		err := filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if strings.HasPrefix(info.Name(), ".") {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info.Mode().IsRegular() && isAudio(file) && time.Since(info.ModTime()) > settleTime {
+				newFiles = append(newFiles, file)
+				modTimes[file] = info.ModTime()
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(newFiles)
+	for _, file := range newFiles {
+		if failed, ok := failedFiles[file]; ok && failed.modTime.Equal(modTimes[file]) {
+			report.Failed = append(report.Failed, ScanFailure{Path: file, Err: failed.err})
+			continue
+		}
+		added, err := addFile(file)
+		if err != nil {
+			failedFiles[file] = failedFile{modTime: modTimes[file], err: err}
+			report.Failed = append(report.Failed, ScanFailure{Path: file, Err: err})
+			continue
+		}
+		delete(failedFiles, file)
+		report.Added = append(report.Added, *added)
+	}
+
+	for _, song := range songs {
+		if AudioFile(song.SongId) == "" {
+			report.MissingAudio = append(report.MissingAudio, song)
+		}
+	}
+	return report, nil
+}
+
+// scans the music directory every interval, logging what was added
+func StartWatcher(interval time.Duration) {
+	go func() {
+		// files which can't be added stay where they are; complain about each once
+		reported := map[string]bool{}
+		ticker := time.NewTicker(interval)
+		for {
+			<-ticker.C
+			report, err := Scan()
+			if err != nil {
+				log.Printf("Library scan failed: %v\n", err)
+				continue
+			}
+			for _, added := range report.Added {
+				log.Printf("Added song %d (%s) from %s\n", added.SongId, added.Title, added.Path)
+			}
+			for _, failure := range report.Failed {
+				if !reported[failure.Path] {
+					log.Printf("Couldn't add %s: %v\n", failure.Path, failure.Err)
+					reported[failure.Path] = true
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,73 @@
+package library
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"radio/database"
+)
+
+func TestSongFromFile(t *testing.T) {
+	released := time.Date(2001, 2, 3, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		file string
+		tags Tags
+		want database.SongData
+	}{
+		{
+			name: "tags",
+			file: "music/new/whatever.mp3",
+			tags: Tags{Title: "Song", Artist: "Band", ReleaseDate: released, BPM: 120, Language: "en", ISRC: "PLA012345678", Length: 90500 * time.Millisecond},
+			want: database.SongData{Title: "Song", Authors: "Band", ReleaseDate: released, BPM: 120, Language: "en", ISRC: "PLA012345678", Length: 90},
+		},
+		{
+			name: "artist and title from the name",
+			file: "music/new/Band - Song.flac",
+			want: database.SongData{Title: "Song", Authors: "Band"},
+		},
+		{
+			name: "only the missing half from the name",
+			file: "music/new/Other - Name.mp3",
+			tags: Tags{Title: "Song"},
+			want: database.SongData{Title: "Song", Authors: "Other"},
+		},
+		{
+			name: "name without a dash",
+			file: "music/new/track01.ogg",
+			want: database.SongData{Title: "track01", Authors: "Unknown"},
+		},
+		{
+			name: "name starting with a dash",
+			file: "music/new/ - Song.mp3",
+			want: database.SongData{Title: " - Song", Authors: "Unknown"},
+		},
+		{
+			name: "empty name",
+			file: "music/new/.mp3",
+			want: database.SongData{Title: "", Authors: "Unknown"},
+		},
+		{
+			name: "invalid fields dropped",
+			file: "music/new/Band - Song.mp3",
+			tags: Tags{BPM: 9000, Language: "english!", ISRC: "nope", Genres: []string{"Jazz"}},
+			want: database.SongData{Title: "Song", Authors: "Band", Genres: []string{"Jazz"}},
+		},
+		{
+			name: "overlong genres dropped too",
+			file: "music/new/Band - Song.mp3",
+			tags: Tags{BPM: -1, Genres: []string{strings.Repeat("x", 65)}},
+			want: database.SongData{Title: "Song", Authors: "Band"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := songFromFile(tt.file, tt.tags); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("songFromFile = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
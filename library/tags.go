@@ -0,0 +1,486 @@
+// Package library keeps the songs table and the music directory in step
+package library
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// metadata read from an audio file; zero values mean the file doesn't say
+type Tags struct {
+	Title       string
+	Artist      string
+	ReleaseDate time.Time
+	Genres      []string
+	BPM         int
+	ISRC        string
+	Language    string
+	Length      time.Duration
+}
+
+var ErrNoTags = errors.New("file has no tags")
+
+// reads the ID3v2 tag of an mp3 or the Vorbis comments of a flac or ogg
+func ReadTags(file string) (Tags, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return Tags{}, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".mp3":
+		return readID3v2(f)
+	case ".flac":
+		return readFLACTags(f)
+	case ".ogg", ".oga":
+		return readOggTags(f)
+	}
+	return Tags{}, ErrNoTags
+}
+
+// accepts YYYY, YYYY-MM, YYYY-MM-dd and longer timestamps
+func parseTagDate(value string) time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{"2006-01-02", "2006-01", "2006"} {
+		if len(value) >= len(layout) {
+			if t, err := time.Parse(layout, value[:len(layout)]); err == nil {
+				return t
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// fills in a field the way both tag formats name it
+func (t *Tags) set(field, value string) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return
+	}
+	switch field {
+	case "title":
+		t.Title = value
+	case "artist":
+		if t.Artist == "" {
+			t.Artist = value
+		} else {
+			t.Artist += ", " + value
+		}
+	case "date":
+		// a full release date wins over a bare year
+		if date := parseTagDate(value); !date.IsZero() && (t.ReleaseDate.IsZero() || len(value) > 4) {
+			t.ReleaseDate = date
+		}
+	case "genre":
+		t.Genres = append(t.Genres, value)
+	case "bpm":
+		if bpm, err := strconv.ParseFloat(value, 64); err == nil {
+			t.BPM = int(bpm + 0.5)
+		}
+	case "isrc":
+		t.ISRC = value
+	case "language":
+		t.Language = value
+	case "length":
+		if ms, err := strconv.Atoi(value); err == nil {
+			t.Length = time.Duration(ms) * time.Millisecond
+		}
+	}
+}
+
+// ID3v2 frame ids, v2.2 three letter ones included
+var id3Fields = map[string]string{
+	"TIT2": "title", "TT2": "title",
+	"TPE1": "artist", "TP1": "artist",
+	"TDRC": "date", "TDRL": "date", "TYER": "date", "TYE": "date", "TORY": "date",
+	"TCON": "genre", "TCO": "genre",
+	"TBPM": "bpm", "TBP": "bpm",
+	"TSRC": "isrc", "TRC": "isrc",
+	"TLAN": "language", "TLA": "language",
+	"TLEN": "length", "TLE": "length",
+}
+
+func syncsafe(b []byte) int {
+	size := 0
+	for _, c := range b {
+		size = size<<7 | int(c&0x7f)
+	}
+	return size
+}
+
+// reverses unsynchronisation, which inserts a zero after every 0xff
+func unsynchronise(b []byte) []byte {
+	return bytes.Replace(b, []byte{0xff, 0x00}, []byte{0xff}, -1)
+}
+
+// decodes the text of a T*** frame; several values are separated by zeroes
+func id3Text(b []byte) []string {
+	if len(b) == 0 {
+		return nil
+	}
+	encoding, b := b[0], b[1:]
+
+	var text string
+	switch encoding {
+	case 1, 2:
+		order := binary.ByteOrder(binary.BigEndian)
+		if encoding == 1 && len(b) >= 2 {
+			if b[0] == 0xff && b[1] == 0xfe {
+				order = binary.LittleEndian
+			}
+			if (b[0] == 0xff && b[1] == 0xfe) || (b[0] == 0xfe && b[1] == 0xff) {
+				b = b[2:]
+			}
+		}
+		units := make([]uint16, len(b)/2)
+		for i := range units {
+			units[i] = order.Uint16(b[i*2:])
+		}
+		text = string(utf16.Decode(units))
+	case 3:
+		text = string(b)
+	default:
+		// ISO-8859-1 maps onto the first 256 code points
+		runes := make([]rune, len(b))
+		for i, c := range b {
+			runes[i] = rune(c)
+		}
+		text = string(runes)
+	}
+
+	var values []string
+	for _, value := range strings.Split(text, "\x00") {
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// TCON may hold v2.3 style "(17)" references to the ID3v1 genre list
+func id3Genre(value string) string {
+	if strings.HasPrefix(value, "(") {
+		if end := strings.Index(value, ")"); end > 0 {
+			if rest := strings.TrimSpace(value[end+1:]); rest != "" {
+				return rest
+			}
+			value = value[1:end]
+		}
+	}
+	if n, err := strconv.Atoi(value); err == nil && n >= 0 && n < len(id3v1Genres) {
+		return id3v1Genres[n]
+	}
+	return value
+}
+
+// the first 80 ID3v1 genres, which are the ones in common use
+var id3v1Genres = []string{
+	"Blues", "Classic Rock", "Country", "Dance", "Disco", "Funk", "Grunge", "Hip-Hop", "Jazz", "Metal",
+	"New Age", "Oldies", "Other", "Pop", "R&B", "Rap", "Reggae", "Rock", "Techno", "Industrial",
+	"Alternative", "Ska", "Death Metal", "Pranks", "Soundtrack", "Euro-Techno", "Ambient", "Trip-Hop", "Vocal", "Jazz+Funk",
+	"Fusion", "Trance", "Classical", "Instrumental", "Acid", "House", "Game", "Sound Clip", "Gospel", "Noise",
+	"Alternative Rock", "Bass", "Soul", "Punk", "Space", "Meditative", "Instrumental Pop", "Instrumental Rock", "Ethnic", "Gothic",
+	"Darkwave", "Techno-Industrial", "Electronic", "Pop-Folk", "Eurodance", "Dream", "Southern Rock", "Comedy", "Cult", "Gangsta",
+	"Top 40", "Christian Rap", "Pop/Funk", "Jungle", "Native American", "Cabaret", "New Wave", "Psychedelic", "Rave", "Showtunes",
+	"Trailer", "Lo-Fi", "Tribal", "Acid Punk", "Acid Jazz", "Polka", "Retro", "Musical", "Rock & Roll", "Hard Rock",
+}
+
+// tags bigger than this are taken for a broken file; they may carry a cover
+const maxID3Tag = 16 << 20
+
+// calls fn with the id and data of every frame of an ID3v2 tag,
+// undoing unsynchronisation and skipping compressed and encrypted frames
+func id3Frames(r io.Reader, fn func(id string, data []byte)) error {
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[:3]) != "ID3" {
+		return ErrNoTags
+	}
+	version := header[3]
+	flags := header[5]
+	if version < 2 || version > 4 {
+		return errors.New("unsupported ID3v2." + strconv.Itoa(int(version)) + " tag")
+	}
+
+	size := syncsafe(header[6:10])
+	if size > maxID3Tag {
+		return errors.New("ID3v2 tag too large")
+	}
+	// grows with what is actually there, so a truncated file can't claim the whole size up front
+	body, err := io.ReadAll(io.LimitReader(r, int64(size)))
+	if err != nil {
+		return err
+	}
+	if len(body) < size {
+		return io.ErrUnexpectedEOF
+	}
+	if flags&0x80 != 0 && version < 4 {
+		body = unsynchronise(body)
+	}
+	if flags&0x40 != 0 && version > 2 && len(body) >= 4 {
+		// extended header; v2.4 counts its own size bytes, v2.3 doesn't
+		extSize := int(binary.BigEndian.Uint32(body))
+		if version == 4 {
+			extSize = syncsafe(body[:4])
+		} else {
+			extSize += 4
+		}
+		if extSize > len(body) {
+			return errors.New("broken ID3v2 extended header")
+		}
+		body = body[extSize:]
+	}
+
+	idLen, headerLen := 4, 10
+	if version == 2 {
+		idLen, headerLen = 3, 6
+	}
+	for len(body) >= headerLen && body[0] != 0 {
+		id := string(body[:idLen])
+		var size int
+		var frameFlags uint16
+		switch version {
+		case 2:
+			size = int(body[3])<<16 | int(body[4])<<8 | int(body[5])
+		case 3:
+			size = int(binary.BigEndian.Uint32(body[4:8]))
+			frameFlags = binary.BigEndian.Uint16(body[8:10])
+		case 4:
+			size = syncsafe(body[4:8])
+			frameFlags = binary.BigEndian.Uint16(body[8:10])
+		}
+		if size < 0 || headerLen+size > len(body) {
+			break
+		}
+		data := body[headerLen : headerLen+size]
+		body = body[headerLen+size:]
+
+		// compressed and encrypted frames aren't worth the trouble
+		if (version == 3 && frameFlags&0x00c0 != 0) || (version == 4 && frameFlags&0x000c != 0) {
+			continue
+		}
+		if version == 4 && frameFlags&0x0002 != 0 {
+			data = unsynchronise(data)
+		}
+		if version == 4 && frameFlags&0x0001 != 0 && len(data) >= 4 {
+			// data length indicator
+			data = data[4:]
+		}
+		fn(id, data)
+	}
+	return nil
+}
+
+func readID3v2(r io.Reader) (Tags, error) {
+	var tags Tags
+	err := id3Frames(r, func(id string, data []byte) {
+		field, ok := id3Fields[id]
+		if !ok {
+			return
+		}
+		for _, value := range id3Text(data) {
+			if field == "genre" {
+				value = id3Genre(value)
+			}
+			tags.set(field, value)
+		}
+	})
+	return tags, err
+}
+
+// Vorbis comment names, which are case insensitive
+var vorbisFields = map[string]string{
+	"TITLE":    "title",
+	"ARTIST":   "artist",
+	"DATE":     "date",
+	"YEAR":     "date",
+	"GENRE":    "genre",
+	"BPM":      "bpm",
+	"ISRC":     "isrc",
+	"LANGUAGE": "language",
+}
+
+// reads a Vorbis comment block, as found in flac and ogg files
+func readVorbisComment(b []byte, tags *Tags) error {
+	errBroken := errors.New("broken Vorbis comment")
+	if len(b) < 4 {
+		return errBroken
+	}
+	vendorLen := int(binary.LittleEndian.Uint32(b))
+	if 4+vendorLen+4 > len(b) {
+		return errBroken
+	}
+	b = b[4+vendorLen:]
+	count := int(binary.LittleEndian.Uint32(b))
+	b = b[4:]
+
+	for i := 0; i < count; i++ {
+		if len(b) < 4 {
+			return errBroken
+		}
+		length := int(binary.LittleEndian.Uint32(b))
+		if 4+length > len(b) || length < 0 {
+			return errBroken
+		}
+		comment := string(b[4 : 4+length])
+		b = b[4+length:]
+
+		eq := strings.Index(comment, "=")
+		if eq < 0 {
+			continue
+		}
+		if field, ok := vorbisFields[strings.ToUpper(comment[:eq])]; ok {
+			tags.set(field, comment[eq+1:])
+		}
+	}
+	return nil
+}
+
+// calls fn with the type and contents of every flac metadata block
+func flacBlocks(r io.Reader, fn func(blockType byte, block []byte) error) error {
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != "fLaC" {
+		return errors.New("not a flac file")
+	}
+
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return err
+		}
+		last := header[0]&0x80 != 0
+		blockType := header[0] & 0x7f
+		size := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+
+		block := make([]byte, size)
+		if _, err := io.ReadFull(r, block); err != nil {
+			return err
+		}
+		if err := fn(blockType, block); err != nil {
+			return err
+		}
+
+		if last {
+			return nil
+		}
+	}
+}
+
+func readFLACTags(r io.Reader) (Tags, error) {
+	var tags Tags
+
+	found := false
+	err := flacBlocks(r, func(blockType byte, block []byte) error {
+		switch blockType {
+		case 0:
+			// STREAMINFO knows the length without decoding
+			if len(block) >= 18 {
+				info := binary.BigEndian.Uint64(block[10:18])
+				rate := info >> 44
+				samples := info & (1<<36 - 1)
+				if rate > 0 {
+					tags.Length = time.Duration(samples) * time.Second / time.Duration(rate)
+				}
+			}
+		case 4:
+			if err := readVorbisComment(block, &tags); err != nil {
+				return err
+			}
+			found = true
+		}
+		return nil
+	})
+	if err != nil {
+		return tags, err
+	}
+
+	if !found {
+		return tags, ErrNoTags
+	}
+	return tags, nil
+}
+
+// packets bigger than this are taken for a broken file; comments may carry a cover
+const maxOggPacket = 16 << 20
+
+// returns the first count packets of the first logical stream of an ogg file
+func oggPackets(r io.Reader, count int) ([][]byte, error) {
+	var packets [][]byte
+	var packet []byte
+	serial := -1
+
+	header := make([]byte, 27)
+	for len(packets) < count {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return packets, err
+		}
+		if string(header[:4]) != "OggS" {
+			return packets, errors.New("broken ogg page")
+		}
+		segments := make([]byte, header[26])
+		if _, err := io.ReadFull(r, segments); err != nil {
+			return packets, err
+		}
+		size := 0
+		for _, segment := range segments {
+			size += int(segment)
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return packets, err
+		}
+
+		// pages of other streams may be interleaved with the ones we want
+		pageSerial := int(binary.LittleEndian.Uint32(header[14:18]))
+		if serial == -1 {
+			serial = pageSerial
+		} else if pageSerial != serial {
+			continue
+		}
+
+		// segments shorter than 255 bytes end a packet
+		for _, segment := range segments {
+			packet = append(packet, data[:segment]...)
+			data = data[segment:]
+			if len(packet) > maxOggPacket {
+				return packets, errors.New("ogg packet too large")
+			}
+			if segment < 255 {
+				packets = append(packets, packet)
+				packet = nil
+				if len(packets) == count {
+					break
+				}
+			}
+		}
+	}
+	return packets, nil
+}
+
+// the comment header is the second packet of a Vorbis stream
+func readOggTags(r io.Reader) (Tags, error) {
+	var tags Tags
+
+	packets, err := oggPackets(r, 2)
+	if err != nil {
+		return tags, err
+	}
+	if !bytes.HasPrefix(packets[0], []byte("\x01vorbis")) {
+		return tags, errors.New("ogg file isn't Vorbis")
+	}
+	if !bytes.HasPrefix(packets[1], []byte("\x03vorbis")) {
+		return tags, ErrNoTags
+	}
+	if err := readVorbisComment(packets[1][7:], &tags); err != nil {
+		return tags, err
+	}
+	return tags, nil
+}
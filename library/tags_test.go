@@ -0,0 +1,364 @@
+package library
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func syncsafeBytes(size int) []byte {
+	return []byte{byte(size >> 21 & 0x7f), byte(size >> 14 & 0x7f), byte(size >> 7 & 0x7f), byte(size & 0x7f)}
+}
+
+// a text frame in ISO-8859-1, laid out for the given tag version
+func id3Frame(version byte, id, text string) []byte {
+	data := append([]byte{0}, text...)
+	switch version {
+	case 2:
+		return append([]byte{id[0], id[1], id[2], 0, byte(len(data) >> 8), byte(len(data))}, data...)
+	case 3:
+		header := append([]byte(id), 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(header[4:], uint32(len(data)))
+		return append(header, data...)
+	}
+	header := append(append([]byte(id), syncsafeBytes(len(data))...), 0, 0)
+	return append(header, data...)
+}
+
+func id3Tag(version, flags byte, body ...[]byte) []byte {
+	joined := bytes.Join(body, nil)
+	header := append([]byte{'I', 'D', '3', version, 0, flags}, syncsafeBytes(len(joined))...)
+	return append(header, joined...)
+}
+
+func TestReadID3v2(t *testing.T) {
+	title := id3Frame(3, "TIT2", "Song")
+	tests := []struct {
+		name    string
+		input   []byte
+		want    Tags
+		wantErr error
+		// any error will do
+		wantBroken bool
+	}{
+		{
+			name:  "v2.2",
+			input: id3Tag(2, 0, id3Frame(2, "TT2", "Song"), id3Frame(2, "TP1", "Band"), id3Frame(2, "TCO", "(17)")),
+			want:  Tags{Title: "Song", Artist: "Band", Genres: []string{"Rock"}},
+		},
+		{
+			name:  "v2.3",
+			input: id3Tag(3, 0, title, id3Frame(3, "TYER", "1999"), id3Frame(3, "TBPM", "120")),
+			want:  Tags{Title: "Song", ReleaseDate: time.Date(1999, 1, 1, 0, 0, 0, 0, time.UTC), BPM: 120},
+		},
+		{
+			name:  "v2.4",
+			input: id3Tag(4, 0, id3Frame(4, "TIT2", "Song"), id3Frame(4, "TLEN", "90000")),
+			want:  Tags{Title: "Song", Length: 90 * time.Second},
+		},
+		{
+			name:  "padding",
+			input: id3Tag(3, 0, title, make([]byte, 64), id3Frame(3, "TPE1", "hidden")),
+			want:  Tags{Title: "Song"},
+		},
+		{
+			name:  "empty frame",
+			input: id3Tag(3, 0, []byte{'T', 'P', 'E', '1', 0, 0, 0, 0, 0, 0}, title),
+			want:  Tags{Title: "Song"},
+		},
+		{
+			name:  "frame running past the tag",
+			input: id3Tag(3, 0, title, id3Frame(3, "TPE1", "Band")[:14]),
+			want:  Tags{Title: "Song"},
+		},
+		{
+			name:  "frame size with the top bit set",
+			input: id3Tag(3, 0, title, []byte{'T', 'P', 'E', '1', 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 'x'}),
+			want:  Tags{Title: "Song"},
+		},
+		{
+			name:       "extended header larger than the tag",
+			input:      id3Tag(3, 0x40, []byte{0, 0, 1, 0}, title),
+			wantBroken: true,
+		},
+		{
+			name:    "empty file",
+			wantErr: ErrNoTags,
+		},
+		{
+			name:    "short header",
+			input:   []byte("ID3\x03\x00"),
+			wantErr: ErrNoTags,
+		},
+		{
+			name:    "no tag",
+			input:   []byte("\xff\xfb\x90\x00 frames of audio"),
+			wantErr: ErrNoTags,
+		},
+		{
+			name:       "unknown version",
+			input:      id3Tag(5, 0, title),
+			wantBroken: true,
+		},
+		{
+			name:    "truncated tag",
+			input:   id3Tag(3, 0, title, id3Frame(3, "TPE1", "Band"))[:20],
+			wantErr: io.ErrUnexpectedEOF,
+		},
+		{
+			name:    "header claiming megabytes",
+			input:   append([]byte{'I', 'D', '3', 3, 0, 0}, syncsafeBytes(4<<20)...),
+			wantErr: io.ErrUnexpectedEOF,
+		},
+		{
+			name:       "header claiming the largest size",
+			input:      []byte{'I', 'D', '3', 4, 0, 0, 0x7f, 0x7f, 0x7f, 0x7f},
+			wantBroken: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tags, err := readID3v2(bytes.NewReader(tt.input))
+			if tt.wantBroken {
+				if err == nil {
+					t.Fatalf("readID3v2 = %+v, want an error", tags)
+				}
+				return
+			}
+			if err != tt.wantErr {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(tags, tt.want) {
+				t.Errorf("tags = %+v, want %+v", tags, tt.want)
+			}
+		})
+	}
+}
+
+func vorbisComment(vendor string, count int, comments ...string) []byte {
+	b := make([]byte, 4, 64)
+	binary.LittleEndian.PutUint32(b, uint32(len(vendor)))
+	b = append(b, vendor...)
+	b = append(b, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(b[len(b)-4:], uint32(count))
+	for _, comment := range comments {
+		b = append(b, 0, 0, 0, 0)
+		binary.LittleEndian.PutUint32(b[len(b)-4:], uint32(len(comment)))
+		b = append(b, comment...)
+	}
+	return b
+}
+
+func TestReadVorbisComment(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      []byte
+		want       Tags
+		wantBroken bool
+	}{
+		{
+			name:  "fields",
+			input: vorbisComment("encoder", 4, "TITLE=Song", "artist=A", "Artist=B", "DATE=2001-02-03"),
+			want:  Tags{Title: "Song", Artist: "A, B", ReleaseDate: time.Date(2001, 2, 3, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			name:  "unknown and malformed comments skipped",
+			input: vorbisComment("", 3, "COMMENT=hi", "no equals sign", "GENRE=Jazz"),
+			want:  Tags{Genres: []string{"Jazz"}},
+		},
+		{
+			name:  "no comments",
+			input: vorbisComment("encoder", 0),
+		},
+		{
+			name:       "empty",
+			wantBroken: true,
+		},
+		{
+			name:       "shorter than the vendor length",
+			input:      []byte{1, 0, 0},
+			wantBroken: true,
+		},
+		{
+			name:       "vendor running past the end",
+			input:      vorbisComment("encoder", 0)[:9],
+			wantBroken: true,
+		},
+		{
+			name:       "vendor length with the top bit set",
+			input:      []byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0},
+			wantBroken: true,
+		},
+		{
+			name:       "fewer comments than counted",
+			input:      vorbisComment("", 3, "TITLE=Song"),
+			want:       Tags{Title: "Song"},
+			wantBroken: true,
+		},
+		{
+			name:       "huge count",
+			input:      vorbisComment("", 0x7fffffff),
+			wantBroken: true,
+		},
+		{
+			name:       "comment running past the end",
+			input:      vorbisComment("", 1, "TITLE=Song")[:15],
+			wantBroken: true,
+		},
+		{
+			name:       "comment length with the top bit set",
+			input:      append(vorbisComment("", 1), 0xff, 0xff, 0xff, 0xff, 'x'),
+			wantBroken: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tags Tags
+			err := readVorbisComment(tt.input, &tags)
+			if (err != nil) != tt.wantBroken {
+				t.Fatalf("error = %v, want broken %v", err, tt.wantBroken)
+			}
+			if !reflect.DeepEqual(tags, tt.want) {
+				t.Errorf("tags = %+v, want %+v", tags, tt.want)
+			}
+		})
+	}
+}
+
+func oggPage(serial uint32, lacing []byte, data []byte) []byte {
+	header := make([]byte, 27)
+	copy(header, "OggS")
+	binary.LittleEndian.PutUint32(header[14:], serial)
+	header[26] = byte(len(lacing))
+	return append(append(header, lacing...), data...)
+}
+
+// lacing values of whole packets of the given sizes
+func oggLacing(sizes ...int) []byte {
+	var lacing []byte
+	for _, size := range sizes {
+		for ; size >= 255; size -= 255 {
+			lacing = append(lacing, 255)
+		}
+		lacing = append(lacing, byte(size))
+	}
+	return lacing
+}
+
+func TestOggPackets(t *testing.T) {
+	long := bytes.Repeat([]byte("l"), 300)
+	both := oggPage(1, oggLacing(3, 5), []byte("onetwo.."))
+	// a page full of one packet which goes on in the next
+	full := oggPage(1, bytes.Repeat([]byte{255}, 255), make([]byte, 255*255))
+
+	tests := []struct {
+		name    string
+		input   io.Reader
+		count   int
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "two packets on one page",
+			input: bytes.NewReader(both),
+			count: 2,
+			want:  []string{"one", "two.."},
+		},
+		{
+			name:  "fewer wanted",
+			input: bytes.NewReader(both),
+			count: 1,
+			want:  []string{"one"},
+		},
+		{
+			name:  "packet across pages",
+			input: bytes.NewReader(append(oggPage(1, []byte{255}, long[:255]), oggPage(1, []byte{45}, long[255:])...)),
+			count: 1,
+			want:  []string{string(long)},
+		},
+		{
+			name:  "other streams skipped",
+			input: bytes.NewReader(append(append(oggPage(1, oggLacing(3), []byte("one")), oggPage(2, oggLacing(5), []byte("other"))...), oggPage(1, oggLacing(3), []byte("two"))...)),
+			count: 2,
+			want:  []string{"one", "two"},
+		},
+		{
+			name:  "empty packet",
+			input: bytes.NewReader(oggPage(1, oggLacing(0, 3), []byte("one"))),
+			count: 2,
+			want:  []string{"", "one"},
+		},
+		{
+			name:    "empty",
+			input:   bytes.NewReader(nil),
+			count:   1,
+			wantErr: true,
+		},
+		{
+			name:    "fewer packets than wanted",
+			input:   bytes.NewReader(both),
+			count:   3,
+			want:    []string{"one", "two.."},
+			wantErr: true,
+		},
+		{
+			name:    "not an ogg page",
+			input:   bytes.NewReader(append([]byte("RIFF"), both[4:]...)),
+			count:   1,
+			wantErr: true,
+		},
+		{
+			name:    "truncated header",
+			input:   bytes.NewReader(both[:20]),
+			count:   1,
+			wantErr: true,
+		},
+		{
+			name:    "truncated segment table",
+			input:   bytes.NewReader(both[:28]),
+			count:   1,
+			wantErr: true,
+		},
+		{
+			name:    "truncated data",
+			input:   bytes.NewReader(both[:len(both)-2]),
+			count:   1,
+			wantErr: true,
+		},
+		{
+			name:    "packet that never ends",
+			input:   io.MultiReader(repeatReaders(full, maxOggPacket/len(full)+2)...),
+			count:   1,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packets, err := oggPackets(tt.input, tt.count)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want an error %v", err, tt.wantErr)
+			}
+			var got []string
+			for _, packet := range packets {
+				got = append(got, string(packet))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("packets = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func repeatReaders(b []byte, n int) []io.Reader {
+	readers := make([]io.Reader, n)
+	for i := range readers {
+		readers[i] = bytes.NewReader(b)
+	}
+	return readers
+}
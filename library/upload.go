@@ -0,0 +1,238 @@
+package library
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"radio/database"
+	"radio/utils"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// the whole request, audio and cover together
+const maxUploadSize = 512 << 20
+
+// copies a form file into dir/name
+func saveUpload(header *multipart.FileHeader, dir, name string) (string, error) {
+	in, err := header.Open()
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	target := filepath.Join(dir, name)
+	out, err := os.Create(target)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return "", err
+	}
+	return target, out.Close()
+}
+
+// checks that the cover is a JPEG or PNG image and stores it as dir/cover.jpg
+func saveCover(header *multipart.FileHeader, dir string) error {
+	in, err := header.Open()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	config, _, err := image.DecodeConfig(in)
+	if err != nil {
+		return errors.New("cover must be a JPEG or PNG image")
+	}
+	if err := checkCoverSize(config); err != nil {
+		return err
+	}
+	if _, err := in.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	img, format, err := image.Decode(in)
+	if err != nil {
+		return errors.New("cover must be a JPEG or PNG image")
+	}
+	target := filepath.Join(dir, "cover.jpg")
+	if format == "jpeg" {
+		// keep the original bytes rather than recompressing them
+		if _, err := in.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		out, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	}
+
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if err := jpeg.Encode(out, img, &jpeg.Options{Quality: 90}); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// applies the metadata fields sent along with the upload
+func applyUploadFields(song *database.SongData, form *multipart.Form) error {
+	get := func(field string) (string, bool) {
+		values, ok := form.Value[field]
+		if !ok || len(values) == 0 {
+			return "", false
+		}
+		return strings.TrimSpace(values[0]), true
+	}
+
+	if value, ok := get("title"); ok && value != "" {
+		song.Title = value
+	}
+	if value, ok := get("authors"); ok && value != "" {
+		song.Authors = value
+	}
+	if value, ok := get("youtube_id"); ok {
+		song.YTId = value
+	}
+	if value, ok := get("release_date"); ok {
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return errors.New("release_date must be YYYY-MM-dd")
+		}
+		song.ReleaseDate = date
+	}
+	if value, ok := get("bpm"); ok {
+		bpm, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.New("bpm must be a number")
+		}
+		song.BPM = bpm
+	}
+	if value, ok := get("language"); ok {
+		song.Language = value
+	}
+	if value, ok := get("explicit"); ok {
+		explicit, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.New("explicit must be true or false")
+		}
+		song.Explicit = explicit
+	}
+	if value, ok := get("isrc"); ok {
+		song.ISRC = value
+	}
+	if value, ok := get("genres"); ok {
+		song.Genres = database.SplitTags(value)
+	}
+	if value, ok := get("tags"); ok {
+		song.Tags = database.SplitTags(value)
+	}
+	return song.Validate()
+}
+
+// stages the files in a hidden folder, which the scanner skips, and
+// renames it to music/<id>/ once the song row exists
+func importUpload(form *multipart.Form) (*database.SongData, error) {
+	audios := form.File["audio"]
+	if len(audios) == 0 {
+		return nil, errors.New("audio file is missing")
+	}
+	audio := audios[0]
+	ext := strings.ToLower(filepath.Ext(audio.Filename))
+	if !isAudio(audio.Filename) {
+		return nil, fmt.Errorf("%s isn't supported, upload one of %s", audio.Filename, strings.Join(AudioExtensions, ", "))
+	}
+
+	if err := os.MkdirAll(database.MusicDir, 0755); err != nil {
+		return nil, err
+	}
+	staging, err := ioutil.TempDir(database.MusicDir, ".upload-")
+	if err != nil {
+		return nil, err
+	}
+	// gone after the rename, so this only cleans up failed uploads
+	defer os.RemoveAll(staging)
+
+	file, err := saveUpload(audio, staging, "audio"+ext)
+	if err != nil {
+		return nil, err
+	}
+	if covers := form.File["cover"]; len(covers) > 0 {
+		if err := saveCover(covers[0], staging); err != nil {
+			return nil, err
+		}
+	}
+
+	tags, err := ReadTags(file)
+	if err != nil && err != ErrNoTags {
+		log.Printf("Couldn't read the tags of %s: %v\n", audio.Filename, err)
+	}
+	song := songFromFile(audio.Filename, tags)
+	if err := applyUploadFields(&song, form); err != nil {
+		return nil, err
+	}
+
+	songid, err := importAudio(file, song, func(dir string) error {
+		if err := os.Rename(staging, dir); err != nil {
+			return err
+		}
+		// the folder was created with TempDir's private permissions
+		os.Chmod(dir, 0755)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s %v", audio.Filename, err)
+	}
+
+	return database.GetSongData(strconv.Itoa(songid)), nil
+}
+
+// POST multipart/form-data with an audio file, an optional cover image and any of
+// title, authors, youtube_id, release_date, bpm, language, explicit, isrc, genres and tags;
+// fields left out are taken from the audio's tags
+func HTTPUploadSong(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		utils.SendErrorJSON(w, r, "Upload must be multipart/form-data of at most "+strconv.Itoa(maxUploadSize>>20)+" MB")
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	song, err := importUpload(r.MultipartForm)
+	if err != nil {
+		utils.SendErrorJSON(w, r, err.Error())
+		return
+	}
+	if song == nil {
+		utils.SendErrorJSON(w, r, "Unknown error")
+		return
+	}
+	if token := database.RequestToken(r); token != nil {
+		log.Printf("%s uploaded song %d (%s - %s)\n", token.Name, song.SongId, song.Authors, song.Title)
+	}
+
+	j, _ := utils.JSONMarshal(song)
+
+	utils.SendJSON(w, r, j)
+}
@@ -0,0 +1,171 @@
+package library
+
+import (
+	"bytes"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"radio/database"
+)
+
+type formFile struct {
+	name string
+	data []byte
+}
+
+// parses a multipart form with the given fields and files, keyed by field name
+func uploadForm(t *testing.T, fields map[string]string, files map[string]formFile) *multipart.Form {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for field, value := range fields {
+		w.WriteField(field, value)
+	}
+	for field, file := range files {
+		part, err := w.CreateFormFile(field, file.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(file.data)
+	}
+	w.Close()
+
+	form, err := multipart.NewReader(&body, w.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { form.RemoveAll() })
+	return form
+}
+
+func TestImportUpload(t *testing.T) {
+	tests := []struct {
+		name        string
+		fields      map[string]string
+		files       map[string]formFile
+		wantErr     bool
+		wantAuthors string
+		wantTitle   string
+	}{
+		{
+			name:        "audio named after the song",
+			files:       map[string]formFile{"audio": {"Band - Song.wav", wavFile(3)}},
+			wantAuthors: "Band",
+			wantTitle:   "Song",
+		},
+		{
+			name:        "fields win over the name",
+			fields:      map[string]string{"title": "Other", "bpm": "120"},
+			files:       map[string]formFile{"audio": {"Band - Song.wav", wavFile(3)}},
+			wantAuthors: "Band",
+			wantTitle:   "Other",
+		},
+		{
+			name:    "no audio",
+			fields:  map[string]string{"title": "Song"},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported extension",
+			files:   map[string]formFile{"audio": {"song.txt", wavFile(3)}},
+			wantErr: true,
+		},
+		{
+			name:    "truncated audio",
+			files:   map[string]formFile{"audio": {"song.wav", wavFile(3)[:30]}},
+			wantErr: true,
+		},
+		{
+			name:    "no samples",
+			files:   map[string]formFile{"audio": {"song.wav", wavFile(0)}},
+			wantErr: true,
+		},
+		{
+			name:    "broken field",
+			fields:  map[string]string{"bpm": "fast"},
+			files:   map[string]formFile{"audio": {"song.wav", wavFile(3)}},
+			wantErr: true,
+		},
+		{
+			name:    "cover that isn't an image",
+			files:   map[string]formFile{"audio": {"song.wav", wavFile(3)}, "cover": {"cover.jpg", []byte("not an image")}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inTempDir(t)
+			database.SetStore(database.NewMemoryStore())
+
+			song, err := importUpload(uploadForm(t, tt.fields, tt.files))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want an error %v", err, tt.wantErr)
+			}
+			left, _ := filepath.Glob(filepath.Join(database.MusicDir, ".upload-*"))
+			if len(left) != 0 {
+				t.Errorf("staging folders left behind: %v", left)
+			}
+			if tt.wantErr {
+				if songs := database.GetSongArray(); len(songs) != 0 {
+					t.Errorf("songs = %+v, want none", songs)
+				}
+				return
+			}
+			if song.Authors != tt.wantAuthors || song.Title != tt.wantTitle || song.Length != 3 {
+				t.Errorf("song = %+v, want %s - %s of 3 seconds", song, tt.wantAuthors, tt.wantTitle)
+			}
+			if file := AudioFile(song.SongId); file != filepath.Join(database.MusicDir, strconv.Itoa(song.SongId), "audio.wav") {
+				t.Errorf("audio file = %q", file)
+			}
+		})
+	}
+}
+
+func TestImportFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		audio    []byte
+		keep     bool
+		wantErr  bool
+		wantLeft bool
+	}{
+		{name: "moved", audio: wavFile(2)},
+		{name: "copied", audio: wavFile(2), keep: true, wantLeft: true},
+		{name: "broken audio left where it is", audio: []byte("RIFF"), wantErr: true, wantLeft: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inTempDir(t)
+			database.SetStore(database.NewMemoryStore())
+			file := filepath.Join(database.MusicDir, "new", "Band - Song.wav")
+			if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(file, tt.audio, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			songid, err := importFile(file, songFromFile(file, Tags{}), tt.keep)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want an error %v", err, tt.wantErr)
+			}
+			if _, err := os.Stat(file); (err == nil) != tt.wantLeft {
+				t.Errorf("original still there = %v, want %v", err == nil, tt.wantLeft)
+			}
+			if tt.wantErr {
+				if songs := database.GetSongArray(); len(songs) != 0 {
+					t.Errorf("songs = %+v, want none", songs)
+				}
+				return
+			}
+			song := database.GetSongData(strconv.Itoa(songid))
+			if song == nil || song.Length != 2 || AudioFile(songid) == "" {
+				t.Errorf("song = %+v with audio %q, want one of 2 seconds with its audio stored", song, AudioFile(songid))
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package library
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"radio/database"
+	"radio/utils"
+
+	"github.com/faiface/beep"
+	"github.com/julienschmidt/httprouter"
+)
+
+// peaks over the whole song, unless asked for otherwise
+const (
+	defaultWaveformResolution = 1000
+	maxWaveformResolution     = 20000
+)
+
+// samples are first reduced to peaks of this many, which are then merged
+// into the requested resolution; so the length needn't be known upfront
+const waveformBlock = 32
+
+// min/max peaks of the decoded audio, as the admin UI draws them
+type Waveform struct {
+	SongId int `json:"song_id"`
+	// of the decoded audio in milliseconds; peak i covers [i, i+1) * Duration / len(Peaks)
+	Duration int `json:"duration_ms"`
+	// the lowest and highest sample of any channel in each stretch, from -1 to 1;
+	// fewer than the requested resolution for very short songs
+	Peaks [][2]float64 `json:"peaks"`
+}
+
+type peakScanner struct {
+	channels int
+	samples  int
+	inBlock  int
+	low      float64
+	high     float64
+	// lowest and highest sample of every block
+	blocks [][2]float64
+}
+
+func newPeakScanner(channels int) *peakScanner {
+	if channels > 2 {
+		channels = 2
+	}
+	return &peakScanner{channels: channels}
+}
+
+func (p *peakScanner) write(samples [][2]float64) {
+	for _, sample := range samples {
+		for c := 0; c < p.channels; c++ {
+			// JSON has no room for NaN or infinity
+			if math.IsNaN(sample[c]) || math.IsInf(sample[c], 0) {
+				continue
+			}
+			p.low = math.Min(p.low, sample[c])
+			p.high = math.Max(p.high, sample[c])
+		}
+		p.samples++
+		p.inBlock++
+		if p.inBlock == waveformBlock {
+			p.flush()
+		}
+	}
+}
+
+func (p *peakScanner) flush() {
+	p.blocks = append(p.blocks, [2]float64{p.low, p.high})
+	p.low, p.high = 0, 0
+	p.inBlock = 0
+}
+
+// merges the blocks into resolution peaks
+func (p *peakScanner) peaks(resolution int) [][2]float64 {
+	if p.inBlock > 0 {
+		p.flush()
+	}
+	if resolution > len(p.blocks) {
+		resolution = len(p.blocks)
+	}
+	round := func(x float64) float64 {
+		return math.Round(x*1000) / 1000
+	}
+
+	peaks := make([][2]float64, resolution)
+	for i := range peaks {
+		from := i * len(p.blocks) / resolution
+		to := (i + 1) * len(p.blocks) / resolution
+		low, high := 0.0, 0.0
+		for _, block := range p.blocks[from:to] {
+			low = math.Min(low, block[0])
+			high = math.Max(high, block[1])
+		}
+		peaks[i] = [2]float64{round(low), round(high)}
+	}
+	return peaks
+}
+
+// decodes the file and reduces it to resolution peaks
+func ComputeWaveform(file string, resolution int) (*Waveform, error) {
+	var scanner *peakScanner
+	var rate beep.SampleRate
+	err := scanAudio(file, func(format beep.Format) audioScanner {
+		scanner = newPeakScanner(format.NumChannels)
+		rate = format.SampleRate
+		return scanner
+	})
+	if err != nil {
+		return nil, err
+	}
+	duration := int(rate.D(scanner.samples).Milliseconds())
+	return &Waveform{Duration: duration, Peaks: scanner.peaks(resolution)}, nil
+}
+
+// where the waveform of a song is cached, next to its audio
+func waveformFile(songid, resolution int) string {
+	return filepath.Join(database.MusicDir, strconv.Itoa(songid), "waveform-"+strconv.Itoa(resolution)+".json")
+}
+
+// returns the waveform of a song as JSON, from the cache unless the audio changed since
+func GetWaveform(songid, resolution int) ([]byte, error) {
+	file := AudioFile(songid)
+	if file == "" {
+		return nil, ErrNoAudio
+	}
+	audio, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	cache := waveformFile(songid, resolution)
+	if cached, err := os.Stat(cache); err == nil && cached.ModTime().After(audio.ModTime()) {
+		if data, err := ioutil.ReadFile(cache); err == nil {
+			return data, nil
+		}
+	}
+
+	waveform, err := ComputeWaveform(file, resolution)
+	if err != nil {
+		return nil, err
+	}
+	waveform.SongId = songid
+	data, err := json.Marshal(waveform)
+	if err != nil {
+		return nil, err
+	}
+
+	// written aside and renamed, so a request at the same time never reads half of it
+	temp := cache + ".tmp"
+	err = ioutil.WriteFile(temp, data, 0644)
+	if err == nil {
+		err = os.Rename(temp, cache)
+	}
+	if err != nil {
+		os.Remove(temp)
+		log.Printf("Couldn't cache the waveform of song %d: %v\n", songid, err)
+	}
+	return data, nil
+}
+
+// ?id=<song id>&resolution=<number of peaks>
+func HTTPGetWaveform(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	query := r.URL.Query()
+	song := database.GetSongData(query.Get("id"))
+	if song == nil {
+		utils.SendErrorJSON(w, r, "No song with id "+query.Get("id")+" found")
+		return
+	}
+
+	resolution := defaultWaveformResolution
+	if value := query.Get("resolution"); value != "" {
+		var err error
+		resolution, err = strconv.Atoi(value)
+		if err != nil || resolution < 1 || resolution > maxWaveformResolution {
+			utils.SendErrorJSON(w, r, "resolution must be a number of peaks from 1 to "+strconv.Itoa(maxWaveformResolution))
+			return
+		}
+	}
+
+	data, err := GetWaveform(song.SongId, resolution)
+	if err == ErrNoAudio {
+		utils.SendErrorJSON(w, r, err.Error())
+		return
+	}
+	if err != nil {
+		utils.SendErrorJSON(w, r, "Couldn't decode the audio")
+		log.Printf("Couldn't make the waveform of song %d: %v\n", song.SongId, err)
+		return
+	}
+
+	utils.SendJSON(w, r, data)
+}
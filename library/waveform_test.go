@@ -0,0 +1,117 @@
+package library
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestPeakScanner(t *testing.T) {
+	// one block of samples from low to high in the first channel and at half of that in the second
+	block := func(low, high float64) [][2]float64 {
+		samples := make([][2]float64, waveformBlock)
+		samples[0] = [2]float64{low, low / 2}
+		samples[1] = [2]float64{high, high / 2}
+		return samples
+	}
+	join := func(blocks ...[][2]float64) [][2]float64 {
+		var samples [][2]float64
+		for _, b := range blocks {
+			samples = append(samples, b...)
+		}
+		return samples
+	}
+
+	tests := []struct {
+		name       string
+		channels   int
+		samples    [][2]float64
+		resolution int
+		want       [][2]float64
+	}{
+		{
+			name:       "one peak per block",
+			channels:   2,
+			samples:    join(block(-0.5, 0.5), block(-0.25, 0.75)),
+			resolution: 2,
+			want:       [][2]float64{{-0.5, 0.5}, {-0.25, 0.75}},
+		},
+		{
+			name:       "blocks merged",
+			channels:   2,
+			samples:    join(block(-0.5, 0.5), block(-0.25, 0.75), block(-0.1, 0.1), block(-0.2, 0.2)),
+			resolution: 2,
+			want:       [][2]float64{{-0.5, 0.75}, {-0.2, 0.2}},
+		},
+		{
+			name:       "uneven split",
+			channels:   2,
+			samples:    join(block(-0.5, 0.5), block(-0.25, 0.75), block(-0.1, 0.1)),
+			resolution: 2,
+			want:       [][2]float64{{-0.5, 0.5}, {-0.25, 0.75}},
+		},
+		{
+			name:       "fewer blocks than asked for",
+			channels:   2,
+			samples:    block(-0.5, 0.5),
+			resolution: 1000,
+			want:       [][2]float64{{-0.5, 0.5}},
+		},
+		{
+			name:       "partial block",
+			channels:   2,
+			samples:    [][2]float64{{0.3, 0.3}},
+			resolution: 10,
+			want:       [][2]float64{{0, 0.3}},
+		},
+		{
+			name:       "mono ignores the second channel",
+			channels:   1,
+			samples:    [][2]float64{{0.1, -0.9}},
+			resolution: 1,
+			want:       [][2]float64{{0, 0.1}},
+		},
+		{
+			name:       "rounded",
+			channels:   1,
+			samples:    [][2]float64{{0.12345, 0}},
+			resolution: 1,
+			want:       [][2]float64{{0, 0.123}},
+		},
+		{
+			name:       "non-finite samples skipped",
+			channels:   2,
+			samples:    [][2]float64{{math.NaN(), 0.2}, {math.Inf(1), math.Inf(-1)}},
+			resolution: 1,
+			want:       [][2]float64{{0, 0.2}},
+		},
+		{
+			name:       "no samples",
+			channels:   2,
+			resolution: 1000,
+			want:       [][2]float64{},
+		},
+		{
+			name:       "no peaks asked for",
+			channels:   2,
+			samples:    block(-0.5, 0.5),
+			resolution: 0,
+			want:       [][2]float64{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scanner := newPeakScanner(tt.channels)
+			scanner.write(tt.samples)
+			peaks := scanner.peaks(tt.resolution)
+			if !reflect.DeepEqual(peaks, tt.want) {
+				t.Errorf("peaks = %v, want %v", peaks, tt.want)
+			}
+			if _, err := json.Marshal(peaks); err != nil {
+				t.Errorf("peaks can't be sent: %v", err)
+			}
+		})
+	}
+}
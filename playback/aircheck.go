@@ -0,0 +1,513 @@
+package playback
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"radio/database"
+	"radio/utils"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// set by SetAircheck from the -aircheck-* flags; nothing is recorded while AircheckDir is ""
+var (
+	AircheckDir       string
+	AircheckFormat    = "flac"
+	AircheckRetention time.Duration
+)
+
+// recordings are named after the time they start at, e.g. 2026-10-18_13-00-00.flac,
+// next to a log of what was on air in 2026-10-18_13-00-00.jsonl
+const aircheckLayout = "2006-01-02_15-04-05"
+
+var aircheckFile = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}_\d{2}-\d{2}-\d{2})\.(wav|flac|jsonl)$`)
+
+// how much of the mix waits for the disk before the recorder drops it
+const aircheckBuffer = 30 * time.Second
+
+// after failing to write, the recorder tries a new file this much later
+const aircheckRetry = time.Minute
+
+var ErrNoAircheck = errors.New("no such recording")
+
+// checks and sets where the station's output is recorded to; call it before Init.
+// Recordings older than retention are deleted, none if it's 0.
+func SetAircheck(dir, format string, retention time.Duration) error {
+	if format != "wav" && format != "flac" {
+		return errors.New("aircheck format must be wav or flac")
+	}
+	if retention < 0 {
+		return errors.New("aircheck retention can't be negative")
+	}
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	AircheckDir, AircheckFormat, AircheckRetention = dir, format, retention
+	return nil
+}
+
+// a line of the log next to every recording
+type AircheckEvent struct {
+	// into the recording, in milliseconds
+	Offset int64     `json:"offset_ms"`
+	Time   time.Time `json:"time"`
+	// block when a planblock starts, song or file when the next one starts playing,
+	// off when a block ends, error when the player ran into one
+	Type      string     `json:"type"`
+	Block     string     `json:"block,omitempty"`
+	BlockFrom *time.Time `json:"block_from,omitempty"`
+	BlockTo   *time.Time `json:"block_to,omitempty"`
+	SongId    int        `json:"song_id,omitempty"`
+	Authors   string     `json:"authors,omitempty"`
+	Title     string     `json:"title,omitempty"`
+	File      string     `json:"file,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+func blockEvent(plan database.PlanBlock) AircheckEvent {
+	block := plan.TypeName()
+	if plan.Type.Playlist.Active {
+		block += " " + plan.Type.Playlist.PlaylistId
+	}
+	return AircheckEvent{Type: "block", Block: block, BlockFrom: &plan.Range.Start, BlockTo: &plan.Range.End}
+}
+
+func songEvent(song *database.SongData) AircheckEvent {
+	return AircheckEvent{Type: "song", SongId: song.SongId, Authors: song.Authors, Title: song.Title}
+}
+
+func fileEvent(file string) AircheckEvent {
+	return AircheckEvent{Type: "file", File: file}
+}
+
+// what the log says about an event of the player
+func aircheckEvent(event Event) AircheckEvent {
+	var logged AircheckEvent
+	switch {
+	case event.Type == PlayerError:
+		logged = AircheckEvent{Type: "error", Error: event.Err.Error()}
+	case event.Type == BlockChanged && event.Plan == nil:
+		logged = AircheckEvent{Type: "off"}
+	case event.Type == BlockChanged:
+		logged = blockEvent(*event.Plan)
+	case event.Song != nil:
+		logged = songEvent(event.Song)
+	default:
+		logged = fileEvent(event.File)
+	}
+	logged.Time = event.Time
+	return logged
+}
+
+// either a chunk of the mix or an event, in the order they went to air
+type aircheckItem struct {
+	samples [][2]float64
+	event   *AircheckEvent
+}
+
+// a sink writing the mix to hourly files, along with what was on air when
+type aircheck struct {
+	dir      string
+	encoding *Encoding
+	items    chan aircheckItem
+	done     chan bool
+	// from the player, and closed once follow is done with them
+	events   chan Event
+	followed chan bool
+	// only touched by Write, from the driver
+	dropping bool
+
+	// the rest belongs to the goroutine in run
+	file    *os.File
+	buffer  *bufio.Writer
+	encoder Encoder
+	log     *os.File
+	name    string
+	start   time.Time
+	end     time.Time
+	samples int
+	retry   time.Time
+	// what's on air, repeated at the start of every file
+	block   *AircheckEvent
+	playing *AircheckEvent
+}
+
+// the name of the file being recorded to
+var (
+	recording     string
+	aircheckMutex sync.Mutex
+)
+
+func newAircheck(dir, format string) *aircheck {
+	a := &aircheck{
+		dir:      dir,
+		encoding: EncodingByName(format),
+		items:    make(chan aircheckItem, int(aircheckBuffer/outputChunk)),
+		done:     make(chan bool),
+		events:   player.Subscribe(),
+		followed: make(chan bool),
+	}
+	go a.run()
+	go a.follow()
+	return a
+}
+
+// puts what the player does in line with the audio, so it's logged at the offset it went to air
+func (a *aircheck) follow() {
+	defer close(a.followed)
+	for event := range a.events {
+		logged := aircheckEvent(event)
+		select {
+		case a.items <- aircheckItem{event: &logged}:
+		default:
+		}
+	}
+}
+
+// hands the chunk to the writer; the driver never waits for the disk
+func (a *aircheck) Write(samples [][2]float64) error {
+	chunk := make([][2]float64, len(samples))
+	copy(chunk, samples)
+	select {
+	case a.items <- aircheckItem{samples: chunk}:
+		a.dropping = false
+	default:
+		if !a.dropping {
+			log.Println("Aircheck can't keep up with the disk, dropping audio")
+		}
+		a.dropping = true
+	}
+	return nil
+}
+
+func (a *aircheck) Close() error {
+	player.Unsubscribe(a.events)
+	<-a.followed
+	close(a.items)
+	<-a.done
+	return nil
+}
+
+func (a *aircheck) run() {
+	defer close(a.done)
+	a.deleteExpired()
+	for item := range a.items {
+		if item.event != nil {
+			a.mark(*item.event)
+			continue
+		}
+		samples := item.samples
+		for len(samples) > 0 {
+			if a.file == nil && !a.open() {
+				break
+			}
+			// files end on the hour, to the sample
+			length := SampleRate.N(a.end.Sub(a.start))
+			n := length - a.samples
+			if n > len(samples) {
+				n = len(samples)
+			}
+			if err := a.encoder.Encode(a.buffer, samples[:n]); err != nil {
+				log.Printf("Couldn't write aircheck %s: %v\n", a.name, err)
+				a.finish()
+				a.retry = time.Now().Add(aircheckRetry)
+				break
+			}
+			a.samples += n
+			samples = samples[n:]
+			if a.samples >= length {
+				a.finish()
+				a.deleteExpired()
+			}
+		}
+	}
+	if a.file != nil {
+		a.finish()
+	}
+}
+
+// starts the next recording and its log, unless it failed a moment ago
+func (a *aircheck) open() bool {
+	now := time.Now()
+	if now.Before(a.retry) {
+		return false
+	}
+	name := now.Format(aircheckLayout)
+	file, err := os.Create(filepath.Join(a.dir, name+"."+a.encoding.Name))
+	if err != nil {
+		log.Printf("Couldn't start aircheck %s: %v\n", name, err)
+		a.retry = now.Add(aircheckRetry)
+		return false
+	}
+	logFile, err := os.Create(filepath.Join(a.dir, name+".jsonl"))
+	if err != nil {
+		log.Printf("Couldn't start aircheck %s: %v\n", name, err)
+		file.Close()
+		a.retry = now.Add(aircheckRetry)
+		return false
+	}
+
+	a.file, a.log, a.name = file, logFile, name
+	a.buffer = bufio.NewWriter(file)
+	a.encoder = a.encoding.New(OutputFormat())
+	a.start, a.samples = now, 0
+	a.end = time.Date(now.Year(), now.Month(), now.Day(), now.Hour()+1, 0, 0, 0, now.Location())
+
+	aircheckMutex.Lock()
+	recording = name
+	aircheckMutex.Unlock()
+	log.Println("Recording aircheck " + name)
+
+	// each log stands on its own
+	if a.block != nil {
+		a.write(*a.block)
+	}
+	if a.playing != nil {
+		a.write(*a.playing)
+	}
+	return true
+}
+
+func (a *aircheck) mark(event AircheckEvent) {
+	switch event.Type {
+	case "block":
+		a.block, a.playing = &event, nil
+	case "off":
+		a.block, a.playing = nil, nil
+	default:
+		a.playing = &event
+	}
+	if a.file != nil {
+		a.write(event)
+	}
+}
+
+func (a *aircheck) write(event AircheckEvent) {
+	event.Offset = SampleRate.D(a.samples).Milliseconds()
+	line, err := json.Marshal(event)
+	if err == nil {
+		_, err = a.log.Write(append(line, '\n'))
+	}
+	if err != nil {
+		log.Printf("Couldn't log to aircheck %s: %v\n", a.name, err)
+	}
+}
+
+// completes the current recording
+func (a *aircheck) finish() {
+	err := a.buffer.Flush()
+	if finisher, ok := a.encoder.(Finisher); ok && err == nil {
+		err = finisher.Finish(a.file)
+	}
+	if err != nil {
+		log.Printf("Couldn't complete aircheck %s: %v\n", a.name, err)
+	}
+	a.file.Close()
+	a.log.Close()
+	a.file, a.log = nil, nil
+
+	aircheckMutex.Lock()
+	recording = ""
+	aircheckMutex.Unlock()
+}
+
+// removes recordings and logs which started more than AircheckRetention ago
+func (a *aircheck) deleteExpired() {
+	if AircheckRetention == 0 {
+		return
+	}
+	files, err := ioutil.ReadDir(a.dir)
+	if err != nil {
+		log.Printf("Couldn't list airchecks: %v\n", err)
+		return
+	}
+	deleted := 0
+	for _, file := range files {
+		match := aircheckFile.FindStringSubmatch(file.Name())
+		if match == nil {
+			continue
+		}
+		start, err := time.ParseInLocation(aircheckLayout, match[1], time.Local)
+		if err != nil || time.Since(start) < AircheckRetention {
+			continue
+		}
+		if err := os.Remove(filepath.Join(a.dir, file.Name())); err != nil {
+			log.Printf("Couldn't delete aircheck %s: %v\n", file.Name(), err)
+			continue
+		}
+		deleted++
+	}
+	if deleted > 0 {
+		log.Printf("Deleted %d aircheck files older than %v\n", deleted, AircheckRetention)
+	}
+}
+
+// a recording and its log
+type Aircheck struct {
+	Name  string    `json:"name"`
+	Start time.Time `json:"start"`
+	// file names within AircheckDir, "" if missing
+	Audio string `json:"audio"`
+	Log   string `json:"log"`
+	// of the audio in bytes
+	Size int64 `json:"size"`
+	// whether it's still being written
+	Recording bool `json:"recording"`
+}
+
+// lists the recordings in AircheckDir, oldest first
+func Airchecks() ([]Aircheck, error) {
+	if AircheckDir == "" {
+		return []Aircheck{}, nil
+	}
+	files, err := ioutil.ReadDir(AircheckDir)
+	if err != nil {
+		return nil, err
+	}
+	aircheckMutex.Lock()
+	current := recording
+	aircheckMutex.Unlock()
+
+	byName := map[string]*Aircheck{}
+	airchecks := []Aircheck{}
+	for _, file := range files {
+		match := aircheckFile.FindStringSubmatch(file.Name())
+		if match == nil {
+			continue
+		}
+		aircheck := byName[match[1]]
+		if aircheck == nil {
+			start, _ := time.ParseInLocation(aircheckLayout, match[1], time.Local)
+			aircheck = &Aircheck{Name: match[1], Start: start, Recording: match[1] == current}
+			byName[match[1]] = aircheck
+		}
+		if match[2] == "jsonl" {
+			aircheck.Log = file.Name()
+		} else {
+			aircheck.Audio = file.Name()
+			aircheck.Size = file.Size()
+		}
+	}
+	for _, aircheck := range byName {
+		airchecks = append(airchecks, *aircheck)
+	}
+	sort.Slice(airchecks, func(i, j int) bool {
+		return airchecks[i].Name < airchecks[j].Name
+	})
+	return airchecks, nil
+}
+
+// opens a file of a recording by its name as Airchecks lists it
+func OpenAircheck(file string) (*os.File, error) {
+	if AircheckDir == "" || !aircheckFile.MatchString(file) {
+		return nil, ErrNoAircheck
+	}
+	f, err := os.Open(filepath.Join(AircheckDir, file))
+	if os.IsNotExist(err) {
+		return nil, ErrNoAircheck
+	}
+	return f, err
+}
+
+// copies a recording and its log into dir
+func CopyAircheck(name, dir string) error {
+	var aircheck *Aircheck
+	airchecks, err := Airchecks()
+	if err != nil {
+		return err
+	}
+	for i := range airchecks {
+		if airchecks[i].Name == name {
+			aircheck = &airchecks[i]
+		}
+	}
+	if aircheck == nil {
+		return ErrNoAircheck
+	}
+
+	for _, file := range []string{aircheck.Audio, aircheck.Log} {
+		if file == "" {
+			continue
+		}
+		if err := copyFile(filepath.Join(AircheckDir, file), filepath.Join(dir, file)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyFile(from, to string) error {
+	source, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	target, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(target, source); err != nil {
+		target.Close()
+		return err
+	}
+	return target.Close()
+}
+
+func HTTPGetAirchecks(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	airchecks, err := Airchecks()
+	if err != nil {
+		utils.SendErrorJSON(w, r, "Couldn't list the recordings")
+		log.Printf("Couldn't list airchecks: %v\n", err)
+		return
+	}
+	data, err := json.Marshal(airchecks)
+	if err != nil {
+		utils.SendErrorJSON(w, r, err.Error())
+		return
+	}
+	utils.SendJSON(w, r, data)
+}
+
+// ?file=<audio or log file name>, downloads it; ranges work, e.g. to seek in a player
+func HTTPGetAircheck(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	name := r.URL.Query().Get("file")
+	file, err := OpenAircheck(name)
+	if err == ErrNoAircheck {
+		utils.SendErrorJSON(w, r, "No recording "+name+" found")
+		return
+	}
+	if err != nil {
+		utils.SendErrorJSON(w, r, "Couldn't open the recording")
+		log.Printf("Couldn't open aircheck %s: %v\n", name, err)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		utils.SendErrorJSON(w, r, "Couldn't open the recording")
+		return
+	}
+
+	contentType := "application/x-ndjson"
+	if encoding := EncodingByName(strings.TrimPrefix(filepath.Ext(name), ".")); encoding != nil {
+		contentType = encoding.ContentType(OutputFormat())
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+name+"\"")
+	http.ServeContent(w, r, name, info.ModTime(), file)
+}
@@ -0,0 +1,80 @@
+package playback
+
+import (
+	"log"
+	"time"
+
+	"github.com/faiface/beep"
+
+	"radio/database"
+)
+
+// a track played from its cue in to its cue out, which tells the crossfader where its outro starts
+type cued struct {
+	beep.StreamSeeker
+	// in output samples from the start of the audio; out is 0 to play to the end
+	in, out, outro int
+}
+
+// plays the streamer, which must run at the output rate, between the song's cue points
+func Cue(streamer beep.StreamSeeker, song *database.SongData) beep.StreamSeeker {
+	if song == nil || song.Cues == nil {
+		return streamer
+	}
+	at := func(ms int) int {
+		return SampleRate.N(time.Duration(ms) * time.Millisecond)
+	}
+	c := &cued{StreamSeeker: streamer, in: at(song.Cues.CueIn), out: at(song.Cues.CueOut)}
+	if song.Cues.OutroStart != 0 {
+		c.outro = at(song.Cues.OutroStart)
+	}
+	if c.in >= c.end() {
+		log.Printf("Cues of song %d are past the end of its audio, playing all of it\n", song.SongId)
+		return streamer
+	}
+	if err := c.StreamSeeker.Seek(c.in); err != nil {
+		log.Printf("Couldn't cue song %d: %v\n", song.SongId, err)
+		return streamer
+	}
+	return c
+}
+
+// where playback stops in the source
+func (c *cued) end() int {
+	end := c.StreamSeeker.Len()
+	if c.out > 0 && c.out < end {
+		end = c.out
+	}
+	return end
+}
+
+func (c *cued) Stream(samples [][2]float64) (n int, ok bool) {
+	remaining := c.Len() - c.Position()
+	if remaining <= 0 {
+		return 0, false
+	}
+	if len(samples) > remaining {
+		samples = samples[:remaining]
+	}
+	return c.StreamSeeker.Stream(samples)
+}
+
+func (c *cued) Len() int {
+	return c.end() - c.in
+}
+
+func (c *cued) Position() int {
+	return c.StreamSeeker.Position() - c.in
+}
+
+func (c *cued) Seek(p int) error {
+	return c.StreamSeeker.Seek(p + c.in)
+}
+
+// where the transition to the next track begins, 0 if the song doesn't say
+func (c *cued) OutroStart() int {
+	if c.outro <= c.in || c.outro >= c.end() {
+		return 0
+	}
+	return c.outro - c.in
+}
@@ -0,0 +1,152 @@
+package playback
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/flac"
+	"github.com/faiface/beep/mp3"
+	"github.com/faiface/beep/wav"
+
+	"radio/database"
+)
+
+// an audio format the player can decode
+type Decoder struct {
+	Name string
+	// lower case, with the dot
+	Extensions []string
+	// recognises the format from the first bytes of a file
+	Sniff  func(header []byte) bool
+	Decode func(f *os.File) (beep.StreamSeekCloser, beep.Format, error)
+}
+
+// how much of a file is read to sniff its format
+const sniffLength = 12
+
+// in the order the files of a song are looked for
+var decoders = []Decoder{
+	{
+		Name:       "wav",
+		Extensions: []string{".wav"},
+		Sniff: func(header []byte) bool {
+			return len(header) >= 12 && string(header[:4]) == "RIFF" && string(header[8:12]) == "WAVE"
+		},
+		Decode: func(f *os.File) (beep.StreamSeekCloser, beep.Format, error) {
+			return wav.Decode(f)
+		},
+	},
+	{
+		Name:       "mp3",
+		Extensions: []string{".mp3"},
+		Sniff: func(header []byte) bool {
+			// an ID3v2 tag or straight away a frame sync
+			return bytes.HasPrefix(header, []byte("ID3")) || (len(header) >= 2 && header[0] == 0xff && header[1]&0xe0 == 0xe0)
+		},
+		Decode: func(f *os.File) (beep.StreamSeekCloser, beep.Format, error) {
+			return mp3.Decode(f)
+		},
+	},
+	{
+		Name:       "flac",
+		Extensions: []string{".flac"},
+		Sniff: func(header []byte) bool {
+			return bytes.HasPrefix(header, []byte("fLaC"))
+		},
+		Decode: func(f *os.File) (beep.StreamSeekCloser, beep.Format, error) {
+			return flac.Decode(f)
+		},
+	},
+	{
+		Name:       "ogg vorbis",
+		Extensions: []string{".ogg", ".oga"},
+		Sniff: func(header []byte) bool {
+			return bytes.HasPrefix(header, []byte("OggS"))
+		},
+		Decode: decodeVorbis,
+	},
+}
+
+// the file extensions of every format the player decodes
+func Extensions() []string {
+	var extensions []string
+	for _, decoder := range decoders {
+		extensions = append(extensions, decoder.Extensions...)
+	}
+	return extensions
+}
+
+// returns the decoder for files with the extension of name, or nil
+func DecoderByExtension(name string) *Decoder {
+	ext := strings.ToLower(filepath.Ext(name))
+	for i := range decoders {
+		for _, decoderExt := range decoders[i].Extensions {
+			if ext == decoderExt {
+				return &decoders[i]
+			}
+		}
+	}
+	return nil
+}
+
+// returns the decoder whose magic bytes header starts with, or nil
+func DecoderByContent(header []byte) *Decoder {
+	for i := range decoders {
+		if decoders[i].Sniff(header) {
+			return &decoders[i]
+		}
+	}
+	return nil
+}
+
+// returns the audio file of a song, or "" if its folder has none
+func SongFile(songid string) string {
+	for _, ext := range Extensions() {
+		file := filepath.Join(database.MusicDir, songid, "audio"+ext)
+		if _, err := os.Stat(file); err == nil {
+			return file
+		}
+	}
+	return ""
+}
+
+// decodes the file with the decoder its contents call for,
+// falling back on its extension when no magic bytes match
+func DecodeFile(loc string) (beep.StreamSeekCloser, beep.Format, error) {
+	f, err := os.Open(loc)
+	if err != nil {
+		return nil, beep.Format{}, err
+	}
+
+	header := make([]byte, sniffLength)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		f.Close()
+		return nil, beep.Format{}, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, beep.Format{}, err
+	}
+
+	decoder := DecoderByContent(header[:n])
+	if decoder == nil {
+		decoder = DecoderByExtension(loc)
+	}
+	if decoder == nil {
+		f.Close()
+		return nil, beep.Format{}, errors.New("'" + loc + "' isn't in a format the player decodes (" + strings.Join(Extensions(), ", ") + ")")
+	}
+
+	streamer, format, err := decoder.Decode(f)
+	if err != nil {
+		f.Close()
+		return nil, format, err
+	}
+	return streamer, format, nil
+}
@@ -0,0 +1,169 @@
+package playback
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/faiface/beep"
+)
+
+// turns the master mix into the bytes a listener receives. Encoders keep
+// state between calls, e.g. whether the header went out, so every listener gets its own.
+type Encoder interface {
+	// writes samples to w, preceded by a header on the first call if the format has one
+	Encode(w io.Writer, samples [][2]float64) error
+}
+
+// encoders whose output only gets complete at the end, like WAV sizes or FLAC's last
+// frame and checksum, implement this for files they wrote from the start
+type Finisher interface {
+	Finish(file io.WriteSeeker) error
+}
+
+// a format the station can be listened to in
+type Encoding struct {
+	Name        string
+	ContentType func(format beep.Format) string
+	New         func(format beep.Format) Encoder
+}
+
+// the first one is what /stream sends unless asked for another
+var encodings = []Encoding{
+	{
+		Name: "wav",
+		ContentType: func(format beep.Format) string {
+			return "audio/wav"
+		},
+		New: func(format beep.Format) Encoder {
+			return &pcmEncoder{format: format, order: binary.LittleEndian, header: wavHeader}
+		},
+	},
+	{
+		// 16 bit big endian samples as in RFC 2586
+		Name: "pcm",
+		ContentType: func(format beep.Format) string {
+			return fmt.Sprintf("audio/L16;rate=%d;channels=%d", format.SampleRate, format.NumChannels)
+		},
+		New: func(format beep.Format) Encoder {
+			return &pcmEncoder{format: format, order: binary.BigEndian}
+		},
+	},
+	{
+		Name: "flac",
+		ContentType: func(format beep.Format) string {
+			return "audio/flac"
+		},
+		New: newFLACEncoder,
+	},
+}
+
+// the names of every encoding
+func EncodingNames() []string {
+	var names []string
+	for _, encoding := range encodings {
+		names = append(names, encoding.Name)
+	}
+	return names
+}
+
+// returns the encoding called name, the default one for "", or nil
+func EncodingByName(name string) *Encoding {
+	if name == "" {
+		return &encodings[0]
+	}
+	for i := range encodings {
+		if encodings[i].Name == name {
+			return &encodings[i]
+		}
+	}
+	return nil
+}
+
+// writes 16 bit samples, after the header if there's one
+type pcmEncoder struct {
+	format  beep.Format
+	order   binary.ByteOrder
+	header  func(format beep.Format) []byte
+	started bool
+	buffer  []byte
+	// bytes of samples written
+	written int64
+}
+
+// clamps a sample to the 16 bit range
+func toInt16(x float64) int16 {
+	return int16(math.Max(-1, math.Min(1, x)) * math.MaxInt16)
+}
+
+func (e *pcmEncoder) Encode(w io.Writer, samples [][2]float64) error {
+	if !e.started && e.header != nil {
+		if _, err := w.Write(e.header(e.format)); err != nil {
+			return err
+		}
+	}
+	e.started = true
+
+	size := len(samples) * e.format.NumChannels * 2
+	if cap(e.buffer) < size {
+		e.buffer = make([]byte, size)
+	}
+	buffer := e.buffer[:size]
+	i := 0
+	for _, sample := range samples {
+		for c := 0; c < e.format.NumChannels; c++ {
+			x := math.Max(-1, math.Min(1, sample[c]))
+			e.order.PutUint16(buffer[i:], uint16(int16(x*math.MaxInt16)))
+			i += 2
+		}
+	}
+	_, err := w.Write(buffer)
+	e.written += int64(size)
+	return err
+}
+
+// puts the real sizes into the WAV header; raw PCM has nothing to finish
+func (e *pcmEncoder) Finish(file io.WriteSeeker) error {
+	// sizes past 4 GiB don't fit, players then read up to the end of the file
+	if e.header == nil || e.written+36 > math.MaxUint32 {
+		return nil
+	}
+	size := make([]byte, 4)
+	binary.LittleEndian.PutUint32(size, uint32(e.written+36))
+	if _, err := file.Seek(4, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := file.Write(size); err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint32(size, uint32(e.written))
+	if _, err := file.Seek(40, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := file.Write(size); err != nil {
+		return err
+	}
+	_, err := file.Seek(0, io.SeekEnd)
+	return err
+}
+
+// a WAV header for 16 bit samples; a stream has no end, so the sizes are as large as they go
+func wavHeader(format beep.Format) []byte {
+	channels := format.NumChannels
+	header := make([]byte, 44)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], math.MaxUint32)
+	copy(header[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16)
+	// PCM
+	binary.LittleEndian.PutUint16(header[20:], 1)
+	binary.LittleEndian.PutUint16(header[22:], uint16(channels))
+	binary.LittleEndian.PutUint32(header[24:], uint32(format.SampleRate))
+	binary.LittleEndian.PutUint32(header[28:], uint32(int(format.SampleRate)*channels*2))
+	binary.LittleEndian.PutUint16(header[32:], uint16(channels*2))
+	binary.LittleEndian.PutUint16(header[34:], 16)
+	copy(header[36:], "data")
+	binary.LittleEndian.PutUint32(header[40:], math.MaxUint32-36)
+	return header
+}
@@ -0,0 +1,410 @@
+package playback
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"hash"
+	"io"
+
+	"github.com/faiface/beep"
+)
+
+// a FLAC encoder with the fixed predictors and stereo decorrelation of the format,
+// which gets airchecks to around half the size of WAV without any C library
+
+// samples per channel in every frame but the last
+const flacBlockSize = 4096
+
+// the finest partitioning of residuals tried, in powers of two
+const maxPartitionOrder = 8
+
+// rice parameter 15 is the escape code
+const maxRiceParameter = 14
+
+// channel assignments in frame headers
+const (
+	flacIndependent = 1
+	flacLeftSide    = 8
+	flacSideRight   = 9
+	flacMidSide     = 10
+)
+
+// writes values MSB first
+type bitWriter struct {
+	data []byte
+	acc  uint64
+	bits uint
+}
+
+// n is at most 32
+func (b *bitWriter) write(value uint64, n uint) {
+	b.acc = b.acc<<n | value&(1<<n-1)
+	b.bits += n
+	for b.bits >= 8 {
+		b.bits -= 8
+		b.data = append(b.data, byte(b.acc>>b.bits))
+	}
+}
+
+func (b *bitWriter) writeSigned(value int64, n uint) {
+	b.write(uint64(value), n)
+}
+
+func (b *bitWriter) writeUnary(zeros uint64) {
+	for ; zeros >= 32; zeros -= 32 {
+		b.write(0, 32)
+	}
+	b.write(1, uint(zeros)+1)
+}
+
+func (b *bitWriter) align() {
+	if b.bits > 0 {
+		b.write(0, 8-b.bits)
+	}
+}
+
+// frame numbers in headers are coded like UTF-8, extended to 36 bits
+func (b *bitWriter) writeUTF8(value uint64) {
+	if value < 0x80 {
+		b.write(value, 8)
+		return
+	}
+	bytes := uint(2)
+	for value >= 1<<(5*bytes+1) && bytes < 7 {
+		bytes++
+	}
+	// leading ones for the length, then as many value bits as the first byte holds
+	lead := uint64(0xff) << (8 - bytes) & 0xff
+	if bytes == 7 {
+		lead = 0xfe
+	}
+	b.write(lead|value>>(6*(bytes-1)), 8)
+	for i := int(bytes) - 2; i >= 0; i-- {
+		b.write(0x80|value>>(6*uint(i))&0x3f, 8)
+	}
+}
+
+func crc8(data []byte) byte {
+	var crc byte
+	for _, x := range data {
+		crc ^= x
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x07
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+func crc16(data []byte) uint16 {
+	var crc uint16
+	for _, x := range data {
+		crc ^= uint16(x) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x8005
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// how a subframe gets coded, worked out before writing it
+type subframePlan struct {
+	samples []int32
+	// bits per sample, one more for side channels
+	bps uint
+	// -1 for a constant subframe, -2 for verbatim, or else the fixed predictor order
+	order          int
+	residuals      []int64
+	partitionOrder uint
+	parameters     []uint
+	// an estimate for the fixed predictors
+	bits uint64
+}
+
+func zigzag(r int64) uint64 {
+	return uint64(r<<1) ^ uint64(r>>63)
+}
+
+// residuals of the fixed predictor of order, for the samples after the first order ones
+func fixedResiduals(samples []int32, order int, residuals []int64) []int64 {
+	residuals = residuals[:0]
+	for i := order; i < len(samples); i++ {
+		x := func(back int) int64 {
+			return int64(samples[i-back])
+		}
+		var r int64
+		switch order {
+		case 0:
+			r = x(0)
+		case 1:
+			r = x(0) - x(1)
+		case 2:
+			r = x(0) - 2*x(1) + x(2)
+		case 3:
+			r = x(0) - 3*x(1) + 3*x(2) - x(3)
+		case 4:
+			r = x(0) - 4*x(1) + 6*x(2) - 4*x(3) + x(4)
+		}
+		residuals = append(residuals, r)
+	}
+	return residuals
+}
+
+// picks a rice parameter for count values adding up to sum, and the bits they'd take
+func riceParameter(sum uint64, count int) (uint, uint64) {
+	k := uint(0)
+	for k < maxRiceParameter && uint64(count)<<(k+1) < sum {
+		k++
+	}
+	return k, uint64(count)*uint64(k+1) + sum>>k
+}
+
+func planSubframe(samples []int32, bps uint) subframePlan {
+	constant := true
+	for _, x := range samples[1:] {
+		if x != samples[0] {
+			constant = false
+			break
+		}
+	}
+	if constant {
+		return subframePlan{samples: samples, bps: bps, order: -1, bits: uint64(bps)}
+	}
+
+	best := subframePlan{samples: samples, bps: bps, order: -2, bits: uint64(bps) * uint64(len(samples))}
+	n := len(samples)
+	var residuals []int64
+	for order := 0; order <= 4 && order < n; order++ {
+		residuals = fixedResiduals(samples, order, residuals)
+		for p := uint(0); p <= maxPartitionOrder; p++ {
+			if n%(1<<p) != 0 || n>>p <= order {
+				break
+			}
+			bits := uint64(order)*uint64(bps) + 6
+			parameters := make([]uint, 1<<p)
+			start := 0
+			for i := range parameters {
+				end := (i+1)*(n>>p) - order
+				var sum uint64
+				for _, r := range residuals[start:end] {
+					sum += zigzag(r)
+				}
+				k, partitionBits := riceParameter(sum, end-start)
+				parameters[i] = k
+				bits += 4 + partitionBits
+				start = end
+			}
+			if bits < best.bits {
+				best = subframePlan{
+					samples:        samples,
+					bps:            bps,
+					order:          order,
+					residuals:      append([]int64{}, residuals...),
+					partitionOrder: p,
+					parameters:     parameters,
+					bits:           bits,
+				}
+			}
+		}
+	}
+	return best
+}
+
+func (plan *subframePlan) write(b *bitWriter) {
+	switch plan.order {
+	case -1:
+		b.write(0, 8)
+		b.writeSigned(int64(plan.samples[0]), plan.bps)
+	case -2:
+		b.write(1<<1, 8)
+		for _, x := range plan.samples {
+			b.writeSigned(int64(x), plan.bps)
+		}
+	default:
+		b.write(uint64(8+plan.order)<<1, 8)
+		for _, x := range plan.samples[:plan.order] {
+			b.writeSigned(int64(x), plan.bps)
+		}
+		// rice coding with 4 bit parameters
+		b.write(0, 2)
+		b.write(uint64(plan.partitionOrder), 4)
+		n := len(plan.samples)
+		start := 0
+		for i, k := range plan.parameters {
+			end := (i+1)*(n>>plan.partitionOrder) - plan.order
+			b.write(uint64(k), 4)
+			for _, r := range plan.residuals[start:end] {
+				u := zigzag(r)
+				b.writeUnary(u >> k)
+				if k > 0 {
+					b.write(u, k)
+				}
+			}
+			start = end
+		}
+	}
+}
+
+type flacEncoder struct {
+	format  beep.Format
+	started bool
+	// samples waiting for a full block, one slice per channel
+	pending [][]int32
+	frame   uint64
+	// per channel
+	samples uint64
+	md5     hash.Hash
+}
+
+func newFLACEncoder(format beep.Format) Encoder {
+	return &flacEncoder{format: format, pending: make([][]int32, format.NumChannels), md5: md5.New()}
+}
+
+// the first metadata block, STREAMINFO, starts here
+const flacStreamInfo = 8
+
+// "fLaC" and a STREAMINFO block without length and checksum, which Finish fills in
+func (e *flacEncoder) header() []byte {
+	header := make([]byte, flacStreamInfo+34)
+	copy(header, "fLaC")
+	// last metadata block, type 0, 34 bytes long
+	binary.BigEndian.PutUint32(header[4:], 1<<31|34)
+	binary.BigEndian.PutUint16(header[flacStreamInfo:], flacBlockSize)
+	binary.BigEndian.PutUint16(header[flacStreamInfo+2:], flacBlockSize)
+	binary.BigEndian.PutUint64(header[flacStreamInfo+10:], e.streamInfo())
+	return header
+}
+
+// sample rate, channels, bits per sample and length packed into 64 bits
+func (e *flacEncoder) streamInfo() uint64 {
+	return uint64(e.format.SampleRate)<<44 | uint64(e.format.NumChannels-1)<<41 | 15<<36 | e.samples&(1<<36-1)
+}
+
+func (e *flacEncoder) Encode(w io.Writer, samples [][2]float64) error {
+	if !e.started {
+		if _, err := w.Write(e.header()); err != nil {
+			return err
+		}
+		e.started = true
+	}
+
+	raw := make([]byte, 2)
+	for _, sample := range samples {
+		for c := range e.pending {
+			x := toInt16(sample[c])
+			e.pending[c] = append(e.pending[c], int32(x))
+			binary.LittleEndian.PutUint16(raw, uint16(x))
+			e.md5.Write(raw)
+		}
+	}
+	for len(e.pending[0]) >= flacBlockSize {
+		if err := e.writeFrame(w, flacBlockSize); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodes the first n pending samples of every channel as a frame
+func (e *flacEncoder) writeFrame(w io.Writer, n int) error {
+	var plans []subframePlan
+	assignment := flacIndependent
+	if len(e.pending) == 2 {
+		left, right := e.pending[0][:n], e.pending[1][:n]
+		mid := make([]int32, n)
+		side := make([]int32, n)
+		for i := range left {
+			mid[i] = (left[i] + right[i]) >> 1
+			side[i] = left[i] - right[i]
+		}
+		l, r := planSubframe(left, 16), planSubframe(right, 16)
+		m, s := planSubframe(mid, 16), planSubframe(side, 17)
+		plans = []subframePlan{l, r}
+		bits := l.bits + r.bits
+		if l.bits+s.bits < bits {
+			plans, bits, assignment = []subframePlan{l, s}, l.bits+s.bits, flacLeftSide
+		}
+		if s.bits+r.bits < bits {
+			plans, bits, assignment = []subframePlan{s, r}, s.bits+r.bits, flacSideRight
+		}
+		if m.bits+s.bits < bits {
+			plans, assignment = []subframePlan{m, s}, flacMidSide
+		}
+	} else {
+		for c := range e.pending {
+			plans = append(plans, planSubframe(e.pending[c][:n], 16))
+		}
+		assignment = len(e.pending) - 1
+	}
+
+	b := &bitWriter{}
+	b.write(0x3ffe, 14)
+	// reserved, then a fixed block size
+	b.write(0, 2)
+	if n == flacBlockSize {
+		// 256 * 2^(12-8)
+		b.write(12, 4)
+	} else {
+		// read from the end of the header
+		b.write(7, 4)
+	}
+	// the sample rate is in STREAMINFO
+	b.write(0, 4)
+	b.write(uint64(assignment), 4)
+	// 16 bits per sample, then a reserved bit
+	b.write(4<<1, 4)
+	b.writeUTF8(e.frame)
+	if n != flacBlockSize {
+		b.write(uint64(n-1), 16)
+	}
+	b.write(uint64(crc8(b.data)), 8)
+
+	for i := range plans {
+		plans[i].write(b)
+	}
+	b.align()
+	crc := crc16(b.data)
+	b.write(uint64(crc), 16)
+
+	if _, err := w.Write(b.data); err != nil {
+		return err
+	}
+	e.frame++
+	e.samples += uint64(n)
+	for c := range e.pending {
+		e.pending[c] = append(e.pending[c][:0], e.pending[c][n:]...)
+	}
+	return nil
+}
+
+// writes what's left as a last, shorter frame and fills in the length and checksum;
+// the file must have been written by this encoder from its start
+func (e *flacEncoder) Finish(file io.WriteSeeker) error {
+	if !e.started {
+		return nil
+	}
+	if n := len(e.pending[0]); n > 0 {
+		if err := e.writeFrame(file, n); err != nil {
+			return err
+		}
+	}
+
+	info := make([]byte, 8+md5.Size)
+	binary.BigEndian.PutUint64(info, e.streamInfo())
+	copy(info[8:], e.md5.Sum(nil))
+	if _, err := file.Seek(flacStreamInfo+10, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := file.Write(info); err != nil {
+		return err
+	}
+	_, err := file.Seek(0, io.SeekEnd)
+	return err
+}
@@ -0,0 +1,234 @@
+package playback
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/flac"
+)
+
+func TestCRC(t *testing.T) {
+	// the check values of CRC-8 and CRC-16/UMTS
+	check := []byte("123456789")
+	if got := crc8(check); got != 0xf4 {
+		t.Errorf("crc8 = %#x, want 0xf4", got)
+	}
+	if got := crc16(check); got != 0xfee8 {
+		t.Errorf("crc16 = %#x, want 0xfee8", got)
+	}
+}
+
+func TestWriteUTF8(t *testing.T) {
+	tests := []struct {
+		value uint64
+		want  []byte
+	}{
+		{0, []byte{0x00}},
+		{0x7f, []byte{0x7f}},
+		{0x80, []byte{0xc2, 0x80}},
+		{0x7ff, []byte{0xdf, 0xbf}},
+		{0x800, []byte{0xe0, 0xa0, 0x80}},
+		{0xffff, []byte{0xef, 0xbf, 0xbf}},
+		{0x10000, []byte{0xf0, 0x90, 0x80, 0x80}},
+		{0x7fffffff, []byte{0xfd, 0xbf, 0xbf, 0xbf, 0xbf, 0xbf}},
+		{0x80000000, []byte{0xfe, 0x82, 0x80, 0x80, 0x80, 0x80, 0x80}},
+		{1<<36 - 1, []byte{0xfe, 0xbf, 0xbf, 0xbf, 0xbf, 0xbf, 0xbf}},
+	}
+
+	for _, tt := range tests {
+		b := &bitWriter{}
+		b.writeUTF8(tt.value)
+		if !bytes.Equal(b.data, tt.want) || b.bits != 0 {
+			t.Errorf("writeUTF8(%#x) = % x, want % x", tt.value, b.data, tt.want)
+		}
+	}
+}
+
+func TestBitWriter(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(b *bitWriter)
+		want  []byte
+	}{
+		{"whole bytes", func(b *bitWriter) { b.write(0xabcd, 16) }, []byte{0xab, 0xcd}},
+		{"masked", func(b *bitWriter) { b.write(0xff, 4); b.write(0, 4) }, []byte{0xf0}},
+		{"signed", func(b *bitWriter) { b.writeSigned(-1, 3); b.writeSigned(2, 5) }, []byte{0xe2}},
+		{"unary", func(b *bitWriter) { b.writeUnary(3); b.align() }, []byte{0x10}},
+		{"long unary", func(b *bitWriter) { b.writeUnary(39) }, []byte{0, 0, 0, 0, 0x01}},
+		{"aligned", func(b *bitWriter) { b.write(1, 1); b.align() }, []byte{0x80}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &bitWriter{}
+			tt.write(b)
+			if !bytes.Equal(b.data, tt.want) || b.bits != 0 {
+				t.Errorf("wrote % x and %d bits, want % x", b.data, b.bits, tt.want)
+			}
+		})
+	}
+}
+
+func TestZigzag(t *testing.T) {
+	tests := []struct {
+		r    int64
+		want uint64
+	}{
+		{0, 0}, {-1, 1}, {1, 2}, {-2, 3}, {2, 4}, {-65536, 131071},
+	}
+
+	for _, tt := range tests {
+		if got := zigzag(tt.r); got != tt.want {
+			t.Errorf("zigzag(%d) = %d, want %d", tt.r, got, tt.want)
+		}
+	}
+}
+
+func TestPlanSubframe(t *testing.T) {
+	ramp := make([]int32, 64)
+	noise := make([]int32, 64)
+	random := rand.New(rand.NewSource(1))
+	for i := range ramp {
+		ramp[i] = int32(100 * i)
+		noise[i] = int32(random.Intn(1<<16) - 1<<15)
+	}
+
+	tests := []struct {
+		name    string
+		samples []int32
+		want    int
+	}{
+		{"constant", []int32{7, 7, 7, 7}, -1},
+		{"ramp", ramp, 2},
+		{"noise", noise, -2},
+	}
+
+	for _, tt := range tests {
+		if got := planSubframe(tt.samples, 16).order; got != tt.want {
+			t.Errorf("%s: order = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+// encodes samples to a temporary file and decodes them again
+func TestFLACRoundTrip(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	sine := func(i int) float64 {
+		return 0.8 * math.Sin(float64(i)*2*math.Pi*440/44100)
+	}
+
+	tests := []struct {
+		name     string
+		channels int
+		length   int
+		sample   func(i int) [2]float64
+	}{
+		{"silence", 2, 1000, func(i int) [2]float64 { return [2]float64{} }},
+		{"same channels", 2, flacBlockSize, func(i int) [2]float64 { return [2]float64{sine(i), sine(i)} }},
+		{"close channels", 2, 3*flacBlockSize + 17, func(i int) [2]float64 { return [2]float64{sine(i), sine(i+3) * 0.9} }},
+		// mid/side coding
+		{"mirrored channels", 2, 5000, func(i int) [2]float64 {
+			return [2]float64{0.5 + sine(i)/3, 0.5 - sine(i)/3 + float64(i%3)/math.MaxInt16}
+		}},
+		{"loud channels", 2, 2000, func(i int) [2]float64 { return [2]float64{1, -1} }},
+		{"noise", 2, flacBlockSize + 1, func(i int) [2]float64 {
+			return [2]float64{random.Float64()*2 - 1, random.Float64()*2 - 1}
+		}},
+		{"mono", 1, 5000, func(i int) [2]float64 { return [2]float64{sine(i), sine(i)} }},
+		// frame numbers from 128 on take two bytes
+		{"many frames", 2, 130 * flacBlockSize, func(i int) [2]float64 { return [2]float64{sine(i), sine(i * 2)} }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format := beep.Format{SampleRate: 44100, NumChannels: tt.channels, Precision: 2}
+			samples := make([][2]float64, tt.length)
+			for i := range samples {
+				samples[i] = tt.sample(i)
+			}
+
+			file, err := ioutil.TempFile("", "flac")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(file.Name())
+			defer file.Close()
+
+			encoder := newFLACEncoder(format).(*flacEncoder)
+			// in uneven chunks, as the aircheck hands them over
+			for start := 0; start < len(samples); start += 1500 {
+				end := start + 1500
+				if end > len(samples) {
+					end = len(samples)
+				}
+				if err := encoder.Encode(file, samples[start:end]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := encoder.Finish(file); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := ioutil.ReadFile(file.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			sum := md5.New()
+			raw := make([]byte, 2)
+			for _, sample := range samples {
+				for c := 0; c < tt.channels; c++ {
+					binary.LittleEndian.PutUint16(raw, uint16(toInt16(sample[c])))
+					sum.Write(raw)
+				}
+			}
+			if got := data[flacStreamInfo+18 : flacStreamInfo+34]; !bytes.Equal(got, sum.Sum(nil)) {
+				t.Errorf("STREAMINFO MD5 = %x, want %x", got, sum.Sum(nil))
+			}
+
+			stream, decoded, err := flac.Decode(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer stream.Close()
+			if decoded.SampleRate != format.SampleRate || decoded.NumChannels != format.NumChannels || decoded.Precision != 2 {
+				t.Errorf("format = %+v, want %+v", decoded, format)
+			}
+			if stream.Len() != len(samples) {
+				t.Errorf("length = %d, want %d", stream.Len(), len(samples))
+			}
+
+			got := make([][2]float64, len(samples)+1)
+			n := 0
+			for n < len(got) {
+				read, ok := stream.Stream(got[n:])
+				n += read
+				if !ok {
+					break
+				}
+			}
+			// the decoder keeps the io.EOF of the last frame
+			if err := stream.Err(); err != nil && err != io.EOF {
+				t.Fatal(err)
+			}
+			if n != len(samples) {
+				t.Fatalf("decoded %d samples, want %d", n, len(samples))
+			}
+			for i := range samples {
+				for c := 0; c < tt.channels; c++ {
+					want := toInt16(samples[i][c])
+					if x := int16(math.Round(got[i][c] * 32768)); x != want {
+						t.Fatalf("sample %d of channel %d = %d, want %d", i, c, x, want)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package playback
+
+import (
+	"errors"
+	"math"
+
+	"github.com/faiface/beep"
+
+	"radio/database"
+)
+
+// the integrated loudness songs are brought to, in LUFS; 0 plays them as they are
+var TargetLoudness = -16.0
+
+// the gain is held down so true peaks stay under this, in dBTP
+const peakCeiling = -1.0
+
+// quiet songs are raised by at most this many dB
+const maxBoost = 12.0
+
+func SetTargetLoudness(lufs float64) error {
+	if lufs != 0 && (lufs < -40 || lufs > -5) {
+		return errors.New("target loudness must be between -40 and -5 LUFS, or 0 to turn normalisation off")
+	}
+	TargetLoudness = lufs
+	return nil
+}
+
+// returns the gain in dB which brings the song to the target loudness, 0 if it hasn't been analysed
+func TrackGain(song *database.SongData) float64 {
+	if TargetLoudness == 0 || song == nil || song.Loudness == nil {
+		return 0
+	}
+	gain := TargetLoudness - song.Loudness.Integrated
+	gain = math.Min(gain, peakCeiling-song.Loudness.TruePeak)
+	return math.Min(gain, maxBoost)
+}
+
+// a track played at a fixed gain, which still knows its length and can seek
+type gained struct {
+	beep.StreamSeeker
+	factor float64
+}
+
+func (g *gained) Stream(samples [][2]float64) (n int, ok bool) {
+	n, ok = g.StreamSeeker.Stream(samples)
+	for i := range samples[:n] {
+		samples[i][0] *= g.factor
+		samples[i][1] *= g.factor
+	}
+	return n, ok
+}
+
+// applies the song's track gain
+func Normalize(streamer beep.StreamSeeker, song *database.SongData) beep.StreamSeeker {
+	gain := TrackGain(song)
+	if gain == 0 {
+		return streamer
+	}
+	return &gained{StreamSeeker: streamer, factor: math.Pow(10, gain/20)}
+}
@@ -0,0 +1,529 @@
+package playback
+
+import (
+	"errors"
+	"log"
+	"math"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"radio/database"
+	"radio/fading"
+
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/effects"
+)
+
+// how often the player looks at the clock and at what the crossfader is playing
+const playerTick = 250 * time.Millisecond
+
+// songs crossfade over this long, and a block fades out over it before its end
+const crossfade = 5 * time.Second
+
+// what the player reports as it goes
+type EventType string
+
+const (
+	TrackStarted EventType = "track_started"
+	BlockChanged EventType = "block_changed"
+	PlayerError  EventType = "error"
+)
+
+type Event struct {
+	Type EventType
+	Time time.Time
+	// the block on air and its position in the schedule; -1 and nil between blocks
+	Block int
+	Plan  *database.PlanBlock
+	// for TrackStarted, the song of a playlist block or the file of a file block
+	Song *database.SongData
+	File string
+	// for PlayerError
+	Err error
+}
+
+// events wait this many deep for a subscriber, which misses them beyond that
+const eventBuffer = 64
+
+// a block played out of its slot by JumpToBlock, in [start, end)
+type blockJump struct {
+	index      int
+	start, end time.Time
+}
+
+// plays the schedule block due at the time, and takes the transport controls.
+// All of its state belongs to the goroutine in run, which commands reach over a
+// channel; the audio thread only shares the master mix and the crossfader with it,
+// under masterMutex.
+type Player struct {
+	commands chan func()
+
+	subscribersMutex sync.Mutex
+	subscribers      map[chan Event]bool
+
+	// today's schedule as planned, and its date
+	schedule database.Schedule
+	date     string
+	// the jump in effect, which takes precedence over the schedule until it ends
+	jump *blockJump
+	// the block on air and its position in schedule, -1 between blocks; the plan
+	// has the times of the jump if jumped is set
+	block  int
+	plan   *database.PlanBlock
+	jumped bool
+	// what the block plays, and where each track is in the playlist's queue or the block's
+	// files, which differ from the crossfader's by the tracks that couldn't be decoded
+	streamer  *fading.OwnStreamer
+	ctrl      *beep.Ctrl
+	volume    *effects.Volume
+	queue     []*database.SongData
+	files     []string
+	positions []int
+	// the fader of the track last reported as started
+	fader *fading.Fader
+	// set once the block fades out before its end
+	ending bool
+	// where the last playlist block left off, so a block of the same playlist right after it goes on from there
+	resumePlaylist int
+	resumeAt       int
+	// set by the DJs and kept for the blocks that follow
+	paused bool
+	gain   float64
+
+	// [playlistId][queueIndex] = songid; refreshed from console and HTTP goroutines
+	queuesMutex sync.Mutex
+	queues      map[int][]int
+}
+
+var player *Player
+
+func startPlayer() {
+	if player != nil {
+		return
+	}
+	player = &Player{
+		commands:       make(chan func()),
+		subscribers:    map[chan Event]bool{},
+		queues:         map[int][]int{},
+		block:          -1,
+		resumePlaylist: -1,
+	}
+	go player.run()
+}
+
+func (p *Player) run() {
+	ticker := time.NewTicker(playerTick)
+	for {
+		select {
+		case command := <-p.commands:
+			command()
+		case <-ticker.C:
+		}
+		p.update()
+	}
+}
+
+// runs command on the player's goroutine and waits for it
+func (p *Player) do(command func()) {
+	done := make(chan bool)
+	p.commands <- func() {
+		command()
+		close(done)
+	}
+	<-done
+}
+
+// returns a channel of everything the player does from now on, until Unsubscribe;
+// events it isn't quick enough to take are dropped
+func (p *Player) Subscribe() chan Event {
+	events := make(chan Event, eventBuffer)
+	p.subscribersMutex.Lock()
+	p.subscribers[events] = true
+	p.subscribersMutex.Unlock()
+	return events
+}
+
+func (p *Player) Unsubscribe(events chan Event) {
+	p.subscribersMutex.Lock()
+	defer p.subscribersMutex.Unlock()
+	if p.subscribers[events] {
+		delete(p.subscribers, events)
+		close(events)
+	}
+}
+
+func (p *Player) emit(event Event) {
+	event.Time = time.Now()
+	p.subscribersMutex.Lock()
+	defer p.subscribersMutex.Unlock()
+	for events := range p.subscribers {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
+
+func (p *Player) fail(err error) {
+	log.Println(err)
+	p.emit(Event{Type: PlayerError, Block: p.block, Plan: p.plan, Err: err})
+}
+
+// puts the block due now on air and reports the tracks starting in it
+func (p *Player) update() {
+	now := time.Now()
+	if p.date != "" && p.date != now.Format("2006-01-02") {
+		// a new day
+		p.loadSchedule()
+	}
+
+	due, jumped := p.dueBlock(now)
+	if due != p.block || jumped != p.jumped {
+		p.endBlock()
+		p.startBlock(due, jumped)
+	}
+	if p.plan == nil {
+		return
+	}
+
+	masterMutex.Lock()
+	if p.streamer != nil && !p.ending && now.After(p.plan.Range.End.Add(-crossfade)) {
+		p.ending = true
+		p.streamer.FadeOut()
+	}
+	fader := fading.CurFader
+	masterMutex.Unlock()
+
+	if fader == nil || fader == p.fader || !p.owns(fader) {
+		return
+	}
+	p.fader = fader
+	event := Event{Type: TrackStarted, Block: p.block, Plan: p.plan}
+	if p.plan.Type.Playlist.Active {
+		event.Song = p.queue[fader.Id]
+		log.Println(event.Song.Authors + " - " + event.Song.Title + " (" + event.Song.ReleaseDate.Format("2006-01-02") + ")")
+	} else {
+		event.File = p.files[fader.Id]
+		log.Println("Now playing: " + event.File)
+	}
+	p.emit(event)
+}
+
+// the block to be on air at now: the one jumped to while the jump lasts,
+// or else the first one whose slot now is in
+func (p *Player) dueBlock(now time.Time) (int, bool) {
+	if p.jump != nil {
+		if now.Before(p.jump.end) {
+			return p.jump.index, true
+		}
+		p.jump = nil
+	}
+	for index, plan := range p.schedule {
+		if !now.Before(plan.Range.Start) && now.Before(plan.Range.End) {
+			return index, false
+		}
+	}
+	return -1, false
+}
+
+// whether the fader is one of the block's, rather than left over from the one before
+func (p *Player) owns(fader *fading.Fader) bool {
+	return p.streamer != nil && fader.Id < len(p.streamer.Faders) && p.streamer.Faders[fader.Id] == fader
+}
+
+func (p *Player) startBlock(index int, jumped bool) {
+	p.block, p.plan, p.jumped = index, nil, jumped
+	if index < 0 {
+		p.emit(Event{Type: BlockChanged, Block: -1})
+		return
+	}
+	plan := p.schedule[index]
+	if jumped {
+		plan.Range.Start, plan.Range.End = p.jump.start, p.jump.end
+	}
+	p.plan = &plan
+	p.emit(Event{Type: BlockChanged, Block: index, Plan: p.plan})
+
+	var streamers []beep.StreamSeeker
+	resumeAt := 0
+	if plan.Type.Playlist.Active {
+		log.Println("Start playback of playlist " + plan.Type.Playlist.PlaylistId)
+		id, err := strconv.Atoi(plan.Type.Playlist.PlaylistId)
+		if err != nil {
+			p.fail(errors.New("Block " + strconv.Itoa(index) + " has no valid playlist id"))
+		} else {
+			if id == p.resumePlaylist {
+				resumeAt = p.resumeAt
+			}
+			streamers = p.playlistStreamers(id, resumeAt)
+		}
+	} else if plan.Type.File.Active {
+		streamers = p.fileStreamers(plan.Type.File.Location)
+	}
+	p.resumePlaylist = -1
+
+	if len(streamers) == 0 {
+		if !plan.Type.Silence.Active {
+			p.fail(errors.New("Nothing to play in block " + strconv.Itoa(index)))
+		}
+		return
+	}
+
+	masterMutex.Lock()
+	defer masterMutex.Unlock()
+	fading.Release()
+	fading.CurFader = nil
+	p.streamer = fading.CrossfadeStream(OutputFormat(), &fading.Options{TimeSpan: crossfade, Volume: 1}, streamers...)
+	p.ctrl = &beep.Ctrl{Streamer: p.streamer, Paused: p.paused}
+	p.volume = &effects.Volume{Streamer: p.ctrl, Base: 2}
+	setGain(p.volume, p.gain)
+	master.Add(p.volume)
+}
+
+func (p *Player) Queue(playlistid int) []int {
+	p.queuesMutex.Lock()
+	defer p.queuesMutex.Unlock()
+	return p.queues[playlistid]
+}
+
+func (p *Player) RefreshQueue(playlistid string) {
+	id, err := strconv.Atoi(playlistid)
+	if err != nil {
+		return
+	}
+	queue := database.CreateQueue(playlistid)
+
+	p.queuesMutex.Lock()
+	p.queues[id] = queue
+	p.queuesMutex.Unlock()
+}
+
+// decodes the playlist's queue from its from'th song
+func (p *Player) playlistStreamers(id, from int) []beep.StreamSeeker {
+	songids := p.Queue(id)
+	if from >= len(songids) {
+		from = 0
+	}
+
+	var streamers []beep.StreamSeeker
+	p.queue, p.positions = nil, nil
+	for position := from; position < len(songids); position++ {
+		songid := songids[position]
+		idstr := strconv.Itoa(songid)
+		song, form, err := GetSongFormat(idstr)
+		if err != nil {
+			p.fail(errors.New("Skipping song " + idstr + ": " + err.Error()))
+			continue
+		}
+		dbsong := database.GetSongData(idstr)
+		// the song was deleted after the queue had been generated
+		if dbsong == nil {
+			song.Close()
+			continue
+		}
+
+		streamers = append(streamers, Cue(Normalize(Conform(song, form), dbsong), dbsong))
+		p.queue = append(p.queue, dbsong)
+		p.positions = append(p.positions, position)
+	}
+	return streamers
+}
+
+func (p *Player) fileStreamers(files []string) []beep.StreamSeeker {
+	var streamers []beep.StreamSeeker
+	p.files, p.positions = nil, nil
+	for position, file := range files {
+		song, form := GetFileStreamer(file)
+		if song == nil {
+			p.fail(errors.New("Skipping file " + file))
+			continue
+		}
+		streamers = append(streamers, Conform(song, *form))
+		p.files = append(p.files, file)
+		p.positions = append(p.positions, position)
+	}
+	return streamers
+}
+
+// takes the block off air; a playlist block remembers where it was
+func (p *Player) endBlock() {
+	if p.plan == nil {
+		return
+	}
+	if p.plan.Type.Playlist.Active {
+		log.Println("End playback of playlist " + p.plan.Type.Playlist.PlaylistId)
+		if id, err := strconv.Atoi(p.plan.Type.Playlist.PlaylistId); err == nil && p.fader != nil {
+			// the song that was cut off starts over
+			p.resumePlaylist, p.resumeAt = id, p.positions[p.fader.Id]
+		}
+	}
+
+	masterMutex.Lock()
+	master.Clear()
+	fading.Release()
+	fading.CurFader = nil
+	masterMutex.Unlock()
+
+	p.block, p.plan, p.jumped = -1, nil, false
+	p.streamer, p.ctrl, p.volume = nil, nil, nil
+	p.queue, p.files, p.positions = nil, nil, nil
+	p.fader, p.ending = nil, false
+}
+
+func (p *Player) loadSchedule() {
+	now := time.Now()
+	p.date = now.Format("2006-01-02")
+	schedule := database.GetScheduleFor(p.date)
+	if schedule == nil {
+		log.Println("No schedule planned for today!")
+	} else {
+		log.Println("Starting schedule")
+	}
+
+	// the block on air plays on if the change left it as it was, and so does a jump
+	if p.jump != nil && !sameBlock(schedule, p.schedule, p.jump.index) {
+		p.jump = nil
+	}
+	if p.block >= 0 && !sameBlock(schedule, p.schedule, p.block) {
+		p.endBlock()
+	}
+	p.schedule = schedule
+}
+
+func sameBlock(schedule, old database.Schedule, index int) bool {
+	return index < len(schedule) && index < len(old) && reflect.DeepEqual(schedule[index], old[index])
+}
+
+// plays today's schedule, from scratch or again after it changed
+func (p *Player) LoadSchedule() {
+	p.do(p.loadSchedule)
+}
+
+func (p *Player) NowPlaying() NowPlaying {
+	var state NowPlaying
+	p.do(func() {
+		state = p.nowPlaying()
+	})
+	return state
+}
+
+func (p *Player) nowPlaying() NowPlaying {
+	state := NowPlaying{Paused: p.paused, Volume: p.gain, Block: p.block, Plan: p.plan}
+	if p.streamer == nil {
+		return state
+	}
+
+	masterMutex.Lock()
+	defer masterMutex.Unlock()
+	// until the first song starts streaming, it's the one about to
+	track := 0
+	position := 0
+	if fader := fading.CurFader; fader != nil && p.owns(fader) {
+		track, position = fader.Id, fader.Position()
+	}
+	state.Track = p.positions[track]
+	if p.plan.Type.Playlist.Active {
+		state.Song = p.queue[track]
+	} else {
+		state.File = p.files[track]
+	}
+	rate := OutputFormat().SampleRate
+	state.Elapsed = int(rate.D(position).Milliseconds())
+	state.Length = int(rate.D(int(p.streamer.Faders[track].AudioLength)).Milliseconds())
+	return state
+}
+
+// crossfades into the next song of the block
+func (p *Player) Skip() error {
+	var err error
+	p.do(func() {
+		masterMutex.Lock()
+		defer masterMutex.Unlock()
+		if p.streamer == nil {
+			err = ErrNothingPlaying
+		} else if p.streamer.Skip() != nil {
+			err = ErrLastSong
+		}
+	})
+	return err
+}
+
+// pauses or resumes the station; a pause holds across blocks until resumed
+func (p *Player) SetPaused(pause bool) {
+	p.do(func() {
+		p.paused = pause
+		if p.ctrl != nil {
+			masterMutex.Lock()
+			p.ctrl.Paused = pause
+			masterMutex.Unlock()
+		}
+	})
+}
+
+// sets the master volume in dB, from MinVolume (muted) to MaxVolume
+func (p *Player) SetVolume(db float64) error {
+	if math.IsNaN(db) || db < MinVolume || db > MaxVolume {
+		return errors.New("volume must be between " + formatDB(MinVolume) + " and " + formatDB(MaxVolume) + " dB")
+	}
+	p.do(func() {
+		p.gain = db
+		if p.volume != nil {
+			masterMutex.Lock()
+			setGain(p.volume, db)
+			masterMutex.Unlock()
+		}
+	})
+	return nil
+}
+
+// plays the block on air from its first song
+func (p *Player) RestartBlock() error {
+	var err error
+	p.do(func() {
+		if p.block < 0 {
+			err = ErrNothingPlaying
+			return
+		}
+		index, jumped := p.block, p.jumped
+		p.endBlock()
+		p.resumePlaylist = -1
+		p.startBlock(index, jumped)
+	})
+	return err
+}
+
+// plays the block at index of today's schedule now, in place of the block on air and
+// until that one would have ended; between blocks, for as long as the block lasts
+// but no further than the start of the next one. The schedule is left as it is, so
+// the block still plays in its own slot later on.
+func (p *Player) JumpToBlock(index int) error {
+	var err error
+	p.do(func() {
+		if index < 0 || index >= len(p.schedule) {
+			err = ErrNoBlock
+			return
+		}
+		now := time.Now()
+		jump := p.schedule[index]
+
+		until := now.Add(jump.Range.End.Sub(jump.Range.Start))
+		if p.plan != nil {
+			until = p.plan.Range.End
+		} else {
+			for i, plan := range p.schedule {
+				if i != index && plan.Range.Start.After(now) && plan.Range.Start.Before(until) {
+					until = plan.Range.Start
+				}
+			}
+		}
+
+		// the block on air is over, and the one jumped to takes its time
+		p.jump = &blockJump{index: index, start: now, end: until}
+		p.endBlock()
+		p.resumePlaylist = -1
+		p.startBlock(index, true)
+	})
+	return err
+}
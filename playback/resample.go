@@ -0,0 +1,85 @@
+package playback
+
+import (
+	"errors"
+
+	"github.com/faiface/beep"
+)
+
+// the rate the output runs at; every track is resampled to it
+var SampleRate beep.SampleRate = 48000
+
+// handed to beep.Resample, from 1 (cheapest) to 64; 3-4 is good for on-the-fly use
+var ResampleQuality = 4
+
+// sets the output rate and resampler quality; call it before Init
+func SetOutput(rate, quality int) error {
+	if rate < 8000 || rate > 192000 {
+		return errors.New("sample rate must be between 8000 and 192000 Hz")
+	}
+	if quality < 1 || quality > 64 {
+		return errors.New("resample quality must be between 1 and 64")
+	}
+	SampleRate = beep.SampleRate(rate)
+	ResampleQuality = quality
+	return nil
+}
+
+// what every streamer handed to the output looks like
+func OutputFormat() beep.Format {
+	return beep.Format{SampleRate: SampleRate, NumChannels: 2, Precision: 2}
+}
+
+// a track resampled to the output rate, which still knows its length and can seek
+type conformed struct {
+	source    beep.StreamSeeker
+	from, to  beep.SampleRate
+	resampler *beep.Resampler
+	// in output samples
+	pos int
+}
+
+// returns the streamer as it plays at the output rate. The decoders already
+// hand out stereo samples, with mono copied to both sides.
+func Conform(streamer beep.StreamSeeker, format beep.Format) beep.StreamSeeker {
+	if format.SampleRate == SampleRate || format.SampleRate <= 0 {
+		return streamer
+	}
+	return &conformed{
+		source:    streamer,
+		from:      format.SampleRate,
+		to:        SampleRate,
+		resampler: beep.Resample(ResampleQuality, format.SampleRate, SampleRate, streamer),
+	}
+}
+
+func (c *conformed) Stream(samples [][2]float64) (n int, ok bool) {
+	n, ok = c.resampler.Stream(samples)
+	c.pos += n
+	return n, ok
+}
+
+func (c *conformed) Err() error {
+	if err := c.resampler.Err(); err != nil {
+		return err
+	}
+	return c.source.Err()
+}
+
+func (c *conformed) Len() int {
+	return int(int64(c.source.Len()) * int64(c.to) / int64(c.from))
+}
+
+func (c *conformed) Position() int {
+	return c.pos
+}
+
+// the resampler reads ahead, so it's started afresh at the new position
+func (c *conformed) Seek(p int) error {
+	if err := c.source.Seek(int(int64(p) * int64(c.from) / int64(c.to))); err != nil {
+		return err
+	}
+	c.resampler = beep.Resample(ResampleQuality, c.from, c.to, c.source)
+	c.pos = p
+	return nil
+}
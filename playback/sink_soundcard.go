@@ -0,0 +1,58 @@
+//go:build !nosoundcard
+// +build !nosoundcard
+
+package playback
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/hajimehoshi/oto"
+)
+
+// how much the sound card buffers; more survives longer hiccups, less reacts sooner
+const soundcardBuffer = 200 * time.Millisecond
+
+func init() {
+	sinkTypes = append(sinkTypes, sinkType{name: "soundcard", paces: true, open: newSoundcardSink})
+	DefaultSinks = "soundcard"
+}
+
+// plays the mix on the default audio device
+type soundcardSink struct {
+	context *oto.Context
+	player  *oto.Player
+	buffer  []byte
+}
+
+func newSoundcardSink(string) (Sink, error) {
+	format := OutputFormat()
+	context, err := oto.NewContext(int(format.SampleRate), format.NumChannels, format.Precision,
+		format.SampleRate.N(soundcardBuffer)*format.Width())
+	if err != nil {
+		return nil, err
+	}
+	return &soundcardSink{context: context, player: context.NewPlayer()}, nil
+}
+
+func (s *soundcardSink) Write(samples [][2]float64) error {
+	size := len(samples) * 4
+	if cap(s.buffer) < size {
+		s.buffer = make([]byte, size)
+	}
+	buffer := s.buffer[:size]
+	for i, sample := range samples {
+		for c := range sample {
+			binary.LittleEndian.PutUint16(buffer[4*i+2*c:], uint16(toInt16(sample[c])))
+		}
+	}
+	_, err := s.player.Write(buffer)
+	return err
+}
+
+func (s *soundcardSink) Close() error {
+	s.player.Close()
+	return s.context.Close()
+}
+
+func (s *soundcardSink) paces() {}
@@ -0,0 +1,363 @@
+package playback
+
+import (
+	"bufio"
+	"errors"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// where the master mix goes; the driver writes every chunk of it to each active sink
+type Sink interface {
+	// samples are only valid during the call
+	Write(samples [][2]float64) error
+	Close() error
+}
+
+// sinks whose Write blocks until the samples have played, like the sound card;
+// exactly one of them sets the pace of the driver
+type pacer interface {
+	Sink
+	paces()
+}
+
+// a kind of sink -sinks can name, as name or name:argument
+type sinkType struct {
+	name string
+	// whether the argument is required
+	argument bool
+	// whether its sinks are pacers
+	paces bool
+	open  func(argument string) (Sink, error)
+}
+
+// sink_soundcard.go adds the sound card unless built with -tags nosoundcard
+var sinkTypes = []sinkType{
+	{name: "null", paces: true, open: func(string) (Sink, error) { return newNullSink(), nil }},
+	{name: "file", argument: true, open: newFileSink},
+	{name: "net", argument: true, open: newNetSink},
+}
+
+// what -sinks lists unless told otherwise: the sound card if the build has one
+var DefaultSinks = "null"
+
+// the master mix is streamed this much at a time
+const outputChunk = 50 * time.Millisecond
+
+// sinks opened by StartOutput, as set by SetSinks
+var sinkSpecs []string
+
+func findSinkType(spec string) (*sinkType, string, error) {
+	name, argument := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		name, argument = spec[:i], spec[i+1:]
+	}
+	for i := range sinkTypes {
+		if sinkTypes[i].name != name {
+			continue
+		}
+		if sinkTypes[i].argument && argument == "" {
+			return nil, "", errors.New("sink " + name + " needs an argument, as in " + name + ":<...>")
+		}
+		return &sinkTypes[i], argument, nil
+	}
+	var names []string
+	for _, t := range sinkTypes {
+		names = append(names, t.name)
+	}
+	return nil, "", errors.New("unknown sink " + name + ", expected one of " + strings.Join(names, ", "))
+}
+
+// selects the sinks StartOutput opens from a comma separated list like
+// "soundcard,file:aircheck.wav"; call it before Init
+func SetSinks(list string) error {
+	var specs []string
+	pacers := 0
+	for _, spec := range strings.Split(list, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		t, _, err := findSinkType(spec)
+		if err != nil {
+			return err
+		}
+		if t.paces {
+			pacers++
+		}
+		specs = append(specs, spec)
+	}
+	if pacers > 1 {
+		return errors.New("only one sink can set the pace, e.g. either soundcard or null")
+	}
+	sinkSpecs = specs
+	return nil
+}
+
+// an open sink and the spec it was opened from
+type namedSink struct {
+	Sink
+	name string
+}
+
+// pulls the master mix at the pace of one of its sinks and writes it to all of them
+type driver struct {
+	sinks []namedSink
+	stop  chan bool
+	done  chan bool
+}
+
+var output *driver
+
+// guards the master mix, which the driver streams from its own goroutine
+var masterMutex sync.Mutex
+
+// opens the sinks and starts playing the master mix to them, recording it too if
+// SetAircheck was given a directory; without a sound card in the list, a null sink keeps time
+func StartOutput() error {
+	d := &driver{stop: make(chan bool), done: make(chan bool)}
+	paced := false
+	for _, spec := range sinkSpecs {
+		t, argument, err := findSinkType(spec)
+		if err == nil {
+			var sink Sink
+			sink, err = t.open(argument)
+			if err == nil {
+				_, isPacer := sink.(pacer)
+				paced = paced || isPacer
+				d.sinks = append(d.sinks, namedSink{sink, spec})
+			}
+		}
+		if err != nil {
+			d.close()
+			return errors.New("couldn't open sink " + spec + ": " + err.Error())
+		}
+	}
+	if !paced {
+		d.sinks = append(d.sinks, namedSink{newNullSink(), "null"})
+	}
+	if AircheckDir != "" {
+		d.sinks = append(d.sinks, namedSink{newAircheck(AircheckDir, AircheckFormat), "aircheck"})
+	}
+
+	output = d
+	go d.run()
+	return nil
+}
+
+// stops the driver and closes its sinks
+func StopOutput() {
+	if output == nil {
+		return
+	}
+	close(output.stop)
+	<-output.done
+	output.close()
+	output = nil
+}
+
+func (d *driver) close() {
+	for _, sink := range d.sinks {
+		if err := sink.Close(); err != nil {
+			log.Printf("Couldn't close sink %s: %v\n", sink.name, err)
+		}
+	}
+}
+
+func (d *driver) run() {
+	defer close(d.done)
+	samples := make([][2]float64, SampleRate.N(outputChunk))
+	for {
+		select {
+		case <-d.stop:
+			return
+		default:
+		}
+
+		masterMutex.Lock()
+		n, _ := master.Stream(samples)
+		masterMutex.Unlock()
+
+		station.send(samples[:n])
+		for i := 0; i < len(d.sinks); i++ {
+			sink := d.sinks[i]
+			err := sink.Write(samples[:n])
+			if err == nil {
+				continue
+			}
+			log.Printf("Output to sink %s failed, closing it: %v\n", sink.name, err)
+			sink.Close()
+			if _, isPacer := sink.Sink.(pacer); isPacer {
+				// the mix still has to go on in real time
+				d.sinks[i] = namedSink{newNullSink(), "null"}
+			} else {
+				d.sinks = append(d.sinks[:i], d.sinks[i+1:]...)
+				i--
+			}
+		}
+	}
+}
+
+// discards the mix, taking as long as it would take to play
+type nullSink struct {
+	start   time.Time
+	written int
+}
+
+// further behind than this, e.g. after the machine was suspended, the clock starts over
+const maxClockLag = time.Second
+
+func newNullSink() *nullSink {
+	return &nullSink{start: time.Now()}
+}
+
+func (s *nullSink) Write(samples [][2]float64) error {
+	s.written += len(samples)
+	due := s.start.Add(SampleRate.D(s.written))
+	wait := time.Until(due)
+	if wait < -maxClockLag {
+		s.start, s.written = time.Now(), 0
+		return nil
+	}
+	time.Sleep(wait)
+	return nil
+}
+
+func (s *nullSink) Close() error {
+	return nil
+}
+
+func (s *nullSink) paces() {}
+
+// writes the mix to a WAV file, or FLAC if the name ends in .flac;
+// either gets its sizes and checksums on Close
+type fileSink struct {
+	file    *os.File
+	buffer  *bufio.Writer
+	encoder Encoder
+}
+
+func newFileSink(path string) (Sink, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSink{file: file, buffer: bufio.NewWriter(file), encoder: fileEncoding(path).New(OutputFormat())}, nil
+}
+
+// the encoding a file's extension asks for, WAV unless it's another one there is
+func fileEncoding(path string) *Encoding {
+	if encoding := EncodingByName(strings.TrimPrefix(filepath.Ext(path), ".")); encoding != nil {
+		return encoding
+	}
+	return EncodingByName("wav")
+}
+
+func (s *fileSink) Write(samples [][2]float64) error {
+	return s.encoder.Encode(s.buffer, samples)
+}
+
+func (s *fileSink) Close() error {
+	err := s.buffer.Flush()
+	if finisher, ok := s.encoder.(Finisher); ok && err == nil {
+		err = finisher.Finish(s.file)
+	}
+	if err != nil {
+		s.file.Close()
+		return err
+	}
+	return s.file.Close()
+}
+
+// how long the network sink waits between attempts to connect
+const netRetry = 5 * time.Second
+
+// pushes the mix as a WAV stream to a TCP address, e.g. an encoder feeding a streaming
+// server, connecting again whenever the connection drops. Chunks go through a buffer,
+// so the driver never waits for the network; they're dropped while it's full.
+type netSink struct {
+	address string
+	chunks  chan [][2]float64
+	stop    chan bool
+	done    chan bool
+}
+
+func newNetSink(address string) (Sink, error) {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return nil, err
+	}
+	s := &netSink{
+		address: address,
+		chunks:  make(chan [][2]float64, int(maxListenerLag/outputChunk)),
+		stop:    make(chan bool),
+		done:    make(chan bool),
+	}
+	go s.run()
+	return s, nil
+}
+
+func (s *netSink) Write(samples [][2]float64) error {
+	chunk := make([][2]float64, len(samples))
+	copy(chunk, samples)
+	select {
+	case s.chunks <- chunk:
+	default:
+	}
+	return nil
+}
+
+func (s *netSink) run() {
+	defer close(s.done)
+	for {
+		conn, err := net.DialTimeout("tcp", s.address, netRetry)
+		if err == nil {
+			log.Println("Streaming to " + s.address)
+			err = s.send(conn)
+			conn.Close()
+			if err == nil {
+				return
+			}
+		}
+		log.Printf("Can't stream to %s, trying again in %v: %v\n", s.address, netRetry, err)
+
+		// what comes in meanwhile would be stale by the time it's sent
+		wait := time.After(netRetry)
+	waiting:
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-s.chunks:
+			case <-wait:
+				break waiting
+			}
+		}
+	}
+}
+
+// sends chunks until the connection fails, or returns nil once the sink is closed
+func (s *netSink) send(conn net.Conn) error {
+	encoder := EncodingByName("wav").New(OutputFormat())
+	for {
+		select {
+		case <-s.stop:
+			return nil
+		case chunk := <-s.chunks:
+			conn.SetWriteDeadline(time.Now().Add(netRetry))
+			if err := encoder.Encode(conn, chunk); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *netSink) Close() error {
+	close(s.stop)
+	<-s.done
+	return nil
+}
@@ -0,0 +1,157 @@
+package playback
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// how many listeners /stream takes at once, set from the -max-listeners flag
+var MaxListeners = 100
+
+// listeners further behind the master mix than this are dropped,
+// so a slow connection never holds up the audio
+const maxListenerLag = 5 * time.Second
+
+// chunks waiting for a listener; the lag limit usually kicks in long before
+const listenerChunks = 1024
+
+var ErrTooManyListeners = errors.New("too many listeners")
+
+// one receiver of the master mix, with its own buffer
+type Listener struct {
+	chunks chan [][2]float64
+	// samples sent to chunks and not taken out yet
+	pending int64
+}
+
+// the listeners the master mix is fanned out to
+type broadcast struct {
+	mutex     sync.Mutex
+	listeners map[*Listener]bool
+}
+
+var station = broadcast{listeners: map[*Listener]bool{}}
+
+// hands a copy of samples to every listener without ever blocking,
+// dropping those whose buffer is full; called from the audio thread
+func (b *broadcast) send(samples [][2]float64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if len(b.listeners) == 0 || len(samples) == 0 {
+		return
+	}
+	// shared by every listener, which only read it
+	chunk := make([][2]float64, len(samples))
+	copy(chunk, samples)
+	limit := int64(SampleRate.N(maxListenerLag))
+
+	for listener := range b.listeners {
+		if atomic.LoadInt64(&listener.pending)+int64(len(chunk)) > limit {
+			b.drop(listener)
+			continue
+		}
+		select {
+		case listener.chunks <- chunk:
+			atomic.AddInt64(&listener.pending, int64(len(chunk)))
+		default:
+			b.drop(listener)
+		}
+	}
+}
+
+// the caller holds the lock
+func (b *broadcast) drop(listener *Listener) {
+	delete(b.listeners, listener)
+	close(listener.chunks)
+	log.Printf("Dropped a listener which fell more than %v behind\n", maxListenerLag)
+}
+
+// starts receiving the master mix; Close stops it
+func Listen() (*Listener, error) {
+	station.mutex.Lock()
+	defer station.mutex.Unlock()
+
+	if len(station.listeners) >= MaxListeners {
+		return nil, ErrTooManyListeners
+	}
+	listener := &Listener{chunks: make(chan [][2]float64, listenerChunks)}
+	station.listeners[listener] = true
+	return listener, nil
+}
+
+// returns the next chunk of the mix; ok is false once the listener was closed or dropped
+func (l *Listener) Receive() (chunk [][2]float64, ok bool) {
+	chunk, ok = <-l.chunks
+	atomic.AddInt64(&l.pending, -int64(len(chunk)))
+	return chunk, ok
+}
+
+func (l *Listener) Close() {
+	station.mutex.Lock()
+	defer station.mutex.Unlock()
+
+	if station.listeners[l] {
+		delete(station.listeners, l)
+		close(l.chunks)
+	}
+}
+
+func ListenerCount() int {
+	station.mutex.Lock()
+	defer station.mutex.Unlock()
+	return len(station.listeners)
+}
+
+// ?format=wav|pcm|flac, the master mix as it goes to air, for as long as the client keeps up
+func HTTPStream(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	encoding := EncodingByName(r.URL.Query().Get("format"))
+	if encoding == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	listener, err := Listen()
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	defer listener.Close()
+	log.Printf("%s tuned in, %d listening\n", r.RemoteAddr, ListenerCount())
+
+	format := OutputFormat()
+	w.Header().Set("Content-Type", encoding.ContentType(format))
+	w.Header().Set("Cache-Control", "no-cache, no-store")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// a closed connection is noticed here straight away rather than on the next write
+	go func() {
+		<-r.Context().Done()
+		listener.Close()
+	}()
+
+	encoder := encoding.New(format)
+	for {
+		chunk, ok := listener.Receive()
+		if !ok {
+			break
+		}
+		if err := encoder.Encode(w, chunk); err != nil {
+			break
+		}
+		flusher.Flush()
+	}
+	log.Printf("%s tuned out\n", r.RemoteAddr)
+}
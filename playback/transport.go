@@ -0,0 +1,151 @@
+package playback
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"radio/database"
+	"radio/utils"
+
+	"github.com/faiface/beep/effects"
+	"github.com/julienschmidt/httprouter"
+)
+
+// the master volume range in dB; at the bottom the station is muted
+const (
+	MinVolume = -60.0
+	MaxVolume = 6.0
+)
+
+var ErrNothingPlaying = errors.New("nothing is playing")
+var ErrNoBlock = errors.New("no such block in today's schedule")
+var ErrLastSong = errors.New("nothing left to skip to in this block")
+
+// what's on air, as every transport control responds with
+type NowPlaying struct {
+	Paused bool `json:"paused"`
+	// master volume in dB
+	Volume float64 `json:"volume_db"`
+	// position of the block in today's schedule, as schedule today lists it; -1 between blocks
+	Block int                 `json:"block"`
+	Plan  *database.PlanBlock `json:"plan,omitempty"`
+	// position of the track in the playlist's queue or the block's files
+	Track int `json:"track"`
+	// the song of a playlist block, or the file of a file block
+	Song *database.SongData `json:"song,omitempty"`
+	File string             `json:"file,omitempty"`
+	// into the song and its length, in milliseconds
+	Elapsed int `json:"elapsed_ms"`
+	Length  int `json:"length_ms"`
+}
+
+func setGain(v *effects.Volume, db float64) {
+	v.Base = 2
+	v.Volume = db / (20 * math.Log10(2))
+	v.Silent = db <= MinVolume
+}
+
+func formatDB(db float64) string {
+	return strconv.FormatFloat(db, 'f', -1, 64)
+}
+
+func GetNowPlaying() NowPlaying {
+	return player.NowPlaying()
+}
+
+// crossfades into the next song and returns it once it started, which takes
+// until the next chunk of the mix unless the station is paused
+func Skip() (NowPlaying, error) {
+	before := player.NowPlaying()
+	if err := player.Skip(); err != nil {
+		return before, err
+	}
+	state := before
+	for i := 0; i < 20 && state.Track == before.Track && !state.Paused; i++ {
+		time.Sleep(outputChunk)
+		state = player.NowPlaying()
+	}
+	return state, nil
+}
+
+func SetPaused(pause bool) NowPlaying {
+	player.SetPaused(pause)
+	return player.NowPlaying()
+}
+
+func SetVolume(db float64) (NowPlaying, error) {
+	err := player.SetVolume(db)
+	return player.NowPlaying(), err
+}
+
+func RestartBlock() (NowPlaying, error) {
+	err := player.RestartBlock()
+	return player.NowPlaying(), err
+}
+
+func JumpToBlock(index int) (NowPlaying, error) {
+	err := player.JumpToBlock(index)
+	return player.NowPlaying(), err
+}
+
+// responds with what's on air, or with the error of the control which was used
+func sendNowPlaying(w http.ResponseWriter, r *http.Request, state NowPlaying, err error) {
+	if err != nil {
+		utils.SendErrorJSON(w, r, err.Error())
+		return
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		utils.SendErrorJSON(w, r, err.Error())
+		return
+	}
+	utils.SendJSON(w, r, data)
+}
+
+func HTTPNowPlaying(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	sendNowPlaying(w, r, GetNowPlaying(), nil)
+}
+
+func HTTPSkip(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	state, err := Skip()
+	sendNowPlaying(w, r, state, err)
+}
+
+func HTTPPause(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	sendNowPlaying(w, r, SetPaused(true), nil)
+}
+
+func HTTPResume(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	sendNowPlaying(w, r, SetPaused(false), nil)
+}
+
+// ?db=<master volume in dB>
+func HTTPSetVolume(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	db, err := strconv.ParseFloat(r.URL.Query().Get("db"), 64)
+	if err != nil {
+		utils.SendErrorJSON(w, r, "db must be a number")
+		return
+	}
+	state, err := SetVolume(db)
+	sendNowPlaying(w, r, state, err)
+}
+
+func HTTPRestartBlock(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	state, err := RestartBlock()
+	sendNowPlaying(w, r, state, err)
+}
+
+// ?index=<position of the block in today's schedule>
+func HTTPJumpToBlock(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	index, err := strconv.Atoi(r.URL.Query().Get("index"))
+	if err != nil {
+		utils.SendErrorJSON(w, r, "index must be a number")
+		return
+	}
+	state, err := JumpToBlock(index)
+	sendNowPlaying(w, r, state, err)
+}
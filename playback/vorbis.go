@@ -0,0 +1,97 @@
+package playback
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/faiface/beep"
+	"github.com/jfreymuth/oggvorbis"
+)
+
+// beep's own vorbis decoder takes every two values for a stereo sample,
+// which plays mono files at double speed and scrambles surround ones;
+// this one maps the channels onto stereo instead
+type vorbisDecoder struct {
+	f   *os.File
+	r   *oggvorbis.Reader
+	buf []float32
+	err error
+}
+
+func decodeVorbis(f *os.File) (beep.StreamSeekCloser, beep.Format, error) {
+	r, err := oggvorbis.NewReader(f)
+	if err != nil {
+		return nil, beep.Format{}, fmt.Errorf("ogg/vorbis: %v", err)
+	}
+	format := beep.Format{
+		SampleRate:  beep.SampleRate(r.SampleRate()),
+		NumChannels: r.Channels(),
+		Precision:   2,
+	}
+	return &vorbisDecoder{f: f, r: r}, format, nil
+}
+
+// folds one frame into stereo; Vorbis orders 3 and 5 to 8 channels
+// as front left, centre, front right and then the rest
+func vorbisStereo(frame []float32) [2]float64 {
+	switch len(frame) {
+	case 1:
+		return [2]float64{float64(frame[0]), float64(frame[0])}
+	case 2, 4:
+		return [2]float64{float64(frame[0]), float64(frame[1])}
+	default:
+		centre := 0.7071 * float64(frame[1])
+		return [2]float64{float64(frame[0]) + centre, float64(frame[2]) + centre}
+	}
+}
+
+func (d *vorbisDecoder) Stream(samples [][2]float64) (n int, ok bool) {
+	if d.err != nil {
+		return 0, false
+	}
+	channels := d.r.Channels()
+	if cap(d.buf) < len(samples)*channels {
+		d.buf = make([]float32, len(samples)*channels)
+	}
+	buf := d.buf[:len(samples)*channels]
+
+	for n < len(samples) {
+		read, err := d.r.Read(buf[n*channels:])
+		for i := 0; i < read/channels; i++ {
+			samples[n+i] = vorbisStereo(buf[(n+i)*channels : (n+i+1)*channels])
+		}
+		n += read / channels
+		if err == io.EOF || (err == nil && read == 0) {
+			break
+		}
+		if err != nil {
+			d.err = fmt.Errorf("ogg/vorbis: %v", err)
+			break
+		}
+	}
+	return n, n > 0
+}
+
+func (d *vorbisDecoder) Err() error {
+	return d.err
+}
+
+func (d *vorbisDecoder) Len() int {
+	return int(d.r.Length())
+}
+
+func (d *vorbisDecoder) Position() int {
+	return int(d.r.Position())
+}
+
+func (d *vorbisDecoder) Seek(p int) error {
+	if err := d.r.SetPosition(int64(p)); err != nil {
+		return fmt.Errorf("ogg/vorbis: %v", err)
+	}
+	return nil
+}
+
+func (d *vorbisDecoder) Close() error {
+	return d.f.Close()
+}
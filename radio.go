@@ -2,17 +2,20 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"radio/database"
-	"radio/fading"
+	"radio/library"
 	"radio/playback"
 	"radio/session"
 	"radio/utils"
@@ -22,13 +25,49 @@ import (
 
 var addr = flag.String("addr", ":2137", "TCP address to listen on")
 var debugMode = flag.Bool("debug", false, "Enable debug mode")
+var dbDriver = flag.String("db", "mysql", "Database backend (mysql | memory)")
+var dbDSN = flag.String("dsn", "root:kopytko@/radio?parseTime=true", "MySQL data source name")
+var scanInterval = flag.Duration("scan-interval", 0, "How often to look for new audio files in the music directory (0 disables watching)")
+var trashRetention = flag.Duration("trash-retention", 30*24*time.Hour, "How long deleted songs and playlists stay in the trash")
+var sampleRate = flag.Int("sample-rate", 48000, "Output sample rate in Hz; tracks at other rates are resampled")
+var resampleQuality = flag.Int("resample-quality", 4, "Resampler quality from 1 (cheapest) to 64")
+var sinks = flag.String("sinks", playback.DefaultSinks, "Where the station plays, comma separated: soundcard or null (no audio device, same timing), file:<path.wav or .flac>, net:<host:port>")
+var maxListeners = flag.Int("max-listeners", 100, "How many listeners /stream takes at once")
+var aircheckDir = flag.String("aircheck-dir", "", "Directory everything that goes to air is recorded to in hourly files (empty disables recording)")
+var aircheckFormat = flag.String("aircheck-format", "flac", "Format of the recordings (wav | flac)")
+var aircheckRetention = flag.Duration("aircheck-retention", 90*24*time.Hour, "How long recordings are kept (0 keeps them forever)")
+var targetLoudness = flag.Float64("target-lufs", -16, "Loudness songs are normalised to in LUFS (0 disables normalisation)")
 
 func main() {
 	flag.Parse()
 
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
-	database.Init()
+	database.Init(*dbDriver, *dbDSN)
+	if err := playback.SetOutput(*sampleRate, *resampleQuality); err != nil {
+		log.Fatalf("%v\n", err)
+	}
+	if err := playback.SetTargetLoudness(*targetLoudness); err != nil {
+		log.Fatalf("%v\n", err)
+	}
+	if err := playback.SetSinks(*sinks); err != nil {
+		log.Fatalf("%v\n", err)
+	}
+	playback.MaxListeners = *maxListeners
+	if err := playback.SetAircheck(*aircheckDir, *aircheckFormat, *aircheckRetention); err != nil {
+		log.Fatalf("%v\n", err)
+	}
+
+	// radio export <file> / radio import [-dry-run] <file> / radio scan run and exit
+	if flag.NArg() > 0 {
+		os.Exit(runCommand(flag.Args()))
+	}
+
+	database.StartTrashPurger(*trashRetention)
+	database.StartPeriodCloser()
+	if *scanInterval > 0 {
+		library.StartWatcher(*scanInterval)
+	}
 
 	log.Println("Hello World!")
 
@@ -41,13 +80,39 @@ func main() {
 	router.GET("/updatevote", database.HTTPUpdateVote)
 	router.GET("/getplaylists", database.HTTPGetPlaylistIndex)
 	router.GET("/getplaylist", database.HTTPGetPlaylist)
+	router.GET("/updateplaylist", database.RequireToken(database.HTTPUpdatePlaylist))
 	router.GET("/getsong", database.HTTPGetSong)
-	router.GET("/getcover", database.HTTPGetCover)
+	router.GET("/getsongs", database.HTTPGetSongs)
+	router.GET("/search", database.HTTPSearch)
+	router.GET("/updatesong", database.RequireToken(database.HTTPUpdateSong))
+	router.POST("/uploadsong", database.RequireToken(library.HTTPUploadSong))
+	router.GET("/verifysongs", database.RequireToken(library.HTTPVerifySongs))
+	router.GET("/updatecues", database.RequireToken(library.HTTPUpdateCues))
+	router.GET("/getduplicates", database.RequireToken(library.HTTPGetDuplicates))
+	router.GET("/mergesongs", database.RequireToken(database.HTTPMergeSongs))
+	router.GET("/getcover", library.HTTPGetCover)
+	router.GET("/getwaveform", database.RequireToken(library.HTTPGetWaveform))
 	router.GET("/getschedule", database.HTTPGetSchedule)
+	router.GET("/getscheduleblocks", database.HTTPGetScheduleBlocks)
+	router.GET("/gettrash", database.RequireToken(database.HTTPGetTrash))
+	router.GET("/restore", database.RequireToken(database.HTTPRestore))
+	router.GET("/getperiods", database.HTTPGetPeriods)
+	router.GET("/leaderboard", database.HTTPLeaderboard)
+	router.GET("/songchart", database.HTTPSongChart)
+	router.GET("/stream", playback.HTTPStream)
+	router.GET("/nowplaying", playback.HTTPNowPlaying)
+	router.GET("/skip", database.RequireToken(playback.HTTPSkip))
+	router.GET("/pause", database.RequireToken(playback.HTTPPause))
+	router.GET("/resume", database.RequireToken(playback.HTTPResume))
+	router.GET("/setvolume", database.RequireToken(playback.HTTPSetVolume))
+	router.GET("/restartblock", database.RequireToken(playback.HTTPRestartBlock))
+	router.GET("/jumptoblock", database.RequireToken(playback.HTTPJumpToBlock))
+	router.GET("/getairchecks", database.RequireToken(playback.HTTPGetAirchecks))
+	router.GET("/getaircheck", database.RequireToken(playback.HTTPGetAircheck))
 
 	database.CreateSampleSchedule()
 
-	// Init the speaker and random queue of playlists
+	// Start the output and the random queue of playlists
 	playback.Init()
 
 	// Load schedule for today
@@ -59,6 +124,85 @@ func main() {
 	log.Fatal(http.ListenAndServe(*addr, session.New(session.NewProtect(router), *debugMode)))
 }
 
+func runCommand(args []string) int {
+	switch args[0] {
+	case "export":
+		if len(args) < 2 {
+			fmt.Println("usage: radio export <file>")
+			return 2
+		}
+		if !exportLibrary(args[1]) {
+			return 1
+		}
+	case "import":
+		importFlags := flag.NewFlagSet("import", flag.ExitOnError)
+		dryRun := importFlags.Bool("dry-run", false, "Only report what the import would change")
+		importFlags.Parse(args[1:])
+		if importFlags.NArg() < 1 {
+			fmt.Println("usage: radio import [-dry-run] <file>")
+			return 2
+		}
+		if !importLibrary(importFlags.Arg(0), *dryRun) {
+			return 1
+		}
+	case "scan":
+		if !scanLibrary() {
+			return 1
+		}
+	default:
+		fmt.Println("Unknown command " + args[0] + ", expected export, import or scan")
+		return 2
+	}
+	return 0
+}
+
+func exportLibrary(target string) bool {
+	files, err := database.ExportArchive(target)
+	if cmdHandleErr(err) {
+		return false
+	}
+	log.Println("Library exported to " + target + " with " + strconv.Itoa(files) + " files!")
+	return true
+}
+
+func importLibrary(source string, dryRun bool) bool {
+	report, err := database.ImportArchive(source, dryRun)
+	if report != nil {
+		printImportReport(*report)
+	}
+	if cmdHandleErr(err) {
+		return false
+	}
+	if dryRun {
+		log.Println("Dry run finished, nothing was changed.")
+	} else {
+		log.Println("Library imported from " + source + "!")
+	}
+	return true
+}
+
+func scanLibrary() bool {
+	report, err := library.Scan()
+	if cmdHandleErr(err) {
+		return false
+	}
+
+	for _, added := range report.Added {
+		fmt.Println("Added song " + strconv.Itoa(added.SongId) + " (" + added.Title + ") from " + added.Path)
+	}
+	for _, failure := range report.Failed {
+		fmt.Printf("Couldn't add %s: %v\n", failure.Path, failure.Err)
+	}
+	for _, file := range report.UnknownFiles {
+		fmt.Println("No song in the database for " + file)
+	}
+	for _, song := range report.MissingAudio {
+		fmt.Println("Song " + strconv.Itoa(song.SongId) + " (" + song.Authors + " - " + song.Title + ") has no audio file")
+	}
+	log.Println("Scan finished, " + strconv.Itoa(len(report.Added)) + " songs added.")
+	return true
+}
+
 type MethodNotAllowedHandler struct {
 }
 
@@ -88,73 +232,52 @@ func consoleInput() {
 
 		args := strings.Split(input, " ")
 		if args[0] == "skip" {
-			if fading.CurFader != nil {
-				playback.CurStreamer.Seek(fading.CurFader.Id + 1)
-				//playback.CurStreamer
-				playback.LastIndex = fading.CurFader.Id
-				song := playback.Queue[playback.LastIndex]
-				log.Println(song.Authors + " - " + song.Title + " (" + song.ReleaseDate.Format("2006-01-02") + ")")
-				log.Println("Kopytko")
+			state, err := playback.Skip()
+			if !cmdHandleErr(err) {
+				printNowPlaying(state)
+			}
+		} else if args[0] == "pause" {
+			printNowPlaying(playback.SetPaused(true))
+		} else if args[0] == "resume" {
+			printNowPlaying(playback.SetPaused(false))
+		} else if args[0] == "volume" {
+			if len(args) < 2 {
+				printNowPlaying(playback.GetNowPlaying())
+				continue
 			}
+
+			db, err := strconv.ParseFloat(args[1], 64)
+			if cmdHandleErr(err) {
+				continue
+			}
+			state, err := playback.SetVolume(db)
+			if !cmdHandleErr(err) {
+				printNowPlaying(state)
+			}
+		} else if args[0] == "nowplaying" {
+			printNowPlaying(playback.GetNowPlaying())
 		} else if args[0] == "query" {
 			if len(args) < 2 {
 				printHelp(args[0])
 				continue
 			}
 
+			query := strings.Join(args[2:], " ")
 			if args[1] == "song" {
-				songs := database.GetSongArray()
-				matches := []database.SongData{}
-				for _, song := range songs {
-					var match bool
-					for i := 2; i < len(args); i++ {
-						querypart := args[i]
-						if strings.Contains(strings.ToLower(song.Authors), strings.ToLower(querypart)) ||
-							strings.Compare(strings.ToLower(strconv.Itoa(song.SongId)), strings.ToLower(querypart)) == 0 ||
-							strings.Contains(strings.ToLower(song.Title), strings.ToLower(querypart)) ||
-							strings.Compare(strings.ToLower(song.ReleaseDate.Format("2006-01-02")), strings.ToLower(querypart)) == 0 ||
-							strings.Compare(strings.ToLower(song.ReleaseDate.Format("2006-01")), strings.ToLower(querypart)) == 0 ||
-							strings.Compare(strings.ToLower(song.ReleaseDate.Format("2006")), strings.ToLower(querypart)) == 0 {
-							match = true
-						} else {
-							match = false
-						}
-					}
-					if match {
-						matches = append(matches, song)
-					}
-
+				results, err := database.SearchSongs(query)
+				if cmdHandleErr(err) {
+					continue
 				}
-
-				for _, song := range matches {
-					printSong(song)
+				for _, result := range results {
+					printSong(result.SongData)
 				}
 			} else if args[1] == "playlist" {
-				playlists, err := database.GetPlaylistsArray()
+				results, err := database.SearchPlaylists(query)
 				if cmdHandleErr(err) {
-					break
-				}
-				matches := []database.Playlist{}
-				for _, playlist := range playlists {
-					var match bool
-					for i := 2; i < len(args); i++ {
-						querypart := args[i]
-						if strings.Contains(strings.ToLower(playlist.Name), strings.ToLower(querypart)) ||
-							strings.Compare(strings.ToLower(strconv.Itoa(playlist.Id)), strings.ToLower(querypart)) == 0 ||
-							strings.Contains(strings.ToLower(playlist.Desc), strings.ToLower(querypart)) {
-							match = true
-						} else {
-							match = false
-						}
-					}
-					if match {
-						matches = append(matches, playlist)
-					}
-
+					continue
 				}
-
-				for _, playlist := range matches {
-					printPlaylist(playlist)
+				for _, result := range results {
+					printPlaylist(result.Playlist)
 				}
 			}
 		} else if args[0] == "queue" {
@@ -177,7 +300,7 @@ func consoleInput() {
 				}
 				pid := int(plid)
 
-				songs := playback.GeneratedQueues[pid]
+				songs := playback.QueueFor(pid)
 				fmt.Println("Queue size: " + strconv.Itoa(len(songs)))
 				for index, song := range songs {
 					fmt.Println("Pos " + strconv.Itoa(index))
@@ -233,6 +356,7 @@ func consoleInput() {
 						break
 					}
 
+					fmt.Println("Pos " + strconv.Itoa(entry.Position))
 					printSong(song)
 					passed++
 				}
@@ -247,6 +371,62 @@ func consoleInput() {
 				if !cmdHandleErr(err) {
 					log.Println("Song " + args[3] + " was successfully added to playlist " + args[2] + "!")
 				}
+			} else if args[1] == "insert" {
+				if len(args) < 5 {
+					printHelp(args[0])
+					continue
+				}
+
+				position, err := strconv.Atoi(args[4])
+				if cmdHandleErr(err) {
+					continue
+				}
+				err = database.InsertSongIntoPlaylist(args[2], args[3], position)
+				if !cmdHandleErr(err) {
+					log.Println("Song " + args[3] + " was inserted at position " + args[4] + " of playlist " + args[2] + "!")
+				}
+			} else if args[1] == "move" {
+				if len(args) < 5 {
+					printHelp(args[0])
+					continue
+				}
+
+				from, err := strconv.Atoi(args[3])
+				if cmdHandleErr(err) {
+					continue
+				}
+				to, err := strconv.Atoi(args[4])
+				if cmdHandleErr(err) {
+					continue
+				}
+				err = database.MovePlaylistEntry(args[2], from, to)
+				if !cmdHandleErr(err) {
+					log.Println("Moved position " + args[3] + " of playlist " + args[2] + " to " + args[4] + "!")
+				}
+			} else if args[1] == "reorder" {
+				if len(args) < 4 {
+					printHelp(args[0])
+					continue
+				}
+
+				order, err := database.ParsePositions(args[3])
+				if cmdHandleErr(err) {
+					continue
+				}
+				err = database.ReorderPlaylist(args[2], order)
+				if !cmdHandleErr(err) {
+					log.Println("Playlist " + args[2] + " reordered!")
+				}
+			} else if args[1] == "mode" {
+				if len(args) < 4 {
+					printHelp(args[0])
+					continue
+				}
+
+				err = database.SetPlaylistMode(args[2], args[3])
+				if !cmdHandleErr(err) {
+					log.Println("Playlist " + args[2] + " now plays in " + args[3] + " mode!")
+				}
 			} else if args[1] == "remsong" {
 				if len(args) < 4 {
 					printHelp(args[0])
@@ -264,8 +444,12 @@ func consoleInput() {
 				}
 
 				list := database.GetPlaylistData(args[2])
+				if list == nil {
+					log.Println("No playlist with id " + args[2])
+					continue
+				}
 
-				fmt.Println("=Are you sure you want to delete playlist " + args[2] + " [" + list.Name + "? (y/n)")
+				fmt.Println("=Are you sure you want to delete playlist " + args[2] + " [" + list.Name + "]? (y/n)")
 				yn, err := reader.ReadString('\n')
 				if cmdHandleErr(err) {
 					break
@@ -275,7 +459,7 @@ func consoleInput() {
 				if yn == "y" {
 					err = database.DelPlaylist(args[2])
 					if !cmdHandleErr(err) {
-						log.Println("Playlist deleted successfully!")
+						log.Println("Playlist moved to the trash! (trash restore playlist " + args[2] + " brings it back)")
 					}
 				} else {
 					log.Println("Playlist deletion canceled.")
@@ -325,7 +509,7 @@ func consoleInput() {
 				songs := database.GetSongArray()
 				index := 0
 
-				if len(args) == 3 {
+				if len(args) >= 3 {
 					page, err := strconv.ParseInt(args[2], 10, 64)
 					if cmdHandleErr(err) {
 						break
@@ -333,6 +517,14 @@ func consoleInput() {
 					index = int(page)*10 - 10
 				}
 
+				if len(args) >= 4 {
+					filter, err := parseFilterArgs(args[3:])
+					if cmdHandleErr(err) {
+						break
+					}
+					songs = filter.FilterSongs(songs)
+				}
+
 				passed := 0
 				for currentIndex, song := range songs {
 
@@ -376,29 +568,231 @@ func consoleInput() {
 				}
 				date = strings.TrimSuffix(date, "\r\n")
 
-				fmt.Println("=Length (in seconds):")
-				var length int
-				_, err = fmt.Scanf("%d", &length)
+				resdate, err := time.Parse("2006-01-02", date)
 				if cmdHandleErr(err) {
 					break
 				}
 
-				resdate, err := time.Parse("2006-01-02", date)
+				fmt.Println("=Audio file:")
+				file, err := reader.ReadString('\n')
 				if cmdHandleErr(err) {
 					break
 				}
+				file = strings.TrimRight(file, "\r\n")
 
 				song := database.SongData{
 					Authors:     authors,
 					Title:       title,
-					Length:      int(length),
 					YTId:        yt,
 					ReleaseDate: resdate,
 				}
 
-				err = database.AddSong(song)
+				// the length is taken from the decoded audio, which is copied to music/<id>/
+				songid, err := library.AddSongFile(song, file)
 				if !cmdHandleErr(err) {
-					log.Println("Song added successfully!")
+					id := strconv.Itoa(songid)
+					log.Println("Song " + id + " added successfully! (song edit " + id + " sets genres, tags and the rest)")
+				}
+			} else if args[1] == "verify" {
+				songid := ""
+				if len(args) >= 3 && args[2] != "all" {
+					songid = args[2]
+				}
+				fix := len(args) >= 4 && args[3] == "fix"
+
+				checks, err := library.VerifyLengths(songid, fix)
+				if cmdHandleErr(err) {
+					continue
+				}
+				for _, check := range checks {
+					line := "Song " + strconv.Itoa(check.SongId) + " (" + check.Authors + " - " + check.Title + "): "
+					if check.Error != "" {
+						fmt.Println(line + check.Error)
+						continue
+					}
+					line += "stored " + strconv.Itoa(check.Stored) + "s, audio is " + strconv.Itoa(check.Actual) + "s"
+					if check.Fixed {
+						line += ", fixed"
+					}
+					fmt.Println(line)
+				}
+				log.Println("Verified song lengths, " + strconv.Itoa(len(checks)) + " songs need attention.")
+			} else if args[1] == "analyse" {
+				// songs without a measurement by default
+				songid := ""
+				all := false
+				if len(args) >= 3 {
+					if args[2] == "all" {
+						all = true
+					} else {
+						songid = args[2]
+					}
+				}
+
+				results, err := library.AnalyseLoudness(songid, all)
+				if cmdHandleErr(err) {
+					continue
+				}
+				failed := 0
+				for _, result := range results {
+					line := "Song " + strconv.Itoa(result.SongId) + " (" + result.Authors + " - " + result.Title + "): "
+					if result.Error != "" {
+						fmt.Println(line + result.Error)
+						failed++
+						continue
+					}
+					fmt.Println(line + formatLoudness(*result.Loudness))
+				}
+				log.Println("Analysed " + strconv.Itoa(len(results)-failed) + " songs, " + strconv.Itoa(failed) + " failed.")
+			} else if args[1] == "cues" {
+				if len(args) < 3 {
+					printHelp(args[0])
+					continue
+				}
+
+				song := database.GetSongData(args[2])
+				if song == nil {
+					log.Println("No song with id " + args[2])
+					continue
+				}
+				if len(args) == 3 {
+					if song.Cues == nil {
+						fmt.Println("Song " + args[2] + " has no cues, song detectcues " + args[2] + " finds them")
+					} else {
+						fmt.Println(formatCues(*song.Cues))
+					}
+					continue
+				}
+				if len(args) < 7 {
+					printHelp(args[0])
+					continue
+				}
+
+				var cues database.Cues
+				points := []*int{&cues.CueIn, &cues.IntroEnd, &cues.OutroStart, &cues.CueOut}
+				valid := true
+				for i, point := range points {
+					*point, err = parseCueTime(args[3+i])
+					if cmdHandleErr(err) {
+						valid = false
+						break
+					}
+				}
+				if !valid {
+					continue
+				}
+				err = database.SetSongCues(song.SongId, cues)
+				if !cmdHandleErr(err) {
+					log.Println("Cues of song " + args[2] + " set to " + formatCues(cues))
+				}
+			} else if args[1] == "detectcues" {
+				// songs without cues by default
+				songid := ""
+				all := false
+				if len(args) >= 3 {
+					if args[2] == "all" {
+						all = true
+					} else {
+						songid = args[2]
+					}
+				}
+
+				results, err := library.DetectSongCues(songid, all)
+				if cmdHandleErr(err) {
+					continue
+				}
+				failed := 0
+				for _, result := range results {
+					line := "Song " + strconv.Itoa(result.SongId) + " (" + result.Authors + " - " + result.Title + "): "
+					if result.Error != "" {
+						fmt.Println(line + result.Error)
+						failed++
+						continue
+					}
+					fmt.Println(line + formatCues(*result.Cues))
+				}
+				log.Println("Detected the cues of " + strconv.Itoa(len(results)-failed) + " songs, " + strconv.Itoa(failed) + " failed.")
+			} else if args[1] == "duplicates" {
+				report, err := library.FindDuplicates()
+				if cmdHandleErr(err) {
+					continue
+				}
+				for _, pair := range report.Pairs {
+					fmt.Println("Song " + strconv.Itoa(pair.Duplicate.SongId) + " (" + pair.Duplicate.Authors + " - " + pair.Duplicate.Title +
+						") duplicates song " + strconv.Itoa(pair.Keep.SongId) + " (" + pair.Keep.Authors + " - " + pair.Keep.Title + ")")
+					fmt.Printf("  %s, title %.0f%% alike, audio %.0f%% alike; song merge %d %d\n", strings.Join(pair.Reasons, ", "),
+						pair.TitleSimilarity*100, pair.AudioSimilarity*100, pair.Keep.SongId, pair.Duplicate.SongId)
+				}
+				log.Println("Found " + strconv.Itoa(len(report.Pairs)) + " possible duplicates.")
+				if len(report.Unfingerprinted) > 0 {
+					log.Println(strconv.Itoa(len(report.Unfingerprinted)) + " songs were only compared by their metadata, song fingerprint compares their audio too.")
+				}
+			} else if args[1] == "fingerprint" {
+				// songs without a fingerprint by default
+				songid := ""
+				all := false
+				if len(args) >= 3 {
+					if args[2] == "all" {
+						all = true
+					} else {
+						songid = args[2]
+					}
+				}
+
+				results, err := library.FingerprintSongs(songid, all)
+				if cmdHandleErr(err) {
+					continue
+				}
+				failed := 0
+				for _, result := range results {
+					if result.Error != "" {
+						fmt.Println("Song " + strconv.Itoa(result.SongId) + " (" + result.Authors + " - " + result.Title + "): " + result.Error)
+						failed++
+					}
+				}
+				log.Println("Fingerprinted " + strconv.Itoa(len(results)-failed) + " songs, " + strconv.Itoa(failed) + " failed.")
+			} else if args[1] == "merge" {
+				if len(args) < 4 {
+					printHelp(args[0])
+					continue
+				}
+				keep, err := strconv.Atoi(args[2])
+				if cmdHandleErr(err) {
+					continue
+				}
+				duplicate, err := strconv.Atoi(args[3])
+				if cmdHandleErr(err) {
+					continue
+				}
+
+				err = database.MergeSongs(keep, duplicate)
+				if err == database.ErrNotFound {
+					log.Println("Both songs must exist and not be in the trash")
+					continue
+				}
+				if !cmdHandleErr(err) {
+					log.Println("Merged song " + args[3] + " into song " + args[2] + ", song " + args[3] + " is in the trash")
+				}
+			} else if args[1] == "edit" {
+				if len(args) < 3 {
+					printHelp(args[0])
+					continue
+				}
+
+				song := database.GetSongData(args[2])
+				if song == nil {
+					log.Println("No song with id " + args[2])
+					continue
+				}
+				printSong(*song)
+
+				if !readSongMetadata(song) {
+					continue
+				}
+
+				err = database.UpdateSong(*song)
+				if !cmdHandleErr(err) {
+					log.Println("Song " + args[2] + " updated successfully!")
 				}
 			} else if args[1] == "delete" {
 				if len(args) < 3 {
@@ -408,7 +802,7 @@ func consoleInput() {
 
 				err = database.DelSong(args[2])
 				if !cmdHandleErr(err) {
-					log.Println("Song deleted successfully!")
+					log.Println("Song moved to the trash! (trash restore song " + args[2] + " brings it back)")
 				}
 			}
 		} else if args[0] == "schedule" {
@@ -423,6 +817,60 @@ func consoleInput() {
 					fmt.Println("Pos " + strconv.Itoa(index))
 					printPlan(plan)
 				}
+			} else if args[1] == "restart" {
+				state, err := playback.RestartBlock()
+				if !cmdHandleErr(err) {
+					printNowPlaying(state)
+				}
+			} else if args[1] == "jump" {
+				if len(args) < 3 {
+					printHelp(args[0])
+					continue
+				}
+
+				index, err := strconv.Atoi(args[2])
+				if cmdHandleErr(err) {
+					continue
+				}
+				state, err := playback.JumpToBlock(index)
+				if !cmdHandleErr(err) {
+					printNowPlaying(state)
+				}
+			} else if args[1] == "playlist" {
+				if len(args) < 3 {
+					printHelp(args[0])
+					continue
+				}
+
+				blocks, err := database.ScheduleBlocks(database.ScheduleQuery{PlaylistId: args[2]})
+				if cmdHandleErr(err) {
+					continue
+				}
+				for _, block := range blocks {
+					fmt.Println("Date " + block.Date)
+					printPlan(block.PlanBlock)
+				}
+			} else if args[1] == "at" {
+				if len(args) < 4 {
+					printHelp(args[0])
+					continue
+				}
+
+				at, err := time.Parse(time.RFC3339, args[2]+"T"+args[3]+"-00:00")
+				if cmdHandleErr(err) {
+					continue
+				}
+
+				block, err := database.ScheduleBlockAt(at)
+				if cmdHandleErr(err) {
+					continue
+				}
+				if block == nil {
+					log.Println("Nothing is planned at " + args[2] + " " + args[3])
+					continue
+				}
+				fmt.Println("Date " + block.Date)
+				printPlan(block.PlanBlock)
 				// schedule add YYYY-MM-dd
 			} else if args[1] == "change" {
 				if len(args) < 3 {
@@ -582,6 +1030,255 @@ func consoleInput() {
 				playback.ScheduleChanged(date)
 				log.Println("Schedule for '" + date + "' successfully set!")
 			}
+		} else if args[0] == "trash" {
+			if len(args) < 2 {
+				printHelp(args[0])
+				continue
+			}
+
+			if args[1] == "list" {
+				trash, err := database.GetTrash()
+				if cmdHandleErr(err) {
+					continue
+				}
+				fmt.Println("=== Songs ===")
+				for _, song := range trash.Songs {
+					printSong(song)
+				}
+				fmt.Println("=== Playlists ===")
+				for _, playlist := range trash.Playlists {
+					printPlaylist(playlist)
+				}
+			} else if args[1] == "restore" {
+				if len(args) < 4 {
+					printHelp(args[0])
+					continue
+				}
+
+				if args[2] == "song" {
+					err = database.RestoreSong(args[3])
+				} else if args[2] == "playlist" {
+					err = database.RestorePlaylist(args[3])
+				} else {
+					printHelp(args[0])
+					continue
+				}
+				if !cmdHandleErr(err) {
+					log.Println("Restored " + args[2] + " " + args[3] + " from the trash!")
+				}
+			} else if args[1] == "purge" {
+				purged, err := database.PurgeTrash(*trashRetention)
+				if !cmdHandleErr(err) {
+					log.Println("Purged " + strconv.Itoa(purged) + " items older than " + trashRetention.String() + " from the trash!")
+				}
+			}
+		} else if args[0] == "period" {
+			if len(args) < 2 {
+				printHelp(args[0])
+				continue
+			}
+
+			if args[1] == "list" {
+				periods, err := database.GetVotingPeriods()
+				if cmdHandleErr(err) {
+					continue
+				}
+				for _, period := range periods {
+					printPeriod(period)
+				}
+			} else if args[1] == "add" {
+				if len(args) < 6 {
+					printHelp(args[0])
+					continue
+				}
+
+				start, err := time.ParseInLocation("2006-01-02", args[4], time.Local)
+				if cmdHandleErr(err) {
+					continue
+				}
+				end, err := time.ParseInLocation("2006-01-02", args[5], time.Local)
+				if cmdHandleErr(err) {
+					continue
+				}
+
+				// the end date is inclusive
+				periodid, err := database.AddVotingPeriod(args[3], args[2], start, end.AddDate(0, 0, 1))
+				if !cmdHandleErr(err) {
+					log.Println("Voting period " + args[3] + " added with id " + strconv.Itoa(periodid) + "!")
+				}
+			} else if args[1] == "close" {
+				if len(args) < 3 {
+					printHelp(args[0])
+					continue
+				}
+
+				periodid, err := strconv.Atoi(args[2])
+				if cmdHandleErr(err) {
+					continue
+				}
+				err = database.ClosePeriod(periodid)
+				if !cmdHandleErr(err) {
+					log.Println("Voting period " + args[2] + " closed, results archived!")
+				}
+			} else if args[1] == "results" {
+				var period *database.VotingPeriod
+				if len(args) < 3 || args[2] == "current" {
+					period, err = database.CurrentWeeklyPeriod()
+				} else {
+					periodid, convErr := strconv.Atoi(args[2])
+					if cmdHandleErr(convErr) {
+						continue
+					}
+					period, err = database.GetVotingPeriod(periodid)
+				}
+				if cmdHandleErr(err) {
+					continue
+				}
+
+				chart, err := database.Leaderboard(*period)
+				if cmdHandleErr(err) {
+					continue
+				}
+				printPeriod(*period)
+				for _, pos := range chart {
+					fmt.Printf("%3d. [%d] %s - %s  %+d (%d up, %d down)\n", pos.Position, pos.SongId, pos.Authors, pos.Title, pos.Score, pos.Up, pos.Down)
+				}
+			}
+		} else if args[0] == "scan" {
+			scanLibrary()
+		} else if args[0] == "export" {
+			if len(args) < 2 {
+				printHelp(args[0])
+				continue
+			}
+
+			exportLibrary(args[1])
+		} else if args[0] == "import" {
+			if len(args) < 2 {
+				printHelp(args[0])
+				continue
+			}
+
+			importLibrary(args[1], len(args) >= 3 && args[2] == "dry-run")
+		} else if args[0] == "token" {
+			if len(args) < 2 {
+				printHelp(args[0])
+				continue
+			}
+
+			if args[1] == "list" {
+				tokens, err := database.GetAPITokens()
+				if cmdHandleErr(err) {
+					continue
+				}
+				for _, token := range tokens {
+					status := "created on " + token.CreatedAt.Format("2006-01-02 15:04:05")
+					if token.RevokedAt != nil {
+						status += ", revoked on " + token.RevokedAt.Format("2006-01-02 15:04:05")
+					}
+					fmt.Println("[" + strconv.Itoa(token.Id) + "] " + token.Name + " (" + status + ")")
+				}
+			} else if args[1] == "add" {
+				if len(args) < 3 {
+					printHelp(args[0])
+					continue
+				}
+
+				name := strings.Join(args[2:], " ")
+				token, err := database.AddAPIToken(name)
+				if !cmdHandleErr(err) {
+					log.Println("Token for " + name + " created, it won't be shown again:")
+					fmt.Println(token)
+				}
+			} else if args[1] == "revoke" {
+				if len(args) < 3 {
+					printHelp(args[0])
+					continue
+				}
+
+				tokenid, err := strconv.Atoi(args[2])
+				if cmdHandleErr(err) {
+					continue
+				}
+				err = database.RevokeAPIToken(tokenid)
+				if !cmdHandleErr(err) {
+					log.Println("Token " + args[2] + " revoked!")
+				}
+			}
+		} else if args[0] == "aircheck" {
+			if len(args) < 2 {
+				printHelp(args[0])
+				continue
+			}
+
+			if args[1] == "list" {
+				airchecks, err := playback.Airchecks()
+				if cmdHandleErr(err) {
+					continue
+				}
+				if playback.AircheckDir == "" {
+					log.Println("Recording is off, start with -aircheck-dir to turn it on")
+				}
+				for _, aircheck := range airchecks {
+					printAircheck(aircheck)
+				}
+			} else if args[1] == "copy" {
+				if len(args) < 4 {
+					printHelp(args[0])
+					continue
+				}
+
+				err = playback.CopyAircheck(args[2], args[3])
+				if !cmdHandleErr(err) {
+					log.Println("Recording " + args[2] + " copied to " + args[3] + "!")
+				}
+			}
+		} else if args[0] == "migrate" {
+			if len(args) < 2 {
+				printHelp(args[0])
+				continue
+			}
+
+			if args[1] == "status" {
+				states, err := database.MigrationStatus()
+				if cmdHandleErr(err) {
+					continue
+				}
+				for _, state := range states {
+					printMigration(state)
+				}
+			} else if args[1] == "up" {
+				err = database.Migrate()
+				if !cmdHandleErr(err) {
+					log.Println("Database schema is up to date!")
+				}
+			} else if args[1] == "rollback" {
+				if len(args) < 3 {
+					printHelp(args[0])
+					continue
+				}
+
+				version, err := strconv.Atoi(args[2])
+				if cmdHandleErr(err) {
+					continue
+				}
+
+				fmt.Println("=Are you sure you want to revert every migration newer than " + args[2] + "? (y/n)")
+				yn, err := reader.ReadString('\n')
+				if cmdHandleErr(err) {
+					continue
+				}
+				yn = strings.TrimSuffix(yn, "\r\n")
+
+				if yn == "y" {
+					err = database.Rollback(version)
+					if !cmdHandleErr(err) {
+						log.Println("Rolled back to version " + args[2] + "!")
+					}
+				} else {
+					log.Println("Rollback canceled.")
+				}
+			}
 		} else {
 			fmt.Println("Unknown command")
 			printHelp(args[0])
@@ -713,6 +1410,92 @@ func readBroadcastType(start, end time.Time) *database.PlanBlock {
 	return nil
 }
 
+// reads a line, returning current if the operator typed keep or nothing
+func readKeep(prompt, current string) (string, bool) {
+	fmt.Println("=" + prompt + " [" + current + "] (keep | <value>):")
+	value, err := reader.ReadString('\n')
+	if cmdHandleErr(err) {
+		return "", false
+	}
+	value = strings.TrimSuffix(value, "\r\n")
+	if value == "" || value == "keep" {
+		return current, true
+	}
+	return value, true
+}
+
+// walks through every editable field of a song; false if reading failed
+func readSongMetadata(song *database.SongData) bool {
+	var ok bool
+	if song.Title, ok = readKeep("Title", song.Title); !ok {
+		return false
+	}
+	if song.Authors, ok = readKeep("Authors", song.Authors); !ok {
+		return false
+	}
+	if song.YTId, ok = readKeep("YouTube", song.YTId); !ok {
+		return false
+	}
+
+	date, ok := readKeep("Release date", song.ReleaseDate.Format("2006-01-02"))
+	if !ok {
+		return false
+	}
+	resdate, err := time.Parse("2006-01-02", date)
+	if cmdHandleErr(err) {
+		return false
+	}
+	song.ReleaseDate = resdate
+
+	genres, ok := readKeep("Genres (comma separated)", strings.Join(song.Genres, ","))
+	if !ok {
+		return false
+	}
+	song.Genres = database.SplitTags(genres)
+
+	tags, ok := readKeep("Tags (comma separated)", strings.Join(song.Tags, ","))
+	if !ok {
+		return false
+	}
+	song.Tags = database.SplitTags(tags)
+
+	bpm, ok := readKeep("BPM (0 if unknown)", strconv.Itoa(song.BPM))
+	if !ok {
+		return false
+	}
+	song.BPM, err = strconv.Atoi(bpm)
+	if cmdHandleErr(err) {
+		return false
+	}
+
+	if song.Language, ok = readKeep("Language (ISO 639 code)", song.Language); !ok {
+		return false
+	}
+	if song.ISRC, ok = readKeep("ISRC", song.ISRC); !ok {
+		return false
+	}
+
+	explicit, ok := readKeep("Explicit (true | false)", strconv.FormatBool(song.Explicit))
+	if !ok {
+		return false
+	}
+	song.Explicit, err = strconv.ParseBool(explicit)
+	return !cmdHandleErr(err)
+}
+
+// turns key=value console arguments into a song filter
+func parseFilterArgs(args []string) (database.SongFilter, error) {
+	values := url.Values{}
+	for _, arg := range args {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 {
+			return database.SongFilter{}, fmt.Errorf("filter '%s' is not key=value", arg)
+		}
+		values.Set(kv[0], kv[1])
+	}
+	return database.ParseSongFilter(values)
+}
+
 func cmdHandleErr(err error) bool {
 	if err != nil {
 		log.Println("Command could not be read!", err)
@@ -749,8 +1532,35 @@ func printSong(song database.SongData) {
 	fmt.Println("  Authors:  " + song.Authors)
 	fmt.Println("  YouTube:  " + song.YTId)
 	fmt.Println("  Released: " + song.ReleaseDate.Format("2006-01-02"))
+	if len(song.Genres) > 0 {
+		fmt.Println("  Genres:   " + strings.Join(song.Genres, ", "))
+	}
+	if len(song.Tags) > 0 {
+		fmt.Println("  Tags:     " + strings.Join(song.Tags, ", "))
+	}
+	if song.BPM > 0 {
+		fmt.Println("  BPM:      " + strconv.Itoa(song.BPM))
+	}
+	if song.Language != "" {
+		fmt.Println("  Language: " + song.Language)
+	}
+	if song.ISRC != "" {
+		fmt.Println("  ISRC:     " + song.ISRC)
+	}
+	if song.Explicit {
+		fmt.Println("  Explicit")
+	}
+	if song.Loudness != nil {
+		fmt.Println("  Loudness: " + formatLoudness(*song.Loudness))
+	}
+	if song.Cues != nil {
+		fmt.Println("  Cues:     " + formatCues(*song.Cues))
+	}
 	fmt.Println("  Votes:    " + votes)
 	fmt.Println("  added to library on " + song.DebutedAt.Format("2006-01-02 15:04:05"))
+	if song.DeletedAt != nil {
+		fmt.Println("  deleted on " + song.DeletedAt.Format("2006-01-02 15:04:05"))
+	}
 	fmt.Println()
 
 }
@@ -762,22 +1572,161 @@ func printPlaylist(playlist database.Playlist) {
 	fmt.Println("  Title:       " + playlist.Name)
 	fmt.Println("  Description: " + playlist.Desc)
 	fmt.Println("  Rank:        " + rank)
+	fmt.Println("  Mode:        " + playlist.Mode)
 	fmt.Println("  added to library on " + playlist.DebutDate.Format("2006-01-02 15:04:05"))
+	if playlist.DeletedAt != nil {
+		fmt.Println("  deleted on " + playlist.DeletedAt.Format("2006-01-02 15:04:05"))
+	}
 	fmt.Println()
 
 }
 
+func printMigration(state database.MigrationState) {
+	status := "pending"
+	if state.Applied {
+		status = "applied on " + state.AppliedAt.Format("2006-01-02 15:04:05")
+	}
+	fmt.Printf("%04d %-32s %s\n", state.Version, state.Name, status)
+}
+
+func printNowPlaying(state playback.NowPlaying) {
+	status := "playing"
+	if state.Paused {
+		status = "paused"
+	}
+	fmt.Printf("%s at %s dB\n", status, strconv.FormatFloat(state.Volume, 'f', -1, 64))
+	if state.Plan == nil {
+		fmt.Println("Between blocks")
+		fmt.Println()
+		return
+	}
+	position := formatCueTime(state.Elapsed) + " / " + formatCueTime(state.Length)
+	if state.Song != nil {
+		fmt.Println(state.Song.Authors + " - " + state.Song.Title + " " + position)
+	} else if state.File != "" {
+		fmt.Println(state.File + " " + position)
+	}
+	fmt.Println("Pos " + strconv.Itoa(state.Block))
+	printPlan(*state.Plan)
+}
+
+func printAircheck(aircheck playback.Aircheck) {
+	status := "complete"
+	if aircheck.Recording {
+		status = "recording"
+	}
+	if aircheck.Audio == "" {
+		status = "no audio"
+	}
+	fmt.Printf("%s %8.1f MB, %s\n", aircheck.Name, float64(aircheck.Size)/(1<<20), status)
+}
+
+func printPeriod(period database.VotingPeriod) {
+	status := "open"
+	if period.ClosedAt != nil {
+		status = "closed on " + period.ClosedAt.Format("2006-01-02 15:04:05")
+	}
+	fmt.Printf("[%d] %s (%s) %s - %s, %s\n", period.Id, period.Name, period.Kind,
+		period.Start.Format("2006-01-02"), period.End.AddDate(0, 0, -1).Format("2006-01-02"), status)
+}
+
+func printImportReport(report database.ImportReport) {
+	verb := "Imported"
+	if report.DryRun {
+		verb = "Would import"
+	}
+	fmt.Printf("%s %d songs, %d playlists, %d playlist entries, %d schedules, %d votes and %d files\n",
+		verb, report.Songs, report.Playlists, report.Entries, report.Schedules, report.Votes, report.Files)
+
+	printRemapped := func(kind string, remapped map[int]int) {
+		var oldids []int
+		for oldid := range remapped {
+			oldids = append(oldids, oldid)
+		}
+		sort.Ints(oldids)
+		for _, oldid := range oldids {
+			newid := "a new id"
+			if remapped[oldid] != 0 {
+				newid = strconv.Itoa(remapped[oldid])
+			}
+			fmt.Printf("  %s %d is taken, moves to %s\n", kind, oldid, newid)
+		}
+	}
+	printRemapped("song", report.RemappedSongs)
+	printRemapped("playlist", report.RemappedPlaylists)
+	for _, date := range report.SkippedSchedules {
+		fmt.Println("  schedule for " + date + " already exists, left as it is")
+	}
+	fmt.Println()
+}
+
+func formatLoudness(loudness database.Loudness) string {
+	gain := playback.TrackGain(&database.SongData{Loudness: &loudness})
+	return strconv.FormatFloat(loudness.Integrated, 'f', 1, 64) + " LUFS, peak " +
+		strconv.FormatFloat(loudness.TruePeak, 'f', 1, 64) + " dBTP, played at " + strconv.FormatFloat(gain, 'f', 1, 64) + " dB"
+}
+
+// m:ss.ss, or - for intro and outro markers which aren't set
+func formatCueTime(ms int) string {
+	return fmt.Sprintf("%d:%05.2f", ms/60000, float64(ms%60000)/1000)
+}
+
+func formatCues(cues database.Cues) string {
+	optional := func(ms int) string {
+		if ms == 0 {
+			return "-"
+		}
+		return formatCueTime(ms)
+	}
+	return "in " + formatCueTime(cues.CueIn) + ", intro ends " + optional(cues.IntroEnd) +
+		", outro starts " + optional(cues.OutroStart) + ", out " + formatCueTime(cues.CueOut)
+}
+
+// accepts seconds, m:ss with decimals, or - for none
+func parseCueTime(value string) (int, error) {
+	if value == "-" {
+		return 0, nil
+	}
+	errInvalid := errors.New("'" + value + "' isn't a time, use seconds or m:ss")
+	minutes := 0
+	secondsPart := value
+	if colon := strings.Index(value, ":"); colon >= 0 {
+		var err error
+		if minutes, err = strconv.Atoi(value[:colon]); err != nil || minutes < 0 {
+			return 0, errInvalid
+		}
+		secondsPart = value[colon+1:]
+	}
+	seconds, err := strconv.ParseFloat(secondsPart, 64)
+	if err != nil || seconds < 0 {
+		return 0, errInvalid
+	}
+	return minutes*60000 + int(seconds*1000+0.5), nil
+}
+
 func printHelp(cmd string) {
 	if cmd == "schedule" {
 		fmt.Println("Not enough args")
 		fmt.Println("schedule today")
 		fmt.Println("schedule set <YYYY-MM-dd>")
 		fmt.Println("schedule change <YYYY-MM-dd>")
+		fmt.Println("schedule playlist <playlistid>")
+		fmt.Println("schedule at <YYYY-MM-dd> <HH:mm:ss>")
+		fmt.Println("schedule restart")
+		fmt.Println("schedule jump <pos>")
 	} else if cmd == "song" {
 		fmt.Println("Not enough args")
-		fmt.Println("song list [page]")
+		fmt.Println("song list [page] [genre=<genre>] [tag=<tag>] [language=<code>] [explicit=<true|false>] [minbpm=<n>] [maxbpm=<n>]")
 		fmt.Println("song add")
+		fmt.Println("song edit <id>")
 		fmt.Println("song delete <id>")
+		fmt.Println("song verify [id | all] [fix]")
+		fmt.Println("song analyse [id | all]")
+		fmt.Println("song cues <id> [<cue in> <intro end | -> <outro start | -> <cue out>]")
+		fmt.Println("song detectcues [id | all]")
+		fmt.Println("song fingerprint [id | all]")
+		fmt.Println("song duplicates")
+		fmt.Println("song merge <keep id> <duplicate id>")
 	} else if cmd == "playlist" {
 		fmt.Println("Not enough args")
 		fmt.Println("playlist list")
@@ -786,6 +1735,10 @@ func printHelp(cmd string) {
 		fmt.Println("playlist delete <id>")
 		fmt.Println("playlist addsong <playlistid> <songid>")
 		fmt.Println("playlist remsong <playlistid> <songid>")
+		fmt.Println("playlist insert <playlistid> <songid> <position>")
+		fmt.Println("playlist move <playlistid> <from position> <to position>")
+		fmt.Println("playlist reorder <playlistid> <position,position,...>")
+		fmt.Println("playlist mode <playlistid> <shuffle | ordered>")
 	} else if cmd == "queue" {
 		fmt.Println("Not enough args")
 		fmt.Println("queue get <playlistid>")
@@ -793,12 +1746,58 @@ func printHelp(cmd string) {
 		fmt.Println("Not enough args")
 		fmt.Println("query song [query ...]")
 		fmt.Println("query playlist [query ...]")
+		fmt.Println("  words match by prefix, \"quoted phrases\" as a whole, -word excludes")
+		fmt.Println("  fields: author: title: tag: genre: year:2019..2021 lang: id:")
+	} else if cmd == "trash" {
+		fmt.Println("Not enough args")
+		fmt.Println("trash list")
+		fmt.Println("trash restore <song | playlist> <id>")
+		fmt.Println("trash purge")
+	} else if cmd == "period" {
+		fmt.Println("Not enough args")
+		fmt.Println("period list")
+		fmt.Println("period add <weekly | semester | custom> <name> <YYYY-MM-dd> <YYYY-MM-dd>")
+		fmt.Println("period close <id>")
+		fmt.Println("period results [id | current]")
+	} else if cmd == "export" {
+		fmt.Println("Not enough args")
+		fmt.Println("export <file>")
+	} else if cmd == "import" {
+		fmt.Println("Not enough args")
+		fmt.Println("import <file> [dry-run]")
+	} else if cmd == "token" {
+		fmt.Println("Not enough args")
+		fmt.Println("token list")
+		fmt.Println("token add <name>")
+		fmt.Println("token revoke <id>")
+	} else if cmd == "aircheck" {
+		fmt.Println("Not enough args")
+		fmt.Println("aircheck list")
+		fmt.Println("aircheck copy <name> <directory>")
+	} else if cmd == "migrate" {
+		fmt.Println("Not enough args")
+		fmt.Println("migrate status")
+		fmt.Println("migrate up")
+		fmt.Println("migrate rollback <version>")
 	} else {
+		fmt.Println("skip")
+		fmt.Println("pause")
+		fmt.Println("resume")
+		fmt.Println("volume [dB]")
+		fmt.Println("nowplaying")
 		fmt.Println("schedule")
 		fmt.Println("song")
 		fmt.Println("playlist")
 		fmt.Println("queue")
 		fmt.Println("query")
+		fmt.Println("trash")
+		fmt.Println("period")
+		fmt.Println("scan")
+		fmt.Println("export")
+		fmt.Println("import")
+		fmt.Println("token")
+		fmt.Println("aircheck")
+		fmt.Println("migrate")
 	}
 	fmt.Println()
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"log"
 	"net/http"
+	"strings"
 	"sync"
 
 	"radio/utils"
@@ -21,7 +22,11 @@ func (p *Protect) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	// prevent token leakage etc."no-referrer"
 	w.Header().Set("Referrer-Policy", "no-referrer")
 
-	if r.Method == http.MethodPost {
+	// requests carrying an API token aren't sent by browsers on their own,
+	// the token itself is checked by database.RequireToken
+	bearer := strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	if r.Method == http.MethodPost && !bearer {
 		// Cookie should be set by session middleware
 		// But it doesn't hurt to double-check.
 		session, err := r.Cookie("session")
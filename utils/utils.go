@@ -10,6 +10,7 @@ import (
 	"bytes"
 	"log"
 	"net/http"
+	"sync"
 	"time"
 )
 
@@ -46,9 +47,11 @@ type JsonResponse struct {
 	Message string `json:"message"`
 }
 
-var tmplError = template.Must(template.ParseFiles(
-	"html/base.layout.html",
-))
+// parsed on first use, so packages importing utils load without html/
+var (
+	tmplError     *template.Template
+	tmplErrorOnce sync.Once
+)
 
 func SendHTTP(w http.ResponseWriter, r *http.Request, msg string, title string) {
 	w.Header().Set("Content-Type", "text/html")
@@ -59,6 +62,11 @@ func SendHTTP(w http.ResponseWriter, r *http.Request, msg string, title string)
 		CurrentYear:   time.Now().Year(),
 	}
 
+	tmplErrorOnce.Do(func() {
+		tmplError = template.Must(template.ParseFiles(
+			"html/base.layout.html",
+		))
+	})
 	tmplError.Execute(w, view)
 }
 